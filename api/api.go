@@ -5,23 +5,44 @@ import (
 	"app/api/handler"
 
 	"app/config"
+	"app/pkg/health"
+	"app/pkg/helper"
 	"app/pkg/logger"
+	"app/pkg/metrics"
+	"app/pkg/notify"
+	"app/pkg/password"
 	"app/storage"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"     // swagger embed files
 	ginSwagger "github.com/swaggo/gin-swagger" // gin-swagger middleware
 )
 
-func NewApi(r *gin.Engine, cfg *config.Config, store storage.StorageI, logger logger.LoggerI) {
+func NewApi(r *gin.Engine, cfg *config.Config, store storage.StorageI, logger logger.LoggerI, metrics *metrics.Metrics, health *health.Registry, issuer helper.TokenIssuer, policy *password.Policy, emails notify.EmailSender, sms notify.SMSSender) {
 
 	// @securityDefinitions.apikey ApiKeyAuth
 	// @in header
 	// @name Authorization
 
-	handler := handler.NewHandler(cfg, store, logger)
+	handler := handler.NewHandler(cfg, store, logger, metrics, health, issuer, policy, emails, sms)
 
-	r.Use(customCORSMiddleware())
+	// liveness and readiness probes, registered before the middlewares to keep them out of access logs and metrics
+	r.GET("/healthz", handler.Healthz)
+	r.GET("/readyz", handler.Readyz)
+
+	r.Use(
+		handler.RequestIDMiddleware(),
+		handler.TracingMiddleware(),
+		handler.AccessLogMiddleware(),
+		handler.MetricsMiddleware(),
+		securityHeadersMiddleware(cfg),
+		corsMiddleware(cfg),
+		bodyLimitMiddleware(cfg.MaxBodyBytes),
+	)
+
+	// prometheus metrics
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 
 	v1 := r.Group("/v1")
 
@@ -33,17 +54,74 @@ func NewApi(r *gin.Engine, cfg *config.Config, store storage.StorageI, logger lo
 	// login
 	r.POST("/login", handler.LoginUser)
 
+	// target of the email verification links
+	r.GET("/verify-email", handler.VerifyEmail)
+
+	// public keys of the token signer
+	r.GET("/.well-known/jwks.json", handler.JWKS)
+
+	// oauth 2.0 authorization server
+	r.GET("/oauth/authorize", handler.Authorize)
+	r.POST("/oauth/authorize", handler.AuthorizeDecision)
+	r.POST("/oauth/token", handler.Token)
+	r.POST("/oauth/revoke", handler.RevokeToken)
+	r.POST("/oauth/introspect", handler.IntrospectToken)
+
+	// openid connect on top of it
+	r.GET("/.well-known/openid-configuration", handler.OpenIDConfiguration)
+	r.GET("/userinfo", handler.UserInfo)
+	r.POST("/userinfo", handler.UserInfo)
+
+	// login through upstream openid connect providers
+	r.GET("/login/:provider", handler.LoginWithProvider)
+	r.GET("/login/:provider/callback", handler.LoginCallback)
+
+	// login with a code sent by SMS to a verified phone number, unless
+	// SMS_SENDER=none
+	if sms != nil {
+		r.POST("/login/otp/start", handler.StartOTPLogin)
+		r.POST("/login/otp/verify", handler.VerifyOTPLogin)
+	}
+
+	// passkeys
+	r.POST("/webauthn/register/begin", handler.AuthMiddleware(), handler.CSRFMiddleware(), handler.BeginWebAuthnRegistration)
+	r.POST("/webauthn/register/finish", handler.AuthMiddleware(), handler.CSRFMiddleware(), handler.FinishWebAuthnRegistration)
+	r.POST("/webauthn/login/begin", handler.BeginWebAuthnLogin)
+	r.POST("/webauthn/login/finish", handler.FinishWebAuthnLogin)
+
 	//logout
 
-	r.POST("/logout", handler.LogOutUser)
+	r.POST("/logout", handler.CSRFMiddleware(), handler.LogOutUser)
+
+	// anti-forgery token for requests authenticated with the login cookie
+	r.GET("/csrf-token", handler.AuthMiddleware(), handler.CSRFToken)
 
 	// user api
-	v1.Use(handler.AuthMiddleware())
+	v1.Use(handler.AuthMiddleware(), handler.CSRFMiddleware())
 	v1.POST("/user", handler.CreateUser)
 	v1.GET("/user/:id", handler.GetByIdUser)
 	v1.GET("/user", handler.GetListUser)
 	v1.PUT("/user/:id", handler.UpdateUser)
 	v1.DELETE("/user/:id", handler.DeleteUser)
+	v1.POST("/user/me/email/verification", handler.ResendEmailVerification)
+
+	// session api
+	v1.GET("/user/me/sessions", handler.GetListSession)
+	v1.DELETE("/user/me/sessions/:id", handler.RevokeSession)
+	v1.DELETE("/user/me/sessions", handler.RevokeOtherSessions)
+
+	// linked identity api
+	v1.GET("/user/me/identities", handler.GetListIdentity)
+	v1.DELETE("/user/me/identities/:id", handler.DeleteIdentity)
+
+	// api key api
+	v1.POST("/user/me/api-keys", handler.CreateAPIKey)
+	v1.GET("/user/me/api-keys", handler.GetListAPIKey)
+	v1.DELETE("/user/me/api-keys/:id", handler.RevokeAPIKey)
+
+	// passkey api
+	v1.GET("/user/me/passkeys", handler.GetListPasskey)
+	v1.DELETE("/user/me/passkeys/:id", handler.DeletePasskey)
 
 	// phone api
 	v1.POST("/user/phone", handler.CreatePhone)
@@ -51,6 +129,17 @@ func NewApi(r *gin.Engine, cfg *config.Config, store storage.StorageI, logger lo
 	v1.GET("/user/phone", handler.GetListPhone)
 	v1.PUT("/user/phone/:id", handler.UpdatePhone)
 	v1.DELETE("/v1/user/phone/:id", handler.DeletePhone)
+	if sms != nil {
+		v1.POST("/user/phone/:id/verification", handler.StartPhoneVerification)
+		v1.POST("/user/phone/:id/verification/confirm", handler.ConfirmPhoneVerification)
+	}
+
+	// admin api
+	admin := v1.Group("/admin", handler.AdminMiddleware())
+	admin.GET("/audit", handler.GetListAudit)
+	admin.POST("/oauth/clients", handler.CreateOAuthClient)
+	admin.GET("/oauth/clients", handler.GetListOAuthClient)
+	admin.DELETE("/oauth/clients/:id", handler.DeleteOAuthClient)
 
 
 
@@ -58,18 +147,15 @@ func NewApi(r *gin.Engine, cfg *config.Config, store storage.StorageI, logger lo
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
 }
 
-func customCORSMiddleware() gin.HandlerFunc {
+// bodyLimitMiddleware makes reading more than limit bytes of a request body fail.
+func bodyLimitMiddleware(limit int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "POST, GET, PUT, PATCH, DELETE, OPTIONS, HEAD")
-		c.Header("Access-Control-Allow-Headers", "Platform-Id, Content-Type, Accesp-Encoding, Authorization, Cache-Control")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		if c.Request.ContentLength > limit {
+			c.AbortWithStatus(http.StatusRequestEntityTooLarge)
 			return
 		}
 
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
 		c.Next()
 	}
 }
-
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"app/config"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsPolicy is a config.CORSPolicy prepared for answering requests.
+type corsPolicy struct {
+	paths            []string
+	anyOrigin        bool
+	origins          map[string]bool
+	subdomains       []subdomainPattern
+	allowCredentials bool
+	allowedMethods   string
+	allowedHeaders   string
+	exposedHeaders   string
+	maxAge           string
+}
+
+// subdomainPattern matches the origins of scheme://*.host[:port], as
+// scheme:// followed by a subdomain label and .host[:port].
+type subdomainPattern struct {
+	prefix string
+	suffix string
+}
+
+func newCORSPolicy(p config.CORSPolicy) *corsPolicy {
+	policy := &corsPolicy{
+		paths:            p.Paths,
+		origins:          map[string]bool{},
+		allowCredentials: p.AllowCredentials,
+		allowedMethods:   strings.Join(p.AllowedMethods, ", "),
+		allowedHeaders:   strings.Join(p.AllowedHeaders, ", "),
+		exposedHeaders:   strings.Join(p.ExposedHeaders, ", "),
+	}
+	if p.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(int(p.MaxAge.Seconds()))
+	}
+
+	for _, origin := range p.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			policy.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			i := strings.Index(origin, "://*.")
+			policy.subdomains = append(policy.subdomains, subdomainPattern{prefix: origin[:i+3], suffix: origin[i+4:]})
+		default:
+			policy.origins[origin] = true
+		}
+	}
+
+	return policy
+}
+
+// allowOrigin reports whether the policy lets pages of origin call the API.
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+
+	for _, s := range p.subdomains {
+		if len(origin) <= len(s.prefix)+len(s.suffix) || !strings.HasPrefix(origin, s.prefix) || !strings.HasSuffix(origin, s.suffix) {
+			continue
+		}
+		// the part the * stands for is a host name, not another port or user
+		if sub := origin[len(s.prefix) : len(origin)-len(s.suffix)]; !strings.ContainsAny(sub, ":/@?#") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// underPath reports whether path is prefix or below it, so /v1/public covers
+// /v1/public/docs but not /v1/publications.
+func underPath(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// corsMiddleware applies the CORS policy of the route group the request path
+// falls in, or else the default one. It answers preflight requests itself,
+// with 204 for allowed origins and 403 otherwise, since they match no route.
+func corsMiddleware(cfg *config.Config) gin.HandlerFunc {
+	def := newCORSPolicy(cfg.CORS)
+
+	var groups []*corsPolicy
+	for _, g := range cfg.CORSGroups {
+		groups = append(groups, newCORSPolicy(g))
+	}
+
+	return func(c *gin.Context) {
+		policy, longest := def, 0
+		for _, g := range groups {
+			for _, path := range g.paths {
+				if len(path) > longest && underPath(c.Request.URL.Path, path) {
+					policy, longest = g, len(path)
+				}
+			}
+		}
+
+		preflight := c.Request.Method == http.MethodOptions && len(c.GetHeader("Access-Control-Request-Method")) > 0
+
+		// the answer depends on these request headers, keep caches from
+		// serving it to another origin
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		origin := c.GetHeader("Origin")
+		if len(origin) <= 0 {
+			c.Next()
+			return
+		}
+
+		allowed := policy.allowOrigin(origin)
+		if allowed {
+			if policy.anyOrigin {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.allowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if preflight {
+			if !allowed {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			header.Set("Access-Control-Allow-Methods", policy.allowedMethods)
+			header.Set("Access-Control-Allow-Headers", policy.allowedHeaders)
+			if len(policy.maxAge) > 0 {
+				header.Set("Access-Control-Max-Age", policy.maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		if allowed && len(policy.exposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", policy.exposedHeaders)
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"app/config"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newCORSRouter serves GET and POST on every path behind corsMiddleware.
+func newCORSRouter(cfg *config.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(corsMiddleware(cfg))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/*path", ok)
+	r.POST("/*path", ok)
+
+	return r
+}
+
+func testCORSConfig() *config.Config {
+	return &config.Config{
+		CORS: config.CORSPolicy{
+			AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+			AllowCredentials: true,
+			AllowedMethods:   []string{"GET", "POST"},
+			AllowedHeaders:   []string{"Content-Type", "X-CSRF-Token"},
+			ExposedHeaders:   []string{"X-Request-ID"},
+			MaxAge:           10 * time.Minute,
+		},
+		CORSGroups: []config.CORSPolicy{
+			{
+				Name:           "public",
+				Paths:          []string{"/v1/public"},
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET"},
+				AllowedHeaders: []string{"Content-Type"},
+			},
+			{
+				Name:             "partner",
+				Paths:            []string{"/v1/public/partner"},
+				AllowedOrigins:   []string{"https://partner.example.net"},
+				AllowCredentials: true,
+				AllowedMethods:   []string{"GET", "DELETE"},
+				AllowedHeaders:   []string{"Authorization"},
+			},
+		},
+	}
+}
+
+func corsRequest(r http.Handler, method, path, origin string, preflight bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if len(origin) > 0 {
+		req.Header.Set("Origin", origin)
+	}
+	if preflight {
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "content-type")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestCORSPreflight(t *testing.T) {
+	r := newCORSRouter(testCORSConfig())
+
+	w := corsRequest(r, http.MethodOptions, "/v1/user", "https://app.example.com", true)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight = %d, want %d", w.Code, http.StatusNoContent)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Content-Type, X-CSRF-Token",
+		"Access-Control-Max-Age":           "600",
+		"Access-Control-Expose-Headers":    "",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	w = corsRequest(r, http.MethodOptions, "/v1/user", "https://evil.example.com", true)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("preflight from another origin = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); len(got) > 0 {
+		t.Fatalf("Access-Control-Allow-Origin = %q for another origin", got)
+	}
+
+	// an OPTIONS request without Access-Control-Request-Method is no preflight
+	w = corsRequest(r, http.MethodOptions, "/v1/user", "https://app.example.com", false)
+	if w.Code == http.StatusNoContent || len(w.Header().Get("Access-Control-Allow-Methods")) > 0 {
+		t.Fatalf("plain OPTIONS = %d with methods %q, want it routed", w.Code, w.Header().Get("Access-Control-Allow-Methods"))
+	}
+}
+
+func TestCORSActualRequest(t *testing.T) {
+	r := newCORSRouter(testCORSConfig())
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed bool
+	}{
+		{"configured origin", "https://app.example.com", true},
+		{"configured origin in upper case", "https://APP.example.com", true},
+		{"other scheme", "http://app.example.com", false},
+		{"other port", "https://app.example.com:8443", false},
+		{"other site", "https://evil.com", false},
+		{"configured origin as a subdomain", "https://app.example.com.evil.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := corsRequest(r, http.MethodPost, "/v1/user", tt.origin, false)
+			if w.Code != http.StatusOK {
+				t.Fatalf("request = %d, want %d; the browser decides, not the server", w.Code, http.StatusOK)
+			}
+
+			got := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.allowed && (got != tt.origin || w.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID") {
+				t.Fatalf("Access-Control-Allow-Origin = %q, Expose-Headers = %q", got, w.Header().Get("Access-Control-Expose-Headers"))
+			}
+			if !tt.allowed && (len(got) > 0 || len(w.Header().Get("Access-Control-Allow-Credentials")) > 0) {
+				t.Fatalf("headers %v for an origin not allowed", w.Header())
+			}
+		})
+	}
+
+	// same-origin and non-browser requests carry no Origin
+	w := corsRequest(r, http.MethodGet, "/v1/user", "", false)
+	if w.Code != http.StatusOK || len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Fatalf("request without Origin = %d with %v", w.Code, w.Header())
+	}
+}
+
+func TestCORSSubdomains(t *testing.T) {
+	r := newCORSRouter(testCORSConfig())
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.org", true},
+		{"https://a-b.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://.example.org", false},
+		{"http://app.example.org", false},
+		{"https://app.example.org:8443", false},
+		{"https://evil.com:1@x.example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"https://appexample.org", false},
+		{"https://app.example.org.evil.com", false},
+	}
+
+	for _, tt := range tests {
+		w := corsRequest(r, http.MethodGet, "/v1/user", tt.origin, false)
+		if got := w.Header().Get("Access-Control-Allow-Origin") == tt.origin; got != tt.allowed {
+			t.Errorf("origin %q allowed = %v, want %v", tt.origin, got, tt.allowed)
+		}
+	}
+}
+
+func TestCORSGroups(t *testing.T) {
+	r := newCORSRouter(testCORSConfig())
+
+	tests := []struct {
+		name        string
+		path        string
+		origin      string
+		allowOrigin string
+		credentials string
+		methods     string
+	}{
+		{"default policy", "/v1/user", "https://app.example.com", "https://app.example.com", "true", "GET, POST"},
+		{"any origin", "/v1/public/docs", "https://anyone.test", "*", "", "GET"},
+		{"any origin never sends credentials", "/v1/public/docs", "https://app.example.com", "*", "", "GET"},
+		{"longest prefix", "/v1/public/partner/orders", "https://partner.example.net", "https://partner.example.net", "true", "GET, DELETE"},
+		{"longest prefix refuses the shorter one's origins", "/v1/public/partner/orders", "https://anyone.test", "", "", ""},
+		{"prefix of a path segment", "/v1/publications", "https://anyone.test", "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := corsRequest(r, http.MethodOptions, tt.path, tt.origin, true)
+
+			got := []string{
+				w.Header().Get("Access-Control-Allow-Origin"),
+				w.Header().Get("Access-Control-Allow-Credentials"),
+				w.Header().Get("Access-Control-Allow-Methods"),
+			}
+			if want := []string{tt.allowOrigin, tt.credentials, tt.methods}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("origin, credentials, methods = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestCORSVary(t *testing.T) {
+	r := newCORSRouter(testCORSConfig())
+
+	tests := []struct {
+		name      string
+		method    string
+		origin    string
+		preflight bool
+		vary      []string
+	}{
+		{"allowed origin", http.MethodGet, "https://app.example.com", false, []string{"Origin"}},
+		{"other origin", http.MethodGet, "https://evil.com", false, []string{"Origin"}},
+		{"no origin", http.MethodGet, "", false, []string{"Origin"}},
+		{"any origin", http.MethodGet, "https://anyone.test", false, []string{"Origin"}},
+		{"preflight", http.MethodOptions, "https://app.example.com", true, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		{"refused preflight", http.MethodOptions, "https://evil.com", true, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/v1/user"
+			if tt.name == "any origin" {
+				path = "/v1/public/docs"
+			}
+
+			w := corsRequest(r, tt.method, path, tt.origin, tt.preflight)
+			if got := w.Header().Values("Vary"); !reflect.DeepEqual(got, tt.vary) {
+				t.Fatalf("Vary = %q, want %q", got, tt.vary)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/apikey"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/logger"
+	"app/pkg/oauth"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxAPIKeyNameLength  = 100
+	maxAPIKeyExpiresDays = 3650
+)
+
+var errInvalidAPIKey = errors.New("invalid api key")
+
+// @Security ApiKeyAuth
+// Create API Key godoc
+// @ID create_api_key
+// @Router /v1/user/me/api-keys [POST]
+// @Summary Create API Key
+// @Description Creates a personal API key for scripts, sent as "Authorization: ApiKey {key}". The key is shown only in this response. Scopes are user:read, user:write, phone:read, phone:write and admin; keys cannot manage the account's sessions, identities or keys, nor change or delete users. expires_in_days of 0 makes a key which never expires.
+// @Tags API Key
+// @Accept json
+// @Produce json
+// @Param api_key body models.CreateAPIKeyRequest true "CreateAPIKeyRequest"
+// @Success 201 {object} Response{data=models.CreateAPIKeyResponse} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	var createKey models.CreateAPIKeyRequest
+
+	err := bindJSON(c, &createKey)
+	if err != nil {
+		h.handlerResponse(c, "create api key", bindStatus(err), err.Error())
+		return
+	}
+
+	createKey.Name = strings.TrimSpace(createKey.Name)
+	switch {
+	case len(createKey.Name) <= 0 || len(createKey.Name) > maxAPIKeyNameLength:
+		h.handlerResponse(c, "create api key", http.StatusBadRequest, "name must be 1 to 100 characters")
+		return
+	case createKey.ExpiresInDays < 0 || createKey.ExpiresInDays > maxAPIKeyExpiresDays:
+		h.handlerResponse(c, "create api key", http.StatusBadRequest, "expires_in_days must be between 0 and 3650")
+		return
+	}
+
+	if err = apikey.ValidateScopes(createKey.Scopes); err != nil {
+		h.handlerResponse(c, "create api key", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	key, prefix, err := apikey.Generate()
+	if err != nil {
+		h.handlerResponse(c, "generate api key", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, err := h.storages.APIKey().Create(c.Request.Context(), &models.CreateAPIKey{
+		UserID:  userData.UserID,
+		Name:    createKey.Name,
+		Prefix:  prefix,
+		KeyHash: oauth.HashToken(key),
+		Scopes:  oauth.ParseScope(strings.Join(createKey.Scopes, " ")),
+		TTL:     time.Duration(createKey.ExpiresInDays) * 24 * time.Hour,
+	})
+	if err != nil {
+		h.handlerResponse(c, "storage.apiKey.create", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp, err := h.storages.APIKey().GetByID(c.Request.Context(), &models.APIKeyPrimaryKey{Id: id, UserID: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.apiKey.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionAPIKeyCreate,
+		TargetType: audit.TargetAPIKey,
+		TargetID:   id,
+		Changes:    audit.Diff(nil, resp),
+	})
+
+	h.handlerResponse(c, "create api key", http.StatusCreated, models.CreateAPIKeyResponse{APIKey: resp, Key: key})
+}
+
+// @Security ApiKeyAuth
+// Get List API Key godoc
+// @ID get_list_api_key
+// @Router /v1/user/me/api-keys [GET]
+// @Summary Get List API Key
+// @Description Lists the API keys of the current user which are not revoked, newest first, with when each was last used. Expired keys are listed until revoked.
+// @Tags API Key
+// @Produce json
+// @Success 200 {object} Response{data=models.GetListAPIKeyResponse} "Success Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) GetListAPIKey(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	resp, err := h.storages.APIKey().GetList(c.Request.Context(), &models.GetListAPIKeyRequest{UserID: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.apiKey.getList", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.handlerResponse(c, "get list api key", http.StatusOK, resp)
+}
+
+// @Security ApiKeyAuth
+// Revoke API Key godoc
+// @ID revoke_api_key
+// @Router /v1/user/me/api-keys/{id} [DELETE]
+// @Summary Revoke API Key
+// @Description Revokes an API key of the current user. It stops working at once.
+// @Tags API Key
+// @Produce json
+// @Param id path string true "api key id"
+// @Success 204 {object} Response{data=string} "Success Request"
+// @Response 404 {object} Response{data=string} "Not Found"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	id := c.Param("id")
+	if !helper.IsValidUUID(id) {
+		h.handlerResponse(c, "revoke api key", http.StatusNotFound, "api key not found")
+		return
+	}
+
+	rowsAffected, err := h.storages.APIKey().Revoke(c.Request.Context(), &models.APIKeyPrimaryKey{Id: id, UserID: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.apiKey.revoke", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rowsAffected <= 0 {
+		h.handlerResponse(c, "storage.apiKey.revoke", http.StatusNotFound, "api key not found")
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionAPIKeyRevoke,
+		TargetType: audit.TargetAPIKey,
+		TargetID:   id,
+	})
+
+	h.handlerResponse(c, "revoke api key", http.StatusNoContent, nil)
+}
+
+// verifyAPIKey looks up an API key by its prefix and checks it is active and
+// matches the stored hash. The last-used time is written at most once per
+// SESSION_TOUCH_INTERVAL.
+func (h *Handler) verifyAPIKey(c *gin.Context, key string) (helper.TokenInfo, error) {
+	prefix, ok := apikey.Prefix(key)
+	if !ok {
+		return helper.TokenInfo{}, errInvalidAPIKey
+	}
+
+	resp, err := h.storages.APIKey().GetByID(c.Request.Context(), &models.APIKeyPrimaryKey{Prefix: prefix})
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return helper.TokenInfo{}, errInvalidAPIKey
+		}
+		return helper.TokenInfo{}, err
+	}
+
+	if !oauth.CheckTokenHash(key, resp.KeyHash) || !resp.Active {
+		return helper.TokenInfo{}, errInvalidAPIKey
+	}
+
+	if h.touches.due(resp.Id, time.Now()) {
+		_, err = h.storages.APIKey().Touch(c.Request.Context(), &models.APIKeyPrimaryKey{Id: resp.Id})
+		if err != nil {
+			h.log(c).Error("touch api key", logger.Error(err))
+		}
+	}
+
+	return helper.TokenInfo{
+		UserID:   resp.UserID,
+		Scope:    oauth.FormatScope(resp.Scopes),
+		APIKeyID: resp.Id,
+	}, nil
+}
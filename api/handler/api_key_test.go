@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/apikey"
+	"app/pkg/helper"
+	"app/pkg/oauth"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// addAPIKey stores apiKey, giving it a prefix, a hash and an id unless it has
+// one, and returns the key.
+func (s *memStore) addAPIKey(t *testing.T, apiKey models.APIKey) string {
+	t.Helper()
+
+	key, prefix, err := apikey.Generate()
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(apiKey.Id) <= 0 {
+		apiKey.Id = uuid.NewString()
+	}
+	apiKey.Prefix, apiKey.KeyHash = prefix, oauth.HashToken(key)
+	s.apiKeys[apiKey.Id] = &apiKey
+
+	return key
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Login: "alice"})
+	key := store.addAPIKey(t, models.APIKey{UserID: user.Id, Scopes: []string{apikey.ScopeUserRead, apikey.ScopeUserWrite}, Active: true})
+	revoked := store.addAPIKey(t, models.APIKey{UserID: user.Id, Scopes: []string{apikey.ScopeUserRead}})
+
+	h := newTestHandler(t, testConfig(), store, nil)
+
+	// every route answers with the user it was called for
+	r := gin.New()
+	v1 := r.Group("/v1", h.AuthMiddleware())
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/user/:id"},
+		{http.MethodPost, "/user"},
+		{http.MethodPut, "/user/:id"},
+		{http.MethodDelete, "/user/:id"},
+		{http.MethodGet, "/user/phone/:id"},
+		{http.MethodGet, "/user/me/sessions"},
+		{http.MethodGet, "/admin/audit"},
+	} {
+		v1.Handle(route.method, route.path, func(c *gin.Context) {
+			c.String(http.StatusOK, c.MustGet("Auth").(helper.TokenInfo).UserID)
+		})
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		key    string
+		code   int
+	}{
+		{"read", http.MethodGet, "/v1/user/" + user.Id, key, http.StatusOK},
+		{"write", http.MethodPost, "/v1/user", key, http.StatusOK},
+		{"change a user", http.MethodPut, "/v1/user/" + user.Id, key, http.StatusForbidden},
+		{"delete a user", http.MethodDelete, "/v1/user/" + user.Id, key, http.StatusForbidden},
+		{"missing scope", http.MethodGet, "/v1/user/phone/" + user.Id, key, http.StatusForbidden},
+		{"account route", http.MethodGet, "/v1/user/me/sessions", key, http.StatusForbidden},
+		{"admin route", http.MethodGet, "/v1/admin/audit", key, http.StatusForbidden},
+		{"revoked key", http.MethodGet, "/v1/user/" + user.Id, revoked, http.StatusUnauthorized},
+		{"unknown key", http.MethodGet, "/v1/user/" + user.Id, key[:len(key)-1] + "x", http.StatusUnauthorized},
+		{"malformed key", http.MethodGet, "/v1/user/" + user.Id, "secret", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set("Authorization", apikey.Scheme+" "+tt.key)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.target, w.Code, w.Body, tt.code)
+			}
+			if w.Code == http.StatusOK && w.Body.String() != user.Id {
+				t.Fatalf("called for %q, want %q", w.Body, user.Id)
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	store := newMemStore()
+	alice := store.addUser(models.User{Login: "alice1"})
+	bob := store.addUser(models.User{Login: "bob123"})
+	aliceKey, bobKey := uuid.NewString(), uuid.NewString()
+	store.addAPIKey(t, models.APIKey{Id: aliceKey, UserID: alice.Id, Scopes: []string{apikey.ScopeUserRead}, Active: true})
+	store.addAPIKey(t, models.APIKey{Id: bobKey, UserID: bob.Id, Scopes: []string{apikey.ScopeUserRead}, Active: true})
+
+	h := newTestHandler(t, testConfig(), store, nil)
+	r := gin.New()
+	r.DELETE("/v1/user/me/api-keys/:id", func(c *gin.Context) {
+		c.Set("Auth", helper.TokenInfo{UserID: alice.Id})
+	}, h.RevokeAPIKey)
+	client := newTestClient(r)
+
+	tests := []struct {
+		name string
+		id   string
+		code int
+	}{
+		{"not a uuid", "1", http.StatusNotFound},
+		{"key of another user", bobKey, http.StatusNotFound},
+		{"own key", aliceKey, http.StatusNoContent},
+		{"already revoked", aliceKey, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		if w := client.do(t, http.MethodDelete, "/v1/user/me/api-keys/"+tt.id, nil); w.Code != tt.code {
+			t.Fatalf("%s: revoke = %d %s, want %d", tt.name, w.Code, w.Body, tt.code)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"app/api/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditLimit bounds the page size of GetListAudit, the table only grows.
+const maxAuditLimit = 100
+
+// @Security ApiKeyAuth
+// Get List Audit godoc
+// @ID get_list_audit
+// @Router /v1/admin/audit [GET]
+// @Summary Get List Audit Events
+// @Description Get List Audit Events, newest first. Pass next_cursor of the previous page as cursor to get the next one. Pages hold at most 100 events.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param action query string false "action"
+// @Param actor_id query string false "actor_id"
+// @Param target_type query string false "target_type"
+// @Param target_id query string false "target_id"
+// @Param from query string false "from (timestamp)"
+// @Param to query string false "to (timestamp)"
+// @Param cursor query string false "cursor"
+// @Param limit query string false "limit, 1 to 100"
+// @Success 200 {object} Response{data=models.GetListAuditResponse} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) GetListAudit(c *gin.Context) {
+
+	limit, err := h.getLimitQuery(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		h.handlerResponse(c, "get list audit", http.StatusBadRequest, "invalid limit")
+		return
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	var cursor int64
+	if len(c.Query("cursor")) > 0 {
+		cursor, err = strconv.ParseInt(c.Query("cursor"), 10, 64)
+		if err != nil {
+			h.handlerResponse(c, "get list audit", http.StatusBadRequest, "invalid cursor")
+			return
+		}
+	}
+
+	resp, err := h.storages.Audit().GetList(c.Request.Context(), &models.GetListAuditRequest{
+		Action:     c.Query("action"),
+		ActorID:    c.Query("actor_id"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		DateFrom:   c.Query("from"),
+		DateTo:     c.Query("to"),
+		Cursor:     cursor,
+		Limit:      limit,
+	})
+	if err != nil {
+		h.handlerResponse(c, "storage.audit.getlist", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.handlerResponse(c, "get list audit response", http.StatusOK, resp)
+}
@@ -2,15 +2,22 @@ package handler
 
 import (
 	"app/api/models"
+	"app/pkg/audit"
 	"app/pkg/helper"
-	"context"
-	"fmt"
+	"app/pkg/logger"
+	"app/pkg/metrics"
+	"errors"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	errUserNotFound      = errors.New("this user does not exist")
+	errIncorrectPassword = errors.New("Incorrect Password")
+)
+
 // Create User godoc
 // @ID register_user
 // @Router /register [POST]
@@ -27,24 +34,28 @@ func (h *Handler) RegisterUser(c *gin.Context) {
 
 	var createUser models.CreateUser
 
-	err := c.ShouldBindJSON(&createUser) // parse req body to given type struct
+	err := bindJSON(c, &createUser) // parse req body to given type struct
 	if err != nil {
-		h.handlerResponse(c, "create user", http.StatusBadRequest, err.Error())
+		h.handlerResponse(c, "create user", bindStatus(err), err.Error())
+		return
+	}
+	if !h.checkNewPassword(c, "register user", "", createUser.Login, createUser.Name, createUser.Password) {
 		return
 	}
-	if len(createUser.Login) < 6 || len(createUser.Password) < 6 {
-		h.handlerResponse(c, "register user", http.StatusBadRequest, "Login and Password length must be longer than 6")
+	if !h.checkEmail(c, "register user", createUser.Email, "") {
 		return
 	}
 
-	hash, _ := h.HashPassword(createUser.Password)
+	hash, err := h.HashPassword(createUser.Password)
+	if err != nil {
+		h.handlerResponse(c, "hash password", http.StatusInternalServerError, err.Error())
+		return
+	}
 	createUser.Password = hash
 
-	resp, err := h.storages.User().GetByID(context.Background(), &models.UserPrimaryKey{
+	resp, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{
 		Login: createUser.Login,
 	})
-	fmt.Println("Hello")
-	fmt.Println(resp)
 	if err == nil {
 		h.handlerResponse(c, "register user", http.StatusBadRequest, "user already exists")
 		return
@@ -56,18 +67,30 @@ func (h *Handler) RegisterUser(c *gin.Context) {
 		}
 	}
 
-	id, err := h.storages.User().Create(context.Background(), &createUser)
+	id, err := h.storages.User().Create(c.Request.Context(), &createUser)
 	if err != nil {
 		h.handlerResponse(c, "storage.user.register", http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	resp, err = h.storages.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: id})
+	resp, err = h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: id})
 	if err != nil {
 		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionRegister,
+		ActorID:    resp.Id,
+		TargetType: audit.TargetUser,
+		TargetID:   resp.Id,
+		Changes:    audit.Diff(nil, resp),
+	})
+
+	if len(resp.Email) > 0 {
+		_ = h.sendEmailVerification(c, resp)
+	}
+
 	c.JSON(http.StatusCreated, resp)
 }
 
@@ -87,54 +110,121 @@ func (h *Handler) LoginUser(c *gin.Context) {
 
 	var logPass models.Login
 
-	err := c.ShouldBindJSON(&logPass) // parse req body to given type struct
+	err := bindJSON(c, &logPass) // parse req body to given type struct
 	if err != nil {
+		h.handlerResponse(c, "login user", bindStatus(err), err.Error())
+		return
+	}
+
+	if err = helper.ValidLoginPassword(logPass.Login, logPass.Password); err != nil {
 		h.handlerResponse(c, "login user", http.StatusBadRequest, err.Error())
 		return
 	}
-	fmt.Printf("%+v", logPass)
-	fmt.Println(len(logPass.Login), len(logPass.Password))
 
-	if len(logPass.Login) < 6 || len(logPass.Password) < 6 {
-		fmt.Println("modmcso")
-		h.handlerResponse(c, "login user", http.StatusBadRequest, "Login and Password length must be longer than 6")
+	resp, err := h.authenticate(c, logPass.Login, logPass.Password)
+	if err != nil {
+		h.handlerResponse(c, "login user", http.StatusBadRequest, err.Error())
 		return
 	}
 
-	resp, err := h.storages.User().GetByID(context.Background(), &models.UserPrimaryKey{
-		Login: logPass.Login,
-	})
+	token, err := h.startSession(c, resp, logPass.DeviceName)
+	if err != nil {
+		h.handlerResponse(c, "start session", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.setCookie(c, "token", token, int(h.tokens.TTL().Seconds()), "/")
+	c.JSON(http.StatusCreated, nil)
+}
+
+// authenticate looks up the user by login name or email and checks the password,
+// recording failed attempts. The returned error is safe to show to the caller.
+func (h *Handler) authenticate(c *gin.Context, login, password string) (*models.User, error) {
+	// the login field takes either the login name or the email address
+	key := &models.UserPrimaryKey{Login: login}
+	if strings.Contains(login, "@") {
+		key = &models.UserPrimaryKey{Email: login}
+	}
+
+	resp, err := h.storages.User().GetByID(c.Request.Context(), key)
+	// login names created before "@" was refused there may look like emails
+	if err != nil && err.Error() == "no rows in result set" && len(key.Email) > 0 {
+		resp, err = h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Login: login})
+	}
 	if err != nil {
 		if err.Error() == "no rows in result set" {
-			h.handlerResponse(c, "login user", http.StatusBadRequest, "this user does not exist")
-			return
-		} else {
-			h.handlerResponse(c, "login user", http.StatusBadRequest, err.Error())
-			return
+			h.recordAudit(c, &models.CreateAuditEvent{
+				Action:     audit.ActionLoginFailed,
+				TargetType: audit.TargetLogin,
+				TargetID:   login,
+			})
+			h.metrics.ObserveLogin(metrics.LoginFailure)
+			return nil, errUserNotFound
 		}
+		return nil, err
+	}
 
+	needsRehash, err := h.VerifyPassword(password, resp.Password)
+	if err != nil {
+		h.recordAudit(c, &models.CreateAuditEvent{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetUser,
+			TargetID:   resp.Id,
+		})
+		h.metrics.ObserveLogin(metrics.LoginFailure)
+		return nil, errIncorrectPassword
 	}
 
-	if !h.CheckPasswordHash(logPass.Password, resp.Password) {
-		h.handlerResponse(c, "login user", http.StatusBadRequest, "Incorrect Password")
-		return
+	// the plaintext is only available here, so outdated hashes are upgraded on login
+	if needsRehash {
+		h.rehashPassword(c, resp.Id, password)
 	}
 
+	return resp, nil
+}
 
+// startSession opens a session for an authenticated user and returns its access token.
+func (h *Handler) startSession(c *gin.Context, user *models.User, deviceName string) (string, error) {
+	sessionID, err := h.storages.Session().Create(c.Request.Context(), &models.CreateSession{
+		UserID:     user.Id,
+		DeviceName: deviceName,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		TTL:        h.tokens.TTL(),
+	})
+	if err != nil {
+		return "", err
+	}
 
-	m := make(map[string]interface{})
+	token, err := h.tokens.Issue(helper.TokenInfo{UserID: user.Id, SessionID: sessionID})
+	if err != nil {
+		return "", err
+	}
 
-	m["user_id"] = resp.Id
+	h.metrics.ObserveLogin(metrics.LoginSuccess)
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionLogin,
+		ActorID:    user.Id,
+		TargetType: audit.TargetUser,
+		TargetID:   user.Id,
+	})
 
-	token, err := helper.GenerateJWT(m, time.Hour, "secret")
+	return token, nil
+}
 
+// rehashPassword stores a hash made with the current algorithm and parameters.
+// A failure is logged and does not fail the login.
+func (h *Handler) rehashPassword(c *gin.Context, userID, password string) {
+	hash, err := h.HashPassword(password)
 	if err != nil {
-		h.handlerResponse(c, "token response", http.StatusInternalServerError, err.Error())
+		h.log(c).Error("rehash password", logger.Error(err))
 		return
 	}
 
-	c.SetCookie("token",token,60*60*24, "/", "localhost", false, true)
-	c.JSON(http.StatusCreated, nil)
+	_, err = h.storages.User().UpdatePassword(c.Request.Context(), &models.UpdateUserPassword{Id: userID, Password: hash})
+	if err != nil {
+		h.log(c).Error("rehash password", logger.Error(err))
+	}
 }
 
 // LogOut godoc
@@ -155,13 +245,27 @@ func (h *Handler) LogOutUser( c *gin.Context){
 		return
 	}
 
-	info, err := helper.ParseClaims(value, h.cfg.AuthSecretKey)
+	info, err := h.tokens.Verify(value)
 
 	if err != nil {
 		c.AbortWithError(http.StatusForbidden, err)
 		return
 	}
-	fmt.Println(info)
+
+	if len(info.SessionID) > 0 {
+		_, err = h.storages.Session().Revoke(c.Request.Context(), &models.SessionPrimaryKey{Id: info.SessionID, UserID: info.UserID})
+		if err != nil {
+			h.handlerResponse(c, "storage.session.revoke", http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionLogout,
+		ActorID:    info.UserID,
+		TargetType: audit.TargetUser,
+		TargetID:   info.UserID,
+	})
 
 	h.DeleteCookieHandler(c)
 
@@ -170,6 +274,18 @@ func (h *Handler) LogOutUser( c *gin.Context){
 
 
 func (h *Handler) DeleteCookieHandler(c *gin.Context) {
-	c.SetCookie("token", "", -1, "/", "localhost", false, true)
+	h.setCookie(c, "token", "", -1, "/")
 	c.String(http.StatusOK, "User has been logout --> successfully")
-}
\ No newline at end of file
+}
+// JWKS godoc
+// @ID jwks
+// @Router /.well-known/jwks.json [GET]
+// @Summary JSON Web Key Set
+// @Description Public keys (current and previous) to verify access tokens with. Empty when tokens are signed with HS256.
+// @Tags Login
+// @Produce json
+// @Success 200 {object} helper.JWKS "Key Set"
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.tokens.JWKS())
+}
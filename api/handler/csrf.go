@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/apikey"
+	"app/pkg/helper"
+	"app/pkg/tokens"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// csrfHeader carries the token of CSRFToken on unsafe requests which
+// authenticate with the login cookie. Other sites can make the browser send
+// the cookie, but cannot read the token nor set the header.
+const csrfHeader = "X-CSRF-Token"
+
+// CSRF Token godoc
+// @ID csrf_token
+// @Router /csrf-token [GET]
+// @Summary Get CSRF Token
+// @Description Returns the token to send in the X-CSRF-Token header of POST, PUT, PATCH and DELETE requests authenticated with the login cookie. It is bound to the login session and valid as long as it. Requests with an Authorization header or a service principal's client certificate do not need it.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} models.CSRFToken "CSRF Token"
+// @Response 401 {object} Response{data=string} "Unauthorized"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) CSRFToken(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+
+	token, err := h.links.SignState(tokens.PurposeCSRF, map[string]string{"session": csrfBinding(val.(helper.TokenInfo))}, h.tokens.TTL())
+	if err != nil {
+		h.handlerResponse(c, "csrf token", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, models.CSRFToken{Token: token, Header: csrfHeader})
+}
+
+// CSRFMiddleware refuses unsafe requests authenticated with the login cookie
+// which lack the X-CSRF-Token header of its session. It runs after
+// AuthMiddleware, or on its own in front of handlers which read the cookie
+// themselves. Requests authenticated with a Bearer token, an API key or the
+// client certificate of a service principal pass, as they come from programs
+// holding their own credentials rather than from a browser session.
+func (h *Handler) CSRFMiddleware() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader("Authorization")
+		if strings.HasPrefix(header, "Bearer ") || strings.HasPrefix(header, apikey.Scheme+" ") {
+			c.Next()
+			return
+		}
+
+		var info helper.TokenInfo
+		if val, exists := c.Get("Auth"); exists {
+			info = val.(helper.TokenInfo)
+			if len(info.Principal) > 0 {
+				c.Next()
+				return
+			}
+		} else {
+			value, err := c.Cookie("token")
+			if err != nil {
+				c.Next()
+				return
+			}
+			// an invalid cookie authenticates nothing, the handler refuses it
+			info, err = h.tokens.Verify(value)
+			if err != nil {
+				c.Next()
+				return
+			}
+		}
+
+		state, err := h.links.VerifyState(tokens.PurposeCSRF, c.GetHeader(csrfHeader))
+		if err != nil || state["session"] != csrfBinding(info) {
+			h.handlerResponse(c, "csrf middleware", http.StatusForbidden, "missing or invalid "+csrfHeader+" header, get one from /csrf-token")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// csrfBinding names what a CSRF token is bound to: the login session, or
+// the token itself when it has none.
+func csrfBinding(info helper.TokenInfo) string {
+	if len(info.SessionID) > 0 {
+		return "sid:" + info.SessionID
+	}
+
+	return "jti:" + info.ID
+}
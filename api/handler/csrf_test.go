@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/apikey"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	st := newSessionTest(t)
+	user := st.store.addUser(models.User{Login: "alice1"})
+	_, cookie := st.login(t, user.Id, time.Hour)
+	_, otherCookie := st.login(t, user.Id, time.Hour)
+	key := st.store.addAPIKey(t, models.APIKey{UserID: user.Id, Scopes: []string{apikey.ScopeUserWrite}, Active: true})
+
+	r := gin.New()
+	r.GET("/csrf-token", st.h.AuthMiddleware(), st.h.CSRFToken)
+	v1 := r.Group("/v1", st.h.AuthMiddleware(), st.h.CSRFMiddleware())
+	v1.GET("/user/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	v1.POST("/user", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// csrfToken returns the CSRF token of the session of cookie.
+	csrfToken := func(cookie string) string {
+		t.Helper()
+
+		req := httptest.NewRequest(http.MethodGet, "/csrf-token", nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: cookie})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("csrf token = %d %s", w.Code, w.Body)
+		}
+
+		var resp models.CSRFToken
+		decode(t, w, &resp)
+		return resp.Token
+	}
+	token := csrfToken(cookie)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		cookie string
+		auth   string
+		csrf   string
+		code   int
+	}{
+		{"cookie with the token", http.MethodPost, "/v1/user", cookie, "", token, http.StatusOK},
+		{"cookie without the token", http.MethodPost, "/v1/user", cookie, "", "", http.StatusForbidden},
+		{"cookie with a malformed token", http.MethodPost, "/v1/user", cookie, "", "token", http.StatusForbidden},
+		{"cookie with the token of another session", http.MethodPost, "/v1/user", cookie, "", csrfToken(otherCookie), http.StatusForbidden},
+		{"cookie on GET", http.MethodGet, "/v1/user/" + user.Id, cookie, "", "", http.StatusOK},
+		{"bearer token", http.MethodPost, "/v1/user", "", "Bearer " + cookie, "", http.StatusOK},
+		{"api key", http.MethodPost, "/v1/user", "", apikey.Scheme + " " + key, "", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if len(tt.cookie) > 0 {
+				req.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+			}
+			if len(tt.auth) > 0 {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			if len(tt.csrf) > 0 {
+				req.Header.Set(csrfHeader, tt.csrf)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.target, w.Code, w.Body, tt.code)
+			}
+		})
+	}
+}
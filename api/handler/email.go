@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/logger"
+	"app/pkg/notify"
+	"app/pkg/tokens"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Verify Email godoc
+// @ID verify_email
+// @Router /verify-email [GET]
+// @Summary Verify Email
+// @Description Target of the link sent to a new or changed email address. The link expires after EMAIL_VERIFY_TTL and stops working once the address changes again.
+// @Tags Email
+// @Produce json
+// @Param token query string true "token from the link"
+// @Success 200 {object} Response{data=string} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) VerifyEmail(c *gin.Context) {
+
+	userID, email, err := h.links.Verify(tokens.PurposeVerifyEmail, c.Query("token"))
+	if err != nil {
+		h.handlerResponse(c, "verify email", http.StatusBadRequest, "the link is invalid or expired")
+		return
+	}
+
+	rowsAffected, err := h.storages.User().VerifyEmail(c.Request.Context(), &models.VerifyUserEmail{Id: userID, Email: email})
+	if err != nil {
+		h.handlerResponse(c, "storage.user.verifyEmail", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rowsAffected <= 0 {
+		h.handlerResponse(c, "verify email", http.StatusBadRequest, "the link is no longer valid")
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionEmailVerify,
+		ActorID:    userID,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+	})
+
+	h.handlerResponse(c, "verify email", http.StatusOK, "email verified")
+}
+
+// @Security ApiKeyAuth
+// Resend Email Verification godoc
+// @ID resend_email_verification
+// @Router /v1/user/me/email/verification [POST]
+// @Summary Resend Email Verification
+// @Description Sends a new verification link to the current user's unverified email address.
+// @Tags Email
+// @Produce json
+// @Success 202 {object} Response{data=string} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) ResendEmailVerification(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch {
+	case len(user.Email) <= 0:
+		h.handlerResponse(c, "resend email verification", http.StatusBadRequest, "no email address to verify")
+		return
+	case user.EmailVerified:
+		h.handlerResponse(c, "resend email verification", http.StatusBadRequest, "email already verified")
+		return
+	}
+
+	if err = h.sendEmailVerification(c, user); err != nil {
+		h.handlerResponse(c, "send email verification", http.StatusInternalServerError, "could not send the email")
+		return
+	}
+
+	h.handlerResponse(c, "resend email verification", http.StatusAccepted, "verification email sent")
+}
+
+// checkEmail validates an optional email address and makes sure no other
+// user has it. It writes the 400 response and returns false when rejected.
+func (h *Handler) checkEmail(c *gin.Context, path, email, userID string) bool {
+	if len(email) <= 0 {
+		return true
+	}
+
+	if !helper.IsValidEmail(email) {
+		h.handlerResponse(c, path, http.StatusBadRequest, "invalid email")
+		return false
+	}
+
+	owner, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Email: email})
+	switch {
+	case err == nil && owner.Id != userID:
+		h.handlerResponse(c, path, http.StatusBadRequest, "email already in use")
+		return false
+	case err != nil && err.Error() != "no rows in result set":
+		h.handlerResponse(c, "storage.user.getByEmail", http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	return true
+}
+
+// sendEmailVerification mails user a signed link to VerifyEmail. Failures are
+// logged; the user can ask for a new link.
+func (h *Handler) sendEmailVerification(c *gin.Context, user *models.User) error {
+	token, err := h.links.Sign(tokens.PurposeVerifyEmail, user.Id, user.Email, h.cfg.EmailVerifyTTL)
+	if err != nil {
+		h.log(c).Error("sign email verification link", logger.Error(err))
+		return err
+	}
+
+	link := h.cfg.PublicURL + "/verify-email?token=" + url.QueryEscape(token)
+
+	err = h.emails.SendEmail(c.Request.Context(), &notify.Email{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nConfirm your email address by opening this link within %s:\n\n%s\n\nIf you did not sign up, ignore this email.\n",
+			user.Name, h.cfg.EmailVerifyTTL, link),
+	})
+	if err != nil {
+		h.log(c).Error("send email verification", logger.String("user_id", user.Id), logger.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// emailChanged reports whether after has a new address to verify.
+func emailChanged(before, after *models.User) bool {
+	return len(after.Email) > 0 && !after.EmailVerified && !strings.EqualFold(before.Email, after.Email)
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/notify"
+	"app/pkg/notify/smtptest"
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var verifyLink = regexp.MustCompile(`http://app\.test(/verify-email\?token=\S+)`)
+
+// newEmailTest returns a router with the email verification routes, signed
+// in as user, which mails through a fake SMTP server.
+func newEmailTest(t *testing.T, store *memStore, user *models.User) (*smtptest.Server, *gin.Engine) {
+	t.Helper()
+
+	srv := smtptest.NewServer()
+	t.Cleanup(srv.Close)
+
+	cfg := testConfig()
+	cfg.EmailFrom = "App <no-reply@app.test>"
+	cfg.EmailSMTPHost = srv.Host
+	cfg.EmailSMTPPort = srv.Port
+	cfg.EmailSMTPTimeout = cfg.AuthTokenTTL
+	h := newTestHandler(t, cfg, store, notify.NewSMTPSender(cfg))
+
+	r := gin.New()
+	r.GET("/verify-email", h.VerifyEmail)
+	r.POST("/v1/user/me/email/verification", func(c *gin.Context) {
+		c.Set("Auth", helper.TokenInfo{UserID: user.Id})
+	}, h.ResendEmailVerification)
+
+	return srv, r
+}
+
+// sentLink returns the verification link of the last message srv accepted.
+func sentLink(t *testing.T, srv *smtptest.Server) string {
+	t.Helper()
+
+	messages := srv.Messages()
+	if len(messages) <= 0 {
+		t.Fatal("no email sent")
+	}
+
+	match := verifyLink.FindSubmatch(messages[len(messages)-1].Data)
+	if match == nil {
+		t.Fatalf("no verification link in %q", messages[len(messages)-1].Data)
+	}
+
+	return string(match[1])
+}
+
+func TestEmailVerification(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1", Email: "alice@example.com"})
+	srv, r := newEmailTest(t, store, user)
+
+	client := newTestClient(r)
+	if w := client.do(t, http.MethodPost, "/v1/user/me/email/verification", nil); w.Code != http.StatusAccepted {
+		t.Fatalf("resend = %d %s", w.Code, w.Body)
+	}
+	if to := srv.Messages()[0].To; len(to) != 1 || to[0] != "alice@example.com" {
+		t.Fatalf("email sent to %v, want [alice@example.com]", to)
+	}
+
+	link := sentLink(t, srv)
+	if w := client.do(t, http.MethodGet, link, nil); w.Code != http.StatusOK {
+		t.Fatalf("verify = %d %s", w.Code, w.Body)
+	}
+
+	verified, _ := store.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: user.Id})
+	if !verified.EmailVerified {
+		t.Fatal("the email is not verified")
+	}
+	if actions := store.auditActions(); len(actions) != 1 || actions[0] != audit.ActionEmailVerify {
+		t.Fatalf("audit actions = %v, want only %s", actions, audit.ActionEmailVerify)
+	}
+
+	// nothing is left to verify
+	if w := client.do(t, http.MethodPost, "/v1/user/me/email/verification", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("resend after verifying = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+	if len(srv.Messages()) != 1 {
+		t.Fatalf("%d emails sent, want 1", len(srv.Messages()))
+	}
+}
+
+func TestEmailVerificationWithoutEmail(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1"})
+	srv, r := newEmailTest(t, store, user)
+
+	if w := newTestClient(r).do(t, http.MethodPost, "/v1/user/me/email/verification", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("resend = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+	if len(srv.Messages()) > 0 {
+		t.Fatal("an email was sent")
+	}
+}
+
+func TestEmailVerificationInvalidLink(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(store *memStore, user *models.User, link string) string
+	}{
+		{
+			name: "address changed since",
+			modify: func(store *memStore, user *models.User, link string) string {
+				store.mu.Lock()
+				store.users[user.Id].Email = "alice@example.org"
+				store.mu.Unlock()
+				return link
+			},
+		},
+		{
+			name: "tampered token",
+			modify: func(store *memStore, user *models.User, link string) string {
+				return link[:len(link)-2]
+			},
+		},
+		{
+			name: "no token",
+			modify: func(store *memStore, user *models.User, link string) string {
+				return "/verify-email"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemStore()
+			user := store.addUser(models.User{Name: "Alice", Login: "alice1", Email: "alice@example.com"})
+			srv, r := newEmailTest(t, store, user)
+
+			client := newTestClient(r)
+			if w := client.do(t, http.MethodPost, "/v1/user/me/email/verification", nil); w.Code != http.StatusAccepted {
+				t.Fatalf("resend = %d %s", w.Code, w.Body)
+			}
+
+			link := tt.modify(store, user, sentLink(t, srv))
+			if w := client.do(t, http.MethodGet, link, nil); w.Code != http.StatusBadRequest {
+				t.Fatalf("verify = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+			}
+
+			verified, _ := store.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: user.Id})
+			if verified.EmailVerified {
+				t.Fatal("the email was verified")
+			}
+		})
+	}
+}
+
+func TestEmailVerificationSendFailure(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1", Email: "alice@example.com"})
+	srv, r := newEmailTest(t, store, user)
+	srv.Close()
+
+	if w := newTestClient(r).do(t, http.MethodPost, "/v1/user/me/email/verification", nil); w.Code != http.StatusInternalServerError {
+		t.Fatalf("resend without a mail server = %d %s, want %d", w.Code, w.Body, http.StatusInternalServerError)
+	}
+}
@@ -1,19 +1,48 @@
 package handler
 
 import (
+	"app/api/models"
 	"app/config"
+	"app/pkg/audit"
+	"app/pkg/health"
+	"app/pkg/helper"
 	"app/pkg/logger"
+	"app/pkg/metrics"
+	"app/pkg/notify"
+	"app/pkg/oidc"
+	"app/pkg/otp"
+	"app/pkg/password"
+	"app/pkg/tokens"
+	"app/pkg/webauthn"
 	"app/storage"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type Handler struct {
-	cfg      *config.Config
-	logger   logger.LoggerI
-	storages storage.StorageI
+	cfg       *config.Config
+	logger    logger.LoggerI
+	storages  storage.StorageI
+	recorder  audit.Recorder
+	metrics   *metrics.Metrics
+	health    *health.Registry
+	tokens    helper.TokenIssuer
+	passwords *password.Hasher
+	policy    *password.Policy
+	links     *tokens.LinkSigner
+	emails    notify.EmailSender
+	sms       notify.SMSSender
+	codes     *otp.Codes
+	touches   *sessionTouches
+	providers map[string]*oidc.Provider
+	passkeys  *webauthn.RelyingParty
 }
 
 type Response struct {
@@ -22,11 +51,24 @@ type Response struct {
 	Data        interface{}
 }
 
-func NewHandler(cfg *config.Config, store storage.StorageI, logger logger.LoggerI) *Handler {
+func NewHandler(cfg *config.Config, store storage.StorageI, logger logger.LoggerI, metrics *metrics.Metrics, health *health.Registry, issuer helper.TokenIssuer, policy *password.Policy, emails notify.EmailSender, sms notify.SMSSender) *Handler {
 	return &Handler{
-		cfg:      cfg,
-		logger:   logger,
-		storages: store,
+		cfg:       cfg,
+		logger:    logger,
+		storages:  store,
+		recorder:  audit.NewRecorder(store.Audit(), logger),
+		metrics:   metrics,
+		health:    health,
+		tokens:    issuer,
+		passwords: password.NewHasher(cfg),
+		policy:    policy,
+		links:     tokens.NewLinkSigner(cfg),
+		emails:    emails,
+		sms:       sms,
+		codes:     otp.NewCodes(cfg),
+		touches:   newSessionTouches(cfg.SessionTouchInterval),
+		providers: oidc.NewProviders(cfg),
+		passkeys:  webauthn.New(cfg),
 	}
 }
 
@@ -39,14 +81,119 @@ func (h *Handler) handlerResponse(c *gin.Context, path string, code int, message
 
 	switch {
 	case code < 300:
-		h.logger.Info(path, logger.Any("info", response.Description))
+		h.log(c).Info(path, logger.Any("info", response.Description))
 	case code >= 400:
-		h.logger.Error(path, logger.Any("info", response))
+		h.log(c).Error(path, logger.Any("info", response))
 	}
 
 	c.JSON(code, response)
 }
 
+// log returns the request scoped logger set by RequestIDMiddleware.
+func (h *Handler) log(c *gin.Context) logger.LoggerI {
+	return logger.FromContext(c.Request.Context(), h.logger)
+}
+
+// recordAudit fills the request metadata of event and appends it to the audit log.
+// The actor defaults to the authenticated user.
+func (h *Handler) recordAudit(c *gin.Context, event *models.CreateAuditEvent) {
+	if len(event.ActorID) <= 0 {
+		if val, exists := c.Get("Auth"); exists {
+			event.ActorID = val.(helper.TokenInfo).UserID
+		}
+	}
+
+	event.IP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	event.RequestID = c.GetString("RequestID")
+
+	h.recorder.Record(c.Request.Context(), event)
+}
+
+// setCookie sets an HttpOnly cookie with the COOKIE_* attributes. A maxAge
+// below 0 deletes it.
+func (h *Handler) setCookie(c *gin.Context, name, value string, maxAge int, path string) {
+	c.SetSameSite(h.cookieSameSite())
+	c.SetCookie(name, value, maxAge, path, h.cfg.CookieDomain, h.cfg.CookieSecure, true)
+}
+
+// setRedirectCookie is setCookie for a cookie read when another site
+// redirects back to us, which a SameSite=Strict cookie would miss, so Strict
+// is relaxed to Lax.
+func (h *Handler) setRedirectCookie(c *gin.Context, name, value string, maxAge int, path string) {
+	sameSite := h.cookieSameSite()
+	if sameSite == http.SameSiteStrictMode {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	c.SetSameSite(sameSite)
+	c.SetCookie(name, value, maxAge, path, h.cfg.CookieDomain, h.cfg.CookieSecure, true)
+}
+
+func (h *Handler) cookieSameSite() http.SameSite {
+	switch h.cfg.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+
+	return http.SameSiteLaxMode
+}
+
+var (
+	errUnsupportedMediaType = errors.New("request body must be sent as application/json")
+	errBodyTooLarge         = errors.New("request body is too large")
+)
+
+// bindJSON is a strict c.ShouldBindJSON: the body must be sent as
+// application/json and hold a single JSON value without fields obj lacks.
+// The status to answer its errors with is bindStatus.
+func bindJSON(c *gin.Context, obj interface{}) error {
+	if c.ContentType() != binding.MIMEJSON {
+		return errUnsupportedMediaType
+	}
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(obj)
+	if err == nil {
+		if _, err = decoder.Token(); err == io.EOF {
+			err = nil
+		} else if err == nil {
+			err = errors.New("request body must hold a single JSON value")
+		}
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return errBodyTooLarge
+	case err == io.EOF:
+		return errors.New("request body is empty")
+	case err != nil:
+		return err
+	}
+
+	if binding.Validator == nil {
+		return nil
+	}
+	return binding.Validator.ValidateStruct(obj)
+}
+
+// bindStatus is the status of an error of bindJSON.
+func bindStatus(err error) int {
+	switch {
+	case errors.Is(err, errUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+
+	return http.StatusBadRequest
+}
+
 func (h *Handler) getOffsetQuery(offset string) (int, error) {
 	if len(offset) <= 0 {
 		return h.cfg.DefaultOffset, nil
@@ -64,12 +211,41 @@ func (h *Handler) getLimitQuery(limit string) (int, error) {
 	return strconv.Atoi(limit)
 }
 
+// checkNewPassword validates login and a new password against the policy.
+// currentLogin is the login the user has now, empty for a new user; the login
+// rules apply only to a login that changes, so users whose login predates them
+// can still be updated.
+// It writes the 400 response, listing every broken rule, and returns false when either is rejected.
+func (h *Handler) checkNewPassword(c *gin.Context, path, currentLogin, login, name, newPassword string) bool {
+	if login != currentLogin {
+		if err := helper.ValidLogin(login); err != nil {
+			h.handlerResponse(c, path, http.StatusBadRequest, err.Error())
+			return false
+		}
+	}
+
+	if violations := h.policy.Check(newPassword, login, name); len(violations) > 0 {
+		h.handlerResponse(c, path, http.StatusBadRequest, violations)
+		return false
+	}
+
+	return true
+}
+
 func (h *Handler) HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	defer func(start time.Time) {
+		h.metrics.ObservePasswordHash(time.Since(start))
+	}(time.Now())
+
+	return h.passwords.Hash(password)
 }
 
-func (h *Handler) CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// VerifyPassword checks password against the stored hash. needsRehash reports
+// that the hash is outdated and a fresh HashPassword should be stored.
+func (h *Handler) VerifyPassword(password, hash string) (needsRehash bool, err error) {
+	defer func(start time.Time) {
+		h.metrics.ObservePasswordHash(time.Since(start))
+	}(time.Now())
+
+	return h.passwords.Verify(password, hash)
 }
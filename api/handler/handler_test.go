@@ -0,0 +1,789 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/config"
+	"app/pkg/helper"
+	"app/pkg/logger"
+	"app/pkg/metrics"
+	"app/pkg/notify"
+	"app/pkg/tokens"
+	"app/storage"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testConfig returns the settings the handler tests run with.
+func testConfig() *config.Config {
+	return &config.Config{
+		PublicURL:                "http://app.test",
+		DefaultLimit:             10,
+		MaxBodyBytes:             1 << 20,
+		AuthSigningAlg:           tokens.AlgHS256,
+		AuthSecretKey:            "test-secret",
+		AuthSecretKeyID:          "test",
+		AuthIssuer:               "app",
+		AuthAudience:             "app",
+		AuthTokenTTL:             time.Hour,
+		LinkSecretKey:            "test-link-secret",
+		EmailVerifyTTL:           time.Hour,
+		CookieSameSite:           "lax",
+		WebAuthnRPID:             "app.test",
+		WebAuthnRPName:           "App",
+		WebAuthnOrigins:          []string{"http://app.test"},
+		WebAuthnTimeout:          5 * time.Minute,
+		WebAuthnUserVerification: "preferred",
+	}
+}
+
+// newTestHandler returns a Handler on store which signs tokens with the
+// settings of cfg.
+func newTestHandler(t *testing.T, cfg *config.Config, store *memStore, emails notify.EmailSender) *Handler {
+	t.Helper()
+
+	issuer, err := tokens.NewIssuer(cfg)
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+
+	return NewHandler(cfg, store, logger.NewLogger("test", logger.LevelFatal), metrics.New(prometheus.NewRegistry()), nil, issuer, nil, emails, nil)
+}
+
+// testClient sends requests to a handler and keeps the cookies it sets, as
+// a browser would.
+type testClient struct {
+	handler http.Handler
+	cookies map[string]string
+}
+
+func newTestClient(handler http.Handler) *testClient {
+	return &testClient{handler: handler, cookies: map[string]string{}}
+}
+
+// do sends a request with a JSON body, unless body is nil, and the cookies.
+func (tc *testClient) do(t *testing.T, method, target string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return tc.send(req)
+}
+
+// send sends req with the cookies and keeps the cookies of the response.
+func (tc *testClient) send(req *http.Request) *httptest.ResponseRecorder {
+	for name, value := range tc.cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+
+	w := httptest.NewRecorder()
+	tc.handler.ServeHTTP(w, req)
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(tc.cookies, cookie.Name)
+		} else {
+			tc.cookies[cookie.Name] = cookie.Value
+		}
+	}
+
+	return w
+}
+
+// decode unmarshals the body of w into v.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+}
+
+// memStore is an in-memory storage.StorageI with the repositories the
+// handler tests use. Calling any other method panics.
+type memStore struct {
+	storage.StorageI
+
+	mu          sync.Mutex
+	users       map[string]*models.User
+	sessions    map[string]*models.Session
+	touches     map[string]int
+	identities  map[string]*models.UserIdentity
+	credentials map[string]*models.WebAuthnCredential
+	challenges  map[string]bool
+	apiKeys     map[string]*models.APIKey
+	phones      map[string]*models.Phone
+	otpCodes    []*memOTPCode
+	clients     map[string]*models.OAuthClient
+	codes       map[string]*memOAuthCode
+	refresh     map[string]*memRefreshToken
+	audits      []models.CreateAuditEvent
+
+	// now is the time of the stored rows which expire, time.Now when zero
+	now time.Time
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		users:       map[string]*models.User{},
+		sessions:    map[string]*models.Session{},
+		touches:     map[string]int{},
+		identities:  map[string]*models.UserIdentity{},
+		credentials: map[string]*models.WebAuthnCredential{},
+		challenges:  map[string]bool{},
+		apiKeys:     map[string]*models.APIKey{},
+		phones:      map[string]*models.Phone{},
+		clients:     map[string]*models.OAuthClient{},
+		codes:       map[string]*memOAuthCode{},
+		refresh:     map[string]*memRefreshToken{},
+	}
+}
+
+// clock returns the current time of the store. Call it with mu held.
+func (s *memStore) clock() time.Time {
+	if s.now.IsZero() {
+		return time.Now()
+	}
+	return s.now
+}
+
+// advance moves the clock of the store on by d.
+func (s *memStore) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.now = s.clock().Add(d)
+}
+
+// addUser stores user, giving it an id, and returns it.
+func (s *memStore) addUser(user models.User) *models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(user.Id) <= 0 {
+		user.Id = uuid.NewString()
+	}
+	if len(user.Role) <= 0 {
+		user.Role = models.RoleUser
+	}
+	s.users[user.Id] = &user
+
+	return &user
+}
+
+// uuidColumn fails for an id which is not a UUID, as postgres does when it is
+// compared with a uuid column.
+func uuidColumn(id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("invalid input syntax for type uuid: %q", id)
+	}
+	return nil
+}
+
+// auditActions returns the actions recorded so far.
+func (s *memStore) auditActions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var actions []string
+	for _, event := range s.audits {
+		actions = append(actions, event.Action)
+	}
+
+	return actions
+}
+
+func (s *memStore) User() storage.UserRepoI         { return memUserRepo{s: s} }
+func (s *memStore) Session() storage.SessionRepoI   { return memSessionRepo{s: s} }
+func (s *memStore) Identity() storage.IdentityRepoI { return memIdentityRepo{s: s} }
+func (s *memStore) WebAuthn() storage.WebAuthnRepoI { return memWebAuthnRepo{s: s} }
+func (s *memStore) Phone() storage.PhoneRepoI       { return memPhoneRepo{s: s} }
+func (s *memStore) OAuth() storage.OAuthRepoI       { return memOAuthRepo{s: s} }
+func (s *memStore) APIKey() storage.APIKeyRepoI     { return memAPIKeyRepo{s: s} }
+func (s *memStore) OTP() storage.OTPRepoI           { return memOTPRepo{s: s} }
+func (s *memStore) Audit() storage.AuditRepoI       { return memAuditRepo{s: s} }
+
+type memUserRepo struct {
+	storage.UserRepoI
+	s *memStore
+}
+
+func (r memUserRepo) Create(ctx context.Context, req *models.CreateUser) (string, error) {
+	user := r.s.addUser(models.User{Name: req.Name, Login: req.Login, Email: req.Email, Password: req.Password, Age: req.Age})
+	return user.Id, nil
+}
+
+func (r memUserRepo) GetByID(ctx context.Context, req *models.UserPrimaryKey) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if (len(req.Login) > 0 && user.Login == req.Login) ||
+			(len(req.Email) > 0 && strings.EqualFold(user.Email, req.Email)) ||
+			(len(req.Login) <= 0 && len(req.Email) <= 0 && user.Id == req.Id) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+func (r memUserRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[req.Id]
+	if !ok {
+		return 0, nil
+	}
+	user.Name, user.Login, user.Password, user.Age = req.Name, req.Login, req.Password, req.Age
+	if !strings.EqualFold(user.Email, req.Email) {
+		user.Email, user.EmailVerified = req.Email, false
+	}
+
+	return 1, nil
+}
+
+func (r memUserRepo) VerifyEmail(ctx context.Context, req *models.VerifyUserEmail) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[req.Id]
+	if !ok || !strings.EqualFold(user.Email, req.Email) {
+		return 0, nil
+	}
+	user.EmailVerified = true
+
+	return 1, nil
+}
+
+type memSessionRepo struct {
+	storage.SessionRepoI
+	s *memStore
+}
+
+func (r memSessionRepo) Create(ctx context.Context, req *models.CreateSession) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	id := uuid.NewString()
+	r.s.sessions[id] = &models.Session{
+		Id:         id,
+		UserID:     req.UserID,
+		DeviceName: req.DeviceName,
+		UserAgent:  req.UserAgent,
+		IP:         req.IP,
+		ExpiresAt:  r.s.clock().Add(req.TTL).Format(time.RFC3339Nano),
+	}
+
+	return id, nil
+}
+
+func (r memSessionRepo) GetByID(ctx context.Context, req *models.SessionPrimaryKey) (*models.Session, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.sessions[req.Id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	copied := *session
+
+	// as the query does, an expired session reads as revoked
+	if expiresAt, err := time.Parse(time.RFC3339Nano, session.ExpiresAt); err == nil && !r.s.clock().Before(expiresAt) {
+		copied.Revoked = true
+	}
+
+	return &copied, nil
+}
+
+func (r memSessionRepo) Touch(ctx context.Context, req *models.TouchSession) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.touches[req.Id]++
+
+	return 1, nil
+}
+
+func (r memSessionRepo) Revoke(ctx context.Context, req *models.SessionPrimaryKey) (int64, error) {
+	if err := uuidColumn(req.Id); err != nil {
+		return 0, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	session, ok := r.s.sessions[req.Id]
+	if !ok || session.UserID != req.UserID || session.Revoked {
+		return 0, nil
+	}
+	session.Revoked = true
+
+	return 1, nil
+}
+
+type memIdentityRepo struct {
+	storage.IdentityRepoI
+	s *memStore
+}
+
+func (r memIdentityRepo) Create(ctx context.Context, req *models.CreateUserIdentity) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, identity := range r.s.identities {
+		if identity.Provider == req.Provider && identity.Subject == req.Subject {
+			return "", errors.New(`duplicate key value violates unique constraint "user_identities_provider_subject_key"`)
+		}
+	}
+
+	id := uuid.NewString()
+	r.s.identities[id] = &models.UserIdentity{Id: id, UserID: req.UserID, Provider: req.Provider, Subject: req.Subject, Email: req.Email}
+
+	return id, nil
+}
+
+func (r memIdentityRepo) GetByID(ctx context.Context, req *models.UserIdentityPrimaryKey) (*models.UserIdentity, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, identity := range r.s.identities {
+		if (len(req.Id) > 0 && identity.Id == req.Id && (len(req.UserID) <= 0 || identity.UserID == req.UserID)) ||
+			(len(req.Id) <= 0 && identity.Provider == req.Provider && identity.Subject == req.Subject) {
+			copied := *identity
+			return &copied, nil
+		}
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+func (r memIdentityRepo) Touch(ctx context.Context, req *models.TouchUserIdentity) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	identity, ok := r.s.identities[req.Id]
+	if !ok {
+		return 0, nil
+	}
+	identity.Email = req.Email
+
+	return 1, nil
+}
+
+type memWebAuthnRepo struct {
+	storage.WebAuthnRepoI
+	s *memStore
+}
+
+func (r memWebAuthnRepo) Create(ctx context.Context, req *models.CreateWebAuthnCredential) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	id := uuid.NewString()
+	r.s.credentials[id] = &models.WebAuthnCredential{
+		Id:             id,
+		UserID:         req.UserID,
+		Name:           req.Name,
+		CredentialID:   req.CredentialID,
+		PublicKey:      req.PublicKey,
+		SignCount:      req.SignCount,
+		AAGUID:         req.AAGUID,
+		Transports:     req.Transports,
+		BackupEligible: req.BackupEligible,
+		BackedUp:       req.BackedUp,
+	}
+
+	return id, nil
+}
+
+func (r memWebAuthnRepo) GetByID(ctx context.Context, req *models.WebAuthnCredentialPrimaryKey) (*models.WebAuthnCredential, error) {
+	if len(req.Id) > 0 {
+		if err := uuidColumn(req.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, credential := range r.s.credentials {
+		if (len(req.Id) > 0 && credential.Id == req.Id && credential.UserID == req.UserID) ||
+			(len(req.Id) <= 0 && bytes.Equal(credential.CredentialID, req.CredentialID)) {
+			copied := *credential
+			return &copied, nil
+		}
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+func (r memWebAuthnRepo) GetList(ctx context.Context, req *models.GetListWebAuthnCredentialRequest) (*models.GetListWebAuthnCredentialResponse, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	resp := &models.GetListWebAuthnCredentialResponse{}
+	for _, credential := range r.s.credentials {
+		if credential.UserID == req.UserID {
+			copied := *credential
+			resp.Credentials = append(resp.Credentials, &copied)
+		}
+	}
+	resp.Count = len(resp.Credentials)
+
+	return resp, nil
+}
+
+func (r memWebAuthnRepo) Delete(ctx context.Context, req *models.WebAuthnCredentialPrimaryKey) (int64, error) {
+	if err := uuidColumn(req.Id); err != nil {
+		return 0, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	credential, ok := r.s.credentials[req.Id]
+	if !ok || credential.UserID != req.UserID {
+		return 0, nil
+	}
+	delete(r.s.credentials, req.Id)
+
+	return 1, nil
+}
+
+// Touch has the condition of the UPDATE of the postgres repository, applied
+// under the lock as the database applies it under the row lock.
+func (r memWebAuthnRepo) Touch(ctx context.Context, req *models.TouchWebAuthnCredential) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	credential, ok := r.s.credentials[req.Id]
+	if !ok || !(credential.SignCount < req.SignCount || (credential.SignCount == 0 && req.SignCount == 0)) {
+		return 0, nil
+	}
+	credential.SignCount = req.SignCount
+	credential.BackedUp = req.BackedUp
+
+	return 1, nil
+}
+
+func (r memWebAuthnRepo) UseChallenge(ctx context.Context, req *models.UseWebAuthnChallenge) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.challenges[req.ChallengeHash] {
+		return 0, nil
+	}
+	r.s.challenges[req.ChallengeHash] = true
+
+	return 1, nil
+}
+
+type memAPIKeyRepo struct {
+	storage.APIKeyRepoI
+	s *memStore
+}
+
+func (r memAPIKeyRepo) GetByID(ctx context.Context, req *models.APIKeyPrimaryKey) (*models.APIKey, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, key := range r.s.apiKeys {
+		if (len(req.Id) > 0 && key.Id == req.Id && key.UserID == req.UserID) ||
+			(len(req.Id) <= 0 && key.Prefix == req.Prefix) {
+			copied := *key
+			return &copied, nil
+		}
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+func (r memAPIKeyRepo) Touch(ctx context.Context, req *models.APIKeyPrimaryKey) (int64, error) {
+	return 1, nil
+}
+
+func (r memAPIKeyRepo) Revoke(ctx context.Context, req *models.APIKeyPrimaryKey) (int64, error) {
+	if err := uuidColumn(req.Id); err != nil {
+		return 0, err
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	key, ok := r.s.apiKeys[req.Id]
+	if !ok || key.UserID != req.UserID || !key.Active {
+		return 0, nil
+	}
+	key.Active = false
+
+	return 1, nil
+}
+
+type memOAuthCode struct {
+	models.OAuthCode
+	used bool
+}
+
+type memRefreshToken struct {
+	models.OAuthRefreshToken
+	used bool
+}
+
+type memOAuthRepo struct {
+	storage.OAuthRepoI
+	s *memStore
+}
+
+func (r memOAuthRepo) GetClient(ctx context.Context, req *models.OAuthClientPrimaryKey) (*models.OAuthClient, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	client, ok := r.s.clients[req.Id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	copied := *client
+
+	return &copied, nil
+}
+
+func (r memOAuthRepo) CreateCode(ctx context.Context, req *models.CreateOAuthCode) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.codes[req.CodeHash] = &memOAuthCode{OAuthCode: req.OAuthCode}
+
+	return nil
+}
+
+func (r memOAuthRepo) ConsumeCode(ctx context.Context, req *models.OAuthCodePrimaryKey) (*models.OAuthCode, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	code, ok := r.s.codes[req.CodeHash]
+	if !ok || code.used {
+		return nil, pgx.ErrNoRows
+	}
+	code.used = true
+	copied := code.OAuthCode
+
+	return &copied, nil
+}
+
+func (r memOAuthRepo) CreateRefreshToken(ctx context.Context, req *models.CreateOAuthRefreshToken) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token := &memRefreshToken{OAuthRefreshToken: models.OAuthRefreshToken{
+		Id:        uuid.NewString(),
+		ClientID:  req.ClientID,
+		UserID:    req.UserID,
+		SessionID: req.SessionID,
+		Scope:     req.Scope,
+	}}
+	r.s.refresh[req.TokenHash] = token
+
+	return token.Id, nil
+}
+
+// GetRefreshToken reports a token active as the postgres repository does:
+// unused and with its session not revoked.
+func (r memOAuthRepo) GetRefreshToken(ctx context.Context, req *models.OAuthRefreshTokenPrimaryKey) (*models.OAuthRefreshToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.s.refresh[req.TokenHash]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	copied := token.OAuthRefreshToken
+	copied.Used = token.used
+	session, ok := r.s.sessions[token.SessionID]
+	copied.Active = !token.used && ok && !session.Revoked
+
+	return &copied, nil
+}
+
+func (r memOAuthRepo) UseRefreshToken(ctx context.Context, req *models.OAuthRefreshTokenPrimaryKey) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.s.refresh[req.TokenHash]
+	if !ok || token.used {
+		return 0, nil
+	}
+	token.used = true
+
+	return 1, nil
+}
+
+type memPhoneRepo struct {
+	storage.PhoneRepoI
+	s *memStore
+}
+
+func (r memPhoneRepo) GetByID(ctx context.Context, req *models.PhonePrimaryKey) (*models.Phone, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, phone := range r.s.phones {
+		number, _ := helper.NormalizePhone(phone.Phone)
+		if (len(req.Id) > 0 && phone.Id == req.Id) ||
+			(len(req.Id) <= 0 && number == req.Phone && phone.Verified) {
+			copied := *phone
+			return &copied, nil
+		}
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+// memOTPCode is a stored code with the times the postgres repository keeps
+// in its columns.
+type memOTPCode struct {
+	models.OTPCode
+	created  time.Time
+	expires  time.Time
+	consumed bool
+}
+
+// memOTPRepo applies the conditions of the queries of the postgres
+// repository, on the clock of memStore.now.
+type memOTPRepo struct {
+	storage.OTPRepoI
+	s *memStore
+}
+
+func (r memOTPRepo) Create(ctx context.Context, req *models.CreateOTPCode) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := r.s.clock()
+	recent, hourly := 0, 0
+	for _, code := range r.s.otpCodes {
+		if code.Phone != req.Phone || !code.created.After(now.Add(-time.Hour)) {
+			continue
+		}
+		hourly++
+		if code.created.After(now.Add(-req.ResendInterval)) {
+			recent++
+		}
+	}
+	if req.ResendInterval > 0 && recent > 0 {
+		return "", storage.ErrOTPResendInterval
+	}
+	if hourly >= req.MaxPerHour {
+		return "", storage.ErrOTPHourlyLimit
+	}
+
+	code := &memOTPCode{
+		OTPCode: models.OTPCode{
+			Id:       uuid.NewString(),
+			Purpose:  req.Purpose,
+			Phone:    req.Phone,
+			UserID:   req.UserID,
+			PhoneID:  req.PhoneID,
+			CodeHash: req.CodeHash,
+		},
+		created: now,
+		expires: now.Add(req.TTL),
+	}
+	r.s.otpCodes = append(r.s.otpCodes, code)
+
+	return code.Id, nil
+}
+
+func (r memOTPRepo) GetActive(ctx context.Context, req *models.OTPCodePrimaryKey) (*models.OTPCode, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for i := len(r.s.otpCodes) - 1; i >= 0; i-- {
+		code := r.s.otpCodes[i]
+		if code.Purpose != req.Purpose || code.Phone != req.Phone {
+			continue
+		}
+		// only the latest code counts
+		if code.consumed || !code.expires.After(r.s.clock()) {
+			break
+		}
+		copied := code.OTPCode
+		return &copied, nil
+	}
+
+	return nil, pgx.ErrNoRows
+}
+
+func (r memOTPRepo) Attempt(ctx context.Context, req *models.AttemptOTPCode) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, code := range r.s.otpCodes {
+		if code.Id == req.Id && code.Attempts < req.MaxAttempts && !code.consumed && code.expires.After(r.s.clock()) {
+			code.Attempts++
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (r memOTPRepo) Consume(ctx context.Context, req *models.OTPCodePrimaryKey) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, code := range r.s.otpCodes {
+		if code.Id == req.Id && !code.consumed {
+			code.consumed = true
+			return 1, nil
+		}
+	}
+
+	return 0, nil
+}
+
+type memAuditRepo struct {
+	storage.AuditRepoI
+	s *memStore
+}
+
+func (r memAuditRepo) Create(ctx context.Context, req *models.CreateAuditEvent) (string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.audits = append(r.s.audits, *req)
+
+	return uuid.NewString(), nil
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"app/pkg/health"
+	"app/pkg/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz godoc
+// @ID healthz
+// @Router /healthz [GET]
+// @Summary Liveness
+// @Description Reports that the process is alive. It does not check any dependency.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} health.Report "Alive"
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, health.Report{Status: health.StatusUp, Checks: []health.Result{}})
+}
+
+// Readyz godoc
+// @ID readyz
+// @Router /readyz [GET]
+// @Summary Readiness
+// @Description Runs the dependency checks (postgres, migrations, config) and reports each status and latency.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} health.Report "Ready"
+// @Failure 503 {object} health.Report "Not Ready"
+func (h *Handler) Readyz(c *gin.Context) {
+	report := h.health.Run(c.Request.Context())
+
+	code := http.StatusOK
+	if report.Status != health.StatusUp {
+		code = http.StatusServiceUnavailable
+		h.log(c).Warn("readyz", logger.Any("report", report))
+	}
+
+	c.JSON(code, report)
+}
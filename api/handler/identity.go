@@ -0,0 +1,390 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/logger"
+	"app/pkg/metrics"
+	"app/pkg/oauth"
+	"app/pkg/oidc"
+	"app/pkg/tokens"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// loginStateCookie carries the state of a login through an upstream
+	// provider from the redirect to the callback.
+	loginStateCookie = "oidc_login"
+	loginStateTTL    = 10 * time.Minute
+)
+
+var errIdentityLinked = errors.New("this identity is linked to another account")
+
+// Login With Provider godoc
+// @ID login_with_provider
+// @Router /login/{provider} [GET]
+// @Summary Login With Provider
+// @Description Redirects to an upstream OpenID Connect provider configured in OIDC_PROVIDERS. Its callback logs the user in, linking the identity to the account signed in with the browser, else to the account with the same verified email, else to a new account.
+// @Tags Login
+// @Produce json
+// @Param provider path string true "provider name"
+// @Param return_to query string false "path on this site to go to after login"
+// @Response 302 {string} string "Redirect to the provider"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 404 {object} Response{data=string} "Not Found"
+// @Response 502 {object} Response{data=string} "Provider Unavailable"
+func (h *Handler) LoginWithProvider(c *gin.Context) {
+
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		h.handlerResponse(c, "login with provider", http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	returnTo := c.Query("return_to")
+	if len(returnTo) > 0 && !isLocalPath(returnTo) {
+		h.handlerResponse(c, "login with provider", http.StatusBadRequest, "return_to must be a path on this site")
+		return
+	}
+
+	state := map[string]string{"provider": provider.Name, "return_to": returnTo}
+	for _, key := range []string{"state", "nonce", "verifier"} {
+		value, err := oauth.GenerateToken()
+		if err != nil {
+			h.handlerResponse(c, "login with provider", http.StatusInternalServerError, err.Error())
+			return
+		}
+		state[key] = value
+	}
+
+	redirect, err := provider.AuthCodeURL(c.Request.Context(), state["state"], state["nonce"], oauth.S256Challenge(state["verifier"]))
+	if err != nil {
+		h.log(c).Error("oidc.authCodeURL", logger.String("provider", provider.Name), logger.Error(err))
+		h.handlerResponse(c, "login with provider", http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+
+	cookie, err := h.links.SignState(tokens.PurposeOIDCLogin, state, loginStateTTL)
+	if err != nil {
+		h.handlerResponse(c, "login with provider", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.setRedirectCookie(c, loginStateCookie, cookie, int(loginStateTTL.Seconds()), "/login/"+provider.Name)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Login Callback godoc
+// @ID login_callback
+// @Router /login/{provider}/callback [GET]
+// @Summary Login Callback
+// @Description Redirect URI registered with the upstream provider. It validates the ID token, starts a session with the token cookie and redirects to return_to, if given.
+// @Tags Login
+// @Produce json
+// @Param provider path string true "provider name"
+// @Param code query string false "code"
+// @Param state query string true "state"
+// @Param error query string false "error"
+// @Success 200 {object} Response{data=string} "Success Request"
+// @Response 302 {string} string "Redirect to return_to"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 401 {object} Response{data=string} "Unauthorized"
+// @Response 409 {object} Response{data=string} "Linked To Another Account"
+func (h *Handler) LoginCallback(c *gin.Context) {
+
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		h.handlerResponse(c, "login callback", http.StatusNotFound, "unknown identity provider")
+		return
+	}
+
+	value, _ := c.Cookie(loginStateCookie)
+	h.setRedirectCookie(c, loginStateCookie, "", -1, "/login/"+provider.Name)
+
+	state, err := h.links.VerifyState(tokens.PurposeOIDCLogin, value)
+	if err != nil || state["provider"] != provider.Name ||
+		subtle.ConstantTimeCompare([]byte(state["state"]), []byte(c.Query("state"))) != 1 {
+		h.handlerResponse(c, "login callback", http.StatusBadRequest, "the login expired, start again")
+		return
+	}
+
+	if e := c.Query("error"); len(e) > 0 {
+		h.metrics.ObserveLogin(metrics.LoginFailure)
+		h.handlerResponse(c, "login callback", http.StatusUnauthorized, "the identity provider refused the login: "+e)
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), state["verifier"], state["nonce"])
+	if err != nil {
+		h.log(c).Error("oidc.exchange", logger.String("provider", provider.Name), logger.Error(err))
+		h.recordAudit(c, &models.CreateAuditEvent{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetLogin,
+			TargetID:   provider.Name,
+		})
+		h.metrics.ObserveLogin(metrics.LoginFailure)
+		h.handlerResponse(c, "login callback", http.StatusUnauthorized, "the identity provider login failed")
+		return
+	}
+
+	user, err := h.federatedUser(c, provider.Name, identity)
+	if errors.Is(err, errIdentityLinked) {
+		h.handlerResponse(c, "login callback", http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		h.handlerResponse(c, "login callback", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	token, err := h.startSession(c, user, "")
+	if err != nil {
+		h.handlerResponse(c, "start session", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.setCookie(c, "token", token, int(h.tokens.TTL().Seconds()), "/")
+	if returnTo := state["return_to"]; len(returnTo) > 0 {
+		c.Redirect(http.StatusFound, returnTo)
+		return
+	}
+	c.JSON(http.StatusOK, nil)
+}
+
+// @Security ApiKeyAuth
+// Get List Identity godoc
+// @ID get_list_identity
+// @Router /v1/user/me/identities [GET]
+// @Summary Get List Identity
+// @Description Lists the upstream provider identities linked to the current user, oldest first. More are linked by logging in with a provider while signed in.
+// @Tags Login
+// @Produce json
+// @Success 200 {object} Response{data=models.GetListUserIdentityResponse} "Success Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) GetListIdentity(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	resp, err := h.storages.Identity().GetList(c.Request.Context(), &models.GetListUserIdentityRequest{UserID: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.identity.getList", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.handlerResponse(c, "get list identity", http.StatusOK, resp)
+}
+
+// @Security ApiKeyAuth
+// Delete Identity godoc
+// @ID delete_identity
+// @Router /v1/user/me/identities/{id} [DELETE]
+// @Summary Delete Identity
+// @Description Unlinks an identity from the current user. The last one cannot be unlinked from an account without a password.
+// @Tags Login
+// @Produce json
+// @Param id path string true "identity id"
+// @Success 204 {object} Response{data=string} "Success Request"
+// @Response 404 {object} Response{data=string} "Not Found"
+// @Response 409 {object} Response{data=string} "Last Login Method"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) DeleteIdentity(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	key := &models.UserIdentityPrimaryKey{Id: c.Param("id"), UserID: userData.UserID}
+
+	identity, err := h.storages.Identity().GetByID(c.Request.Context(), key)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			h.handlerResponse(c, "storage.identity.getByID", http.StatusNotFound, "identity not found")
+			return
+		}
+		h.handlerResponse(c, "storage.identity.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(user.Password) <= 0 {
+		identities, err := h.storages.Identity().GetList(c.Request.Context(), &models.GetListUserIdentityRequest{UserID: user.Id})
+		if err != nil {
+			h.handlerResponse(c, "storage.identity.getList", http.StatusInternalServerError, err.Error())
+			return
+		}
+		if identities.Count <= 1 {
+			h.handlerResponse(c, "delete identity", http.StatusConflict, "this is the only way to log in to the account")
+			return
+		}
+	}
+
+	rowsAffected, err := h.storages.Identity().Delete(c.Request.Context(), key)
+	if err != nil {
+		h.handlerResponse(c, "storage.identity.delete", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rowsAffected <= 0 {
+		h.handlerResponse(c, "storage.identity.delete", http.StatusNotFound, "identity not found")
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionIdentityUnlink,
+		TargetType: audit.TargetIdentity,
+		TargetID:   identity.Id,
+		Changes:    audit.Diff(identity, nil),
+	})
+
+	h.handlerResponse(c, "delete identity", http.StatusNoContent, nil)
+}
+
+// federatedUser returns the user an upstream identity logs in, linking it on
+// first use: to the user signed in with the browser, else to the user whose
+// verified email the provider also verified, else to a new user.
+func (h *Handler) federatedUser(c *gin.Context, provider string, identity *oidc.Identity) (*models.User, error) {
+	current := h.cookieUser(c)
+
+	linked, err := h.storages.Identity().GetByID(c.Request.Context(), &models.UserIdentityPrimaryKey{Provider: provider, Subject: identity.Subject})
+	if err == nil {
+		if current != nil && current.Id != linked.UserID {
+			return nil, errIdentityLinked
+		}
+
+		_, err = h.storages.Identity().Touch(c.Request.Context(), &models.TouchUserIdentity{Id: linked.Id, Email: identity.Email})
+		if err != nil {
+			h.log(c).Error("storage.identity.touch", logger.Error(err))
+		}
+
+		return h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: linked.UserID})
+	}
+	if err.Error() != "no rows in result set" {
+		return nil, err
+	}
+
+	user := current
+	if user == nil && identity.EmailVerified && helper.IsValidEmail(identity.Email) {
+		owner, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Email: identity.Email})
+		switch {
+		// an unverified address could have been registered by anyone
+		case err == nil && owner.EmailVerified:
+			user = owner
+		case err != nil && err.Error() != "no rows in result set":
+			return nil, err
+		}
+	}
+	if user == nil {
+		user, err = h.provisionUser(c, provider, identity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	createIdentity := models.CreateUserIdentity{
+		UserID:   user.Id,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	id, err := h.storages.Identity().Create(c.Request.Context(), &createIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionIdentityLink,
+		ActorID:    user.Id,
+		TargetType: audit.TargetIdentity,
+		TargetID:   id,
+		Changes:    audit.Diff(nil, createIdentity),
+	})
+
+	return user, nil
+}
+
+// provisionUser creates a user without a password for an upstream identity.
+// It takes over the email only when the provider verified it and no other
+// user has it.
+func (h *Handler) provisionUser(c *gin.Context, provider string, identity *oidc.Identity) (*models.User, error) {
+	sum := sha256.Sum256([]byte(identity.Subject))
+
+	createUser := models.CreateUser{
+		Name:  identity.Name,
+		Login: provider + "-" + hex.EncodeToString(sum[:6]),
+	}
+	if len(createUser.Name) <= 0 {
+		createUser.Name = createUser.Login
+	}
+
+	if identity.EmailVerified && helper.IsValidEmail(identity.Email) {
+		_, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Email: identity.Email})
+		switch {
+		case err == nil:
+		case err.Error() == "no rows in result set":
+			createUser.Email = identity.Email
+		default:
+			return nil, err
+		}
+	}
+
+	id, err := h.storages.User().Create(c.Request.Context(), &createUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(createUser.Email) > 0 {
+		_, err = h.storages.User().VerifyEmail(c.Request.Context(), &models.VerifyUserEmail{Id: id, Email: createUser.Email})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: id})
+	if err != nil {
+		return nil, err
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionRegister,
+		ActorID:    user.Id,
+		TargetType: audit.TargetUser,
+		TargetID:   user.Id,
+		Changes:    audit.Diff(nil, user),
+	})
+
+	return user, nil
+}
+
+// isLocalPath reports whether target is a path on this site, so redirecting
+// to it cannot send the browser elsewhere.
+func isLocalPath(target string) bool {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.ContainsAny(target, "\\\r\n") {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	return err == nil && len(u.Scheme) <= 0 && len(u.Host) <= 0
+}
@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/config"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/oidc/oidctest"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newProviderTest starts a fake provider named "test" and a handler on store
+// which logs in with it.
+func newProviderTest(t *testing.T, store *memStore) (*oidctest.Server, *Handler, *gin.Engine) {
+	t.Helper()
+
+	srv := oidctest.NewServer()
+	t.Cleanup(srv.Close)
+
+	cfg := testConfig()
+	cfg.OIDCProviders = []config.OIDCProvider{{
+		Name:         "test",
+		Issuer:       srv.URL,
+		ClientID:     srv.ClientID,
+		ClientSecret: srv.ClientSecret,
+		Scopes:       []string{"openid", "email", "profile"},
+	}}
+	h := newTestHandler(t, cfg, store, nil)
+
+	r := gin.New()
+	r.GET("/login/:provider", h.LoginWithProvider)
+	r.GET("/login/:provider/callback", h.LoginCallback)
+
+	return srv, h, r
+}
+
+// providerLogin sends client through the login at the fake provider and
+// returns the response of the callback. authorize and callback, unless nil,
+// change the query of the request to the provider and of the callback.
+func providerLogin(t *testing.T, client *testClient, returnTo string, authorize, callback func(url.Values)) *httptest.ResponseRecorder {
+	t.Helper()
+
+	w := client.do(t, http.MethodGet, "/login/test?return_to="+url.QueryEscape(returnTo), nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("login = %d %s", w.Code, w.Body)
+	}
+
+	target := rewriteQuery(t, w.Header().Get("Location"), authorize)
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirects.Get(target)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize = %d", resp.StatusCode)
+	}
+
+	u, err := url.Parse(rewriteQuery(t, resp.Header.Get("Location"), callback))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client.do(t, http.MethodGet, u.RequestURI(), nil)
+}
+
+func rewriteQuery(t *testing.T, target string, rewrite func(url.Values)) string {
+	t.Helper()
+
+	if rewrite == nil {
+		return target
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		t.Fatalf("parse %q: %v", target, err)
+	}
+	query := u.Query()
+	rewrite(query)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// identityOwner returns the id of the user the identity of subject at the
+// "test" provider is linked to.
+func (s *memStore) identityOwner(subject string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, identity := range s.identities {
+		if identity.Provider == "test" && identity.Subject == subject {
+			return identity.UserID
+		}
+	}
+
+	return ""
+}
+
+func TestLoginCallback(t *testing.T) {
+	store := newMemStore()
+	_, _, r := newProviderTest(t, store)
+
+	client := newTestClient(r)
+	w := providerLogin(t, client, "", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback = %d %s", w.Code, w.Body)
+	}
+	if len(client.cookies["token"]) <= 0 {
+		t.Fatal("the callback set no token cookie")
+	}
+	if _, ok := client.cookies[loginStateCookie]; ok {
+		t.Fatal("the callback kept the state cookie")
+	}
+
+	owner := store.identityOwner("1001")
+	if len(owner) <= 0 {
+		t.Fatal("the identity was not linked")
+	}
+	user, err := store.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: owner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "user@example.com" || !user.EmailVerified || user.Name != "Test User" {
+		t.Fatalf("provisioned user = %+v, want the verified email and name of the provider", user)
+	}
+
+	// the second login finds the linked identity
+	if w = providerLogin(t, newTestClient(r), "", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("second callback = %d %s", w.Code, w.Body)
+	}
+	if len(store.users) != 1 {
+		t.Fatalf("%d users after two logins, want 1", len(store.users))
+	}
+}
+
+func TestLoginCallbackStateMismatch(t *testing.T) {
+	store := newMemStore()
+	_, _, r := newProviderTest(t, store)
+
+	client := newTestClient(r)
+	w := providerLogin(t, client, "", nil, func(query url.Values) {
+		query.Set("state", "forged")
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("callback with another state = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+	if len(client.cookies["token"]) > 0 || len(store.identities) > 0 {
+		t.Fatal("the callback logged in")
+	}
+}
+
+func TestLoginCallbackWithoutStateCookie(t *testing.T) {
+	store := newMemStore()
+	_, _, r := newProviderTest(t, store)
+
+	// the callback reaches a browser which never started the login
+	client := newTestClient(r)
+	var callback string
+	providerLogin(t, client, "", nil, func(query url.Values) {
+		callback = "/login/test/callback?" + query.Encode()
+	})
+
+	w := newTestClient(r).do(t, http.MethodGet, callback, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("callback without the cookie = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
+
+func TestLoginCallbackNonceMismatch(t *testing.T) {
+	store := newMemStore()
+	_, _, r := newProviderTest(t, store)
+
+	// the provider puts another nonce into the ID token
+	client := newTestClient(r)
+	w := providerLogin(t, client, "", func(query url.Values) {
+		query.Set("nonce", "replayed")
+	}, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("callback with another nonce = %d %s, want %d", w.Code, w.Body, http.StatusUnauthorized)
+	}
+	if len(client.cookies["token"]) > 0 || len(store.identities) > 0 {
+		t.Fatal("the callback logged in")
+	}
+
+	actions := store.auditActions()
+	if len(actions) != 1 || actions[0] != audit.ActionLoginFailed {
+		t.Fatalf("audit actions = %v, want only %s", actions, audit.ActionLoginFailed)
+	}
+}
+
+func TestLoginCallbackLinksByEmail(t *testing.T) {
+	tests := []struct {
+		name             string
+		ownerVerified    bool
+		providerVerified bool
+		linked           bool
+	}{
+		{"both verified", true, true, true},
+		{"owner unverified", false, true, false},
+		{"provider unverified", true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemStore()
+			owner := store.addUser(models.User{Name: "Alice", Login: "alice1", Email: "Alice@Example.com", EmailVerified: tt.ownerVerified})
+
+			srv, _, r := newProviderTest(t, store)
+			srv.SetUser(oidctest.User{Subject: "2002", Email: "alice@example.com", EmailVerified: tt.providerVerified, Name: "Alice"})
+
+			w := providerLogin(t, newTestClient(r), "", nil, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("callback = %d %s", w.Code, w.Body)
+			}
+
+			linkedTo := store.identityOwner("2002")
+			if (linkedTo == owner.Id) != tt.linked {
+				t.Fatalf("identity linked to the owner of the email = %v, want %v", linkedTo == owner.Id, tt.linked)
+			}
+			if tt.linked {
+				return
+			}
+
+			// a new user without the email someone else has
+			user, err := store.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: linkedTo})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(user.Email) > 0 {
+				t.Fatalf("provisioned user took the email %q", user.Email)
+			}
+		})
+	}
+}
+
+func TestLoginCallbackLinkedToAnotherUser(t *testing.T) {
+	store := newMemStore()
+	_, h, r := newProviderTest(t, store)
+
+	if w := providerLogin(t, newTestClient(r), "", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("first callback = %d %s", w.Code, w.Body)
+	}
+	linkedTo := store.identityOwner("1001")
+
+	tests := []struct {
+		name   string
+		userID string
+		code   int
+	}{
+		{"signed in as another user", store.addUser(models.User{Name: "Bob", Login: "bob1"}).Id, http.StatusConflict},
+		{"signed in as the linked user", linkedTo, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := h.tokens.Issue(helper.TokenInfo{UserID: tt.userID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := newTestClient(r)
+			client.cookies["token"] = token
+
+			if w := providerLogin(t, client, "", nil, nil); w.Code != tt.code {
+				t.Fatalf("callback = %d %s, want %d", w.Code, w.Body, tt.code)
+			}
+			if store.identityOwner("1001") != linkedTo {
+				t.Fatal("the identity moved to another user")
+			}
+		})
+	}
+}
+
+func TestLoginReturnTo(t *testing.T) {
+	store := newMemStore()
+	_, _, r := newProviderTest(t, store)
+
+	w := providerLogin(t, newTestClient(r), "/account?tab=security", nil, nil)
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/account?tab=security" {
+		t.Fatalf("callback = %d to %q, want %d to /account?tab=security", w.Code, w.Header().Get("Location"), http.StatusFound)
+	}
+
+	for _, returnTo := range []string{"https://evil.com", "//evil.com", "/\\evil.com", "javascript:alert(1)", "account"} {
+		t.Run(returnTo, func(t *testing.T) {
+			w := newTestClient(r).do(t, http.MethodGet, "/login/test?return_to="+url.QueryEscape(returnTo), nil)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("login = %d to %q, want %d", w.Code, w.Header().Get("Location"), http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestIsLocalPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"/", true},
+		{"/account", true},
+		{"/account?tab=security#keys", true},
+		{"", false},
+		{"account", false},
+		{"https://evil.com/account", false},
+		{"//evil.com", false},
+		{"///evil.com", false},
+		{"/\\evil.com", false},
+		{"\\\\evil.com", false},
+		{"/account\r\nSet-Cookie: a=b", false},
+		{"javascript:alert(1)", false},
+	}
+
+	for _, tt := range tests {
+		if got := isLocalPath(tt.target); got != tt.want {
+			t.Errorf("isLocalPath(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/logger"
+	"app/pkg/metrics"
+	"app/storage"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// noUsersStore has no users, so every login fails.
+type noUsersStore struct {
+	storage.StorageI
+}
+
+func (noUsersStore) User() storage.UserRepoI   { return noUsersRepo{} }
+func (noUsersStore) Audit() storage.AuditRepoI { return discardAuditRepo{} }
+
+type noUsersRepo struct {
+	storage.UserRepoI
+}
+
+func (noUsersRepo) GetByID(ctx context.Context, req *models.UserPrimaryKey) (*models.User, error) {
+	return nil, pgx.ErrNoRows
+}
+
+type discardAuditRepo struct {
+	storage.AuditRepoI
+}
+
+func (discardAuditRepo) Create(ctx context.Context, req *models.CreateAuditEvent) (string, error) {
+	return "", nil
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	m := metrics.New(prometheus.NewRegistry())
+	log := logger.NewLogger("test", logger.LevelFatal)
+	store := noUsersStore{}
+	h := &Handler{logger: log, storages: store, recorder: audit.NewRecorder(store.Audit(), log), metrics: m}
+
+	r := gin.New()
+	r.Use(h.MetricsMiddleware())
+	r.GET("/v1/user/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/login", h.LoginUser)
+
+	requests := []struct {
+		method, target, body string
+	}{
+		{http.MethodGet, "/v1/user/1", ""},
+		{http.MethodGet, "/v1/user/2", ""},
+		{http.MethodGet, "/missing", ""},
+		{http.MethodPost, "/login", `{"login":"nobody1","password":"secret123"}`},
+	}
+	for _, req := range requests {
+		httpReq := httptest.NewRequest(req.method, req.target, strings.NewReader(req.body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(httptest.NewRecorder(), httpReq)
+	}
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("scrape = %d", w.Code)
+	}
+	body := w.Body.Bytes()
+
+	for _, series := range []string{
+		`app_http_requests_total{method="GET",route="/v1/user/:id",status="200"} 2`,
+		`app_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`app_http_requests_total{method="POST",route="/login",status="400"} 1`,
+		`app_http_request_duration_seconds_count{method="GET",route="/v1/user/:id",status="200"} 2`,
+		`app_logins_total{result="failure"} 1`,
+	} {
+		if !bytes.Contains(body, []byte(series+"\n")) {
+			t.Errorf("scrape has no %s", series)
+		}
+	}
+	if bytes.Contains(body, []byte(`app_logins_total{result="success"}`)) {
+		t.Error("scrape counts a successful login")
+	}
+}
@@ -1,34 +1,282 @@
 package handler
 
 import (
+	"app/api/models"
+	"app/pkg/apikey"
 	"app/pkg/helper"
-	"fmt"
+	"app/pkg/logger"
+	"app/pkg/oauth"
+	"app/pkg/tracing"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const requestIDHeader = "X-Request-ID"
+
 func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 
 	return func(c *gin.Context) {
 
-		value, err := c.Cookie("token")
+		if header := c.GetHeader("Authorization"); strings.HasPrefix(header, apikey.Scheme+" ") {
+			info, err := h.verifyAPIKey(c, strings.TrimPrefix(header, apikey.Scheme+" "))
+			if errors.Is(err, errInvalidAPIKey) {
+				h.handlerResponse(c, "auth middleware", http.StatusUnauthorized, err.Error())
+				c.Abort()
+				return
+			}
+			if err != nil {
+				h.handlerResponse(c, "auth middleware", http.StatusInternalServerError, err.Error())
+				c.Abort()
+				return
+			}
+
+			h.authorizeScoped(c, info, "api key")
+			return
+		}
+
+		value, err := h.requestToken(c)
 		if err != nil {
+			// services without a token may authenticate with their client certificate
+			if info, ok := h.clientPrincipal(c); ok {
+				h.authorizeScoped(c, info, "service principal")
+				return
+			}
 			c.String(http.StatusNotFound, "Cookie not found")
+			c.Abort()
 			return
 		}
 
-		// value := c.GetHeader("Authorization")
-
-		info, err := helper.ParseClaims(value, h.cfg.AuthSecretKey)
+		info, err := h.tokens.Verify(value)
 
 		if err != nil {
 			c.AbortWithError(http.StatusForbidden, err)
 			return
 		}
-		fmt.Println(info)
+
+		// tokens issued to an OAuth client carry only the scopes the user
+		// granted it, which /userinfo checks; they are no login
+		if len(info.ClientID) > 0 {
+			h.handlerResponse(c, "auth middleware", http.StatusForbidden, "oauth access tokens are only accepted by /userinfo")
+			c.Abort()
+			return
+		}
+
+		// client_credentials tokens act for a client, not a user
+		if len(info.UserID) <= 0 {
+			h.handlerResponse(c, "auth middleware", http.StatusForbidden, "token has no user")
+			c.Abort()
+			return
+		}
+
+		if !h.checkSession(c, info) {
+			h.handlerResponse(c, "auth middleware", http.StatusUnauthorized, "session revoked or expired")
+			c.Abort()
+			return
+		}
 
 		c.Set("Auth", info)
 		c.Next()
 	}
 }
+
+// requestToken returns the access token of the Authorization: Bearer header,
+// as sent by OAuth clients, or else of the "token" cookie set on login.
+func (h *Handler) requestToken(c *gin.Context) (string, error) {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return helper.ExtractToken(header)
+	}
+
+	return c.Cookie("token")
+}
+
+// authorizeScoped lets a caller limited to scopes, an API key or a service
+// principal, through to routes its scopes cover.
+func (h *Handler) authorizeScoped(c *gin.Context, info helper.TokenInfo, caller string) {
+	scope := apikey.RequiredScope(c.Request.Method, c.FullPath())
+	if len(scope) <= 0 {
+		h.handlerResponse(c, "auth middleware", http.StatusForbidden, caller+"s cannot call this route")
+		c.Abort()
+		return
+	}
+	if !oauth.HasScope(oauth.ParseScope(info.Scope), scope) {
+		h.handlerResponse(c, "auth middleware", http.StatusForbidden, caller+" lacks the "+scope+" scope")
+		c.Abort()
+		return
+	}
+
+	c.Set("Auth", info)
+	c.Next()
+}
+
+// AdminMiddleware lets through only users with the admin role. It must run after AuthMiddleware.
+func (h *Handler) AdminMiddleware() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+
+		val, exists := c.Get("Auth")
+		if !exists {
+			h.handlerResponse(c, "get id in token", http.StatusUnauthorized, "invalid token")
+			c.Abort()
+			return
+		}
+		userData := val.(helper.TokenInfo)
+
+		user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: userData.UserID})
+		if err != nil {
+			h.handlerResponse(c, "storage.user.getByID", http.StatusForbidden, err.Error())
+			c.Abort()
+			return
+		}
+
+		if user.Role != models.RoleAdmin {
+			h.handlerResponse(c, "admin middleware", http.StatusForbidden, "admin role required")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequestIDMiddleware accepts the caller's X-Request-ID or generates one, echoes it back
+// and stores a logger tagged with it in the request context.
+func (h *Handler) RequestIDMiddleware() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+
+		requestID := c.GetHeader(requestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		c.Set("RequestID", requestID)
+		c.Header(requestIDHeader, requestID)
+
+		log := logger.WithFields(h.logger, logger.String("request_id", requestID))
+		c.Request = c.Request.WithContext(logger.ToContext(c.Request.Context(), log))
+
+		c.Next()
+	}
+}
+
+// TracingMiddleware starts a server span for the request, continuing the caller's
+// W3C traceparent when present, and adds the trace ids to the request logger.
+func (h *Handler) TracingMiddleware() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+
+		route := c.FullPath()
+		if len(route) <= 0 {
+			route = "unmatched"
+		}
+
+		ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.target", c.Request.URL.Path),
+				attribute.String("http.client_ip", c.ClientIP()),
+				attribute.String("http.request_id", c.GetString("RequestID")),
+			),
+		)
+		defer span.End()
+
+		log := logger.WithFields(h.log(c),
+			logger.String("trace_id", span.SpanContext().TraceID().String()),
+			logger.String("span_id", span.SpanContext().SpanID().String()),
+		)
+		c.Request = c.Request.WithContext(logger.ToContext(ctx, log))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// AccessLogMiddleware writes one structured log line per request.
+func (h *Handler) AccessLogMiddleware() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+
+		start := time.Now()
+
+		c.Next()
+
+		var userID string
+		if val, exists := c.Get("Auth"); exists {
+			userID = val.(helper.TokenInfo).UserID
+		}
+
+		fields := []logger.Field{
+			logger.String("method", c.Request.Method),
+			logger.String("path", c.Request.URL.Path),
+			logger.String("route", c.FullPath()),
+			logger.Int("status", c.Writer.Status()),
+			logger.Int("bytes", c.Writer.Size()),
+			logger.Any("latency", time.Since(start)),
+			logger.String("ip", c.ClientIP()),
+			logger.String("user_agent", c.Request.UserAgent()),
+			logger.String("user_id", userID),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, logger.String("errors", c.Errors.String()))
+		}
+
+		log := h.log(c)
+		switch {
+		case c.Writer.Status() >= http.StatusInternalServerError:
+			log.Error("access", fields...)
+		case c.Writer.Status() >= http.StatusBadRequest:
+			log.Warn("access", fields...)
+		default:
+			log.Info("access", fields...)
+		}
+	}
+}
+
+// MetricsMiddleware counts requests and their latency by route template and status.
+func (h *Handler) MetricsMiddleware() gin.HandlerFunc {
+
+	return func(c *gin.Context) {
+
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if len(route) <= 0 {
+			route = "unmatched"
+		}
+
+		h.metrics.ObserveRequest(c.Request.Method, route, strconv.Itoa(c.Writer.Status()), time.Since(start))
+	}
+}
+
+func isValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"app/pkg/helper"
+	"app/pkg/oauth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientPrincipal returns the service principal whose subject is that of the
+// client certificate the TLS handshake verified. Requests through a proxy
+// which terminates TLS never have one.
+func (h *Handler) clientPrincipal(c *gin.Context) (helper.TokenInfo, bool) {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) <= 0 {
+		return helper.TokenInfo{}, false
+	}
+
+	subject := c.Request.TLS.VerifiedChains[0][0].Subject.String()
+	for _, p := range h.cfg.TLSClientPrincipals {
+		if p.Subject == subject {
+			return helper.TokenInfo{Principal: p.Name, Scope: oauth.FormatScope(p.Scopes)}, true
+		}
+	}
+
+	return helper.TokenInfo{}, false
+}
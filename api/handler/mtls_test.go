@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/config"
+	"app/pkg/apikey"
+	"app/pkg/certs/certstest"
+	"app/pkg/helper"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientPrincipal(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Login: "alice1"})
+
+	cfg := testConfig()
+	cfg.TLSClientPrincipals = []config.TLSClientPrincipal{
+		{Name: "billing", Subject: "CN=billing,OU=Services,O=Example", Scopes: []string{apikey.ScopeUserRead, apikey.ScopePhoneRead}},
+		{Name: "audit", Subject: "CN=audit,O=Example", Scopes: []string{apikey.ScopeAdmin}},
+	}
+	h := newTestHandler(t, cfg, store, nil)
+
+	// every route answers with the principal it was called by and its scopes
+	r := gin.New()
+	v1 := r.Group("/v1", h.AuthMiddleware())
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/user/:id"},
+		{http.MethodPost, "/user"},
+		{http.MethodGet, "/admin/audit"},
+		{http.MethodGet, "/user/me/sessions"},
+	} {
+		v1.Handle(route.method, route.path, func(c *gin.Context) {
+			info := c.MustGet("Auth").(helper.TokenInfo)
+			c.String(http.StatusOK, info.Principal+" "+info.Scope)
+		})
+	}
+
+	ca := certstest.NewCA(pkix.Name{CommonName: "Test CA"})
+	billing := ca.Issue(pkix.Name{CommonName: "billing", OrganizationalUnit: []string{"Services"}, Organization: []string{"Example"}})
+	audit := ca.Issue(pkix.Name{CommonName: "audit", Organization: []string{"Example"}})
+	stranger := ca.Issue(pkix.Name{CommonName: "billing", Organization: []string{"Example"}})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		cert   *x509.Certificate
+		code   int
+		body   string
+	}{
+		{"read", http.MethodGet, "/v1/user/" + user.Id, billing.Cert, http.StatusOK, "billing user:read phone:read"},
+		{"missing scope", http.MethodPost, "/v1/user", billing.Cert, http.StatusForbidden, ""},
+		{"admin", http.MethodGet, "/v1/admin/audit", audit.Cert, http.StatusOK, "audit admin"},
+		{"account route", http.MethodGet, "/v1/user/me/sessions", billing.Cert, http.StatusForbidden, ""},
+		{"subject of no principal", http.MethodGet, "/v1/user/" + user.Id, stranger.Cert, http.StatusNotFound, ""},
+		{"no certificate", http.MethodGet, "/v1/user/" + user.Id, nil, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.cert != nil {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tt.cert, ca.Cert}}}
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.code {
+				t.Fatalf("%s %s = %d %s, want %d", tt.method, tt.target, w.Code, w.Body, tt.code)
+			}
+			if len(tt.body) > 0 && w.Body.String() != tt.body {
+				t.Fatalf("called as %q, want %q", w.Body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,806 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/logger"
+	"app/pkg/oauth"
+	"app/pkg/oidc"
+	"app/pkg/tokens"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// consentTTL is how long the consent page may stay open before submitting it.
+const consentTTL = 10 * time.Minute
+
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Authorize {{.Client.Name}}</title>
+</head>
+<body>
+<main>
+<h1>{{.Client.Name}} wants to access your account</h1>
+{{if .Scopes}}<p>It asks for:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="/oauth/authorize">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.Client.Id}}">
+<input type="hidden" name="redirect_uri" value="{{.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Scope}}">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Nonce}}">
+<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+{{if .User}}<p>Signed in as {{.User.Login}}.</p>
+{{else}}<p><label>Login or email <input name="login" autocomplete="username" required></label></p>
+<p><label>Password <input name="password" type="password" autocomplete="current-password" required></label></p>
+{{end}}<button name="action" value="allow">Allow</button>
+<button name="action" value="deny" formnovalidate>Deny</button>
+</form>
+{{if and (not .User) .Providers}}<p>Or sign in with{{range .Providers}} <a href="{{.URL}}">{{.Name}}</a>{{end}}</p>
+{{end}}</main>
+</body>
+</html>
+`))
+
+// authorizeRequest is an authorization request whose client and redirect uri
+// have been checked, so errors can be sent back to the client.
+type authorizeRequest struct {
+	Client              *models.OAuthClient
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+}
+
+// consentView is the data of consentPage.
+type consentView struct {
+	*authorizeRequest
+	Scopes       []string
+	User         *models.User // nil shows the login fields
+	Providers    []providerLink
+	ConsentToken string
+	Error        string
+}
+
+// providerLink logs in through an upstream provider and returns to the consent page.
+type providerLink struct {
+	Name string
+	URL  string
+}
+
+// Authorize godoc
+// @ID oauth_authorize
+// @Router /oauth/authorize [GET]
+// @Summary OAuth Authorize
+// @Description Shows the consent page of the authorization code grant, with login fields and links to the OIDC_PROVIDERS when the browser has no session. PKCE with S256 is required. An unknown client or unregistered redirect_uri is reported here; other errors are sent to the redirect_uri.
+// @Tags OAuth
+// @Produce html
+// @Param response_type query string true "code"
+// @Param client_id query string true "client_id"
+// @Param redirect_uri query string false "redirect_uri, may be left out when the client has exactly one"
+// @Param scope query string false "space separated, all scopes of the client when empty"
+// @Param state query string false "state"
+// @Param code_challenge query string true "code_challenge"
+// @Param code_challenge_method query string true "S256"
+// @Param nonce query string false "OpenID Connect, copied into the ID token"
+// @Success 200 {string} string "Consent Page"
+// @Response 302 {string} string "Redirect with an error"
+// @Response 400 {object} Response{data=string} "Bad Request"
+func (h *Handler) Authorize(c *gin.Context) {
+
+	req, redirectErr, err := h.parseAuthorizeRequest(c)
+	if err != nil {
+		h.handlerResponse(c, "oauth authorize", http.StatusBadRequest, err.Error())
+		return
+	}
+	if redirectErr != nil {
+		h.redirectAuthorize(c, req, url.Values{"error": {redirectErr.Code}, "error_description": {redirectErr.Description}})
+		return
+	}
+
+	h.renderConsent(c, http.StatusOK, req, h.cookieUser(c), "")
+}
+
+// Authorize Decision godoc
+// @ID oauth_authorize_decision
+// @Router /oauth/authorize [POST]
+// @Summary OAuth Authorize Decision
+// @Description Target of the consent form. On allow it redirects to the redirect_uri with a single use code, on deny with error access_denied.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param consent_token formData string true "consent_token of the page"
+// @Param action formData string true "allow or deny"
+// @Param login formData string false "login or email, when the browser has no session"
+// @Param password formData string false "password, when the browser has no session"
+// @Response 302 {string} string "Redirect with code or error"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 401 {string} string "Consent Page"
+func (h *Handler) AuthorizeDecision(c *gin.Context) {
+
+	req, redirectErr, err := h.parseAuthorizeRequest(c)
+	if err != nil {
+		h.handlerResponse(c, "oauth authorize", http.StatusBadRequest, err.Error())
+		return
+	}
+	if redirectErr != nil {
+		h.redirectAuthorize(c, req, url.Values{"error": {redirectErr.Code}, "error_description": {redirectErr.Description}})
+		return
+	}
+
+	subject, _, err := h.links.Verify(tokens.PurposeOAuthConsent, c.PostForm("consent_token"))
+	if err != nil {
+		h.handlerResponse(c, "oauth authorize", http.StatusBadRequest, "the form expired, reload the page")
+		return
+	}
+
+	if c.PostForm("action") != "allow" {
+		h.redirectAuthorize(c, req, url.Values{"error": {oauth.ErrAccessDenied}})
+		return
+	}
+
+	var user *models.User
+	if login := c.PostForm("login"); len(login) > 0 {
+		user, err = h.authenticate(c, login, c.PostForm("password"))
+		if errors.Is(err, errUserNotFound) || errors.Is(err, errIncorrectPassword) {
+			h.renderConsent(c, http.StatusUnauthorized, req, nil, err.Error())
+			return
+		}
+		if err != nil {
+			h.handlerResponse(c, "oauth authorize", http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		token, err := h.startSession(c, user, "")
+		if err != nil {
+			h.handlerResponse(c, "start session", http.StatusInternalServerError, err.Error())
+			return
+		}
+		h.setCookie(c, "token", token, int(h.tokens.TTL().Seconds()), "/")
+	} else {
+		user = h.cookieUser(c)
+		if user == nil {
+			h.renderConsent(c, http.StatusUnauthorized, req, nil, "sign in to continue")
+			return
+		}
+		// a page rendered for someone else, or without a session, cannot approve for this user
+		if user.Id != subject {
+			h.handlerResponse(c, "oauth authorize", http.StatusBadRequest, "the form expired, reload the page")
+			return
+		}
+	}
+
+	code, err := oauth.GenerateToken()
+	if err != nil {
+		h.handlerResponse(c, "oauth authorize", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = h.storages.OAuth().CreateCode(c.Request.Context(), &models.CreateOAuthCode{
+		CodeHash: oauth.HashToken(code),
+		TTL:      h.cfg.OAuthCodeTTL,
+		OAuthCode: models.OAuthCode{
+			ClientID:            req.Client.Id,
+			UserID:              user.Id,
+			RedirectURI:         req.RedirectURI,
+			Scope:               req.Scope,
+			CodeChallenge:       req.CodeChallenge,
+			CodeChallengeMethod: req.CodeChallengeMethod,
+			Nonce:               req.Nonce,
+		},
+	})
+	if err != nil {
+		h.log(c).Error("storage.oauth.createCode", logger.Error(err))
+		h.redirectAuthorize(c, req, url.Values{"error": {oauth.ErrServerError}})
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionOAuthAuthorize,
+		ActorID:    user.Id,
+		TargetType: audit.TargetClient,
+		TargetID:   req.Client.Id,
+	})
+
+	h.redirectAuthorize(c, req, url.Values{"code": {code}})
+}
+
+// Token godoc
+// @ID oauth_token
+// @Router /oauth/token [POST]
+// @Summary OAuth Token
+// @Description Token endpoint for the authorization_code (with PKCE), refresh_token and client_credentials grants. Clients authenticate with HTTP Basic or client_id and client_secret fields; public clients send only client_id. Refresh tokens rotate on every use, and reusing one revokes the whole grant.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, refresh_token or client_credentials"
+// @Param code formData string false "authorization_code"
+// @Param redirect_uri formData string false "authorization_code"
+// @Param code_verifier formData string false "authorization_code"
+// @Param refresh_token formData string false "refresh_token"
+// @Param scope formData string false "refresh_token and client_credentials"
+// @Param client_id formData string false "client_id"
+// @Param client_secret formData string false "client_secret"
+// @Success 200 {object} models.OAuthTokenResponse "Tokens"
+// @Response 400 {object} oauth.Error "Bad Request"
+// @Response 401 {object} oauth.Error "Invalid Client"
+func (h *Handler) Token(c *gin.Context) {
+
+	client, oauthErr := h.authenticateClient(c)
+	if oauthErr != nil {
+		h.oauthError(c, oauthErr)
+		return
+	}
+
+	grant := c.PostForm("grant_type")
+
+	switch grant {
+	case oauth.GrantAuthorizationCode, oauth.GrantRefreshToken, oauth.GrantClientCredentials:
+	default:
+		h.oauthError(c, oauth.NewError(oauth.ErrUnsupportedGrantType, ""))
+		return
+	}
+	if !oauth.HasScope(client.GrantTypes, grant) {
+		h.oauthError(c, oauth.NewError(oauth.ErrUnauthorizedClient, "the client may not use this grant type"))
+		return
+	}
+
+	var resp *models.OAuthTokenResponse
+
+	switch grant {
+	case oauth.GrantAuthorizationCode:
+		resp, oauthErr = h.grantAuthorizationCode(c, client)
+	case oauth.GrantRefreshToken:
+		resp, oauthErr = h.grantRefreshToken(c, client)
+	case oauth.GrantClientCredentials:
+		resp, oauthErr = h.grantClientCredentials(c, client)
+	}
+	if oauthErr != nil {
+		h.oauthError(c, oauthErr)
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, resp)
+}
+
+// Revoke Token godoc
+// @ID oauth_revoke
+// @Router /oauth/revoke [POST]
+// @Summary OAuth Revoke
+// @Description Ends the grant behind a refresh token or access token of the calling client, so none of its tokens work anymore. Unknown tokens are ignored as RFC 7009 asks. client_credentials access tokens cannot be revoked and simply expire.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Param token formData string true "token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 "Revoked or unknown"
+// @Response 400 {object} oauth.Error "Bad Request"
+// @Response 401 {object} oauth.Error "Invalid Client"
+func (h *Handler) RevokeToken(c *gin.Context) {
+
+	client, oauthErr := h.authenticateClient(c)
+	if oauthErr != nil {
+		h.oauthError(c, oauthErr)
+		return
+	}
+
+	token := c.PostForm("token")
+	if len(token) <= 0 {
+		h.oauthError(c, oauth.NewError(oauth.ErrInvalidRequest, "token is required"))
+		return
+	}
+
+	if userID, sessionID, ok := h.grantOfToken(c, client, token); ok {
+		_, err := h.storages.Session().Revoke(c.Request.Context(), &models.SessionPrimaryKey{Id: sessionID, UserID: userID})
+		if err != nil {
+			h.log(c).Error("storage.session.revoke", logger.Error(err))
+			h.oauthError(c, oauth.NewError(oauth.ErrServerError, ""))
+			return
+		}
+
+		h.recordAudit(c, &models.CreateAuditEvent{
+			Action:     audit.ActionSessionRevoke,
+			ActorID:    userID,
+			TargetType: audit.TargetSession,
+			TargetID:   sessionID,
+		})
+	}
+
+	noStore(c)
+	c.Status(http.StatusOK)
+}
+
+// Introspect Token godoc
+// @ID oauth_introspect
+// @Router /oauth/introspect [POST]
+// @Summary OAuth Introspect
+// @Description Tells a confidential client whether a token is active. Any access token of this service can be introspected; refresh tokens only by the client they were issued to.
+// @Tags OAuth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "token"
+// @Param token_type_hint formData string false "access_token or refresh_token"
+// @Success 200 {object} models.OAuthIntrospectResponse "Token State"
+// @Response 400 {object} oauth.Error "Bad Request"
+// @Response 401 {object} oauth.Error "Invalid Client"
+func (h *Handler) IntrospectToken(c *gin.Context) {
+
+	client, oauthErr := h.authenticateClient(c)
+	if oauthErr != nil {
+		h.oauthError(c, oauthErr)
+		return
+	}
+	if client.Public {
+		h.oauthError(c, oauth.NewError(oauth.ErrInvalidClient, "public clients cannot introspect tokens"))
+		return
+	}
+
+	token := c.PostForm("token")
+	if len(token) <= 0 {
+		h.oauthError(c, oauth.NewError(oauth.ErrInvalidRequest, "token is required"))
+		return
+	}
+
+	resp := models.OAuthIntrospectResponse{}
+
+	if info, err := h.tokens.Verify(token); err == nil {
+		if _, ok := h.sessionActive(c, info); ok {
+			sub := info.UserID
+			if len(sub) <= 0 {
+				sub = info.ClientID
+			}
+			resp = models.OAuthIntrospectResponse{
+				Active:    true,
+				Scope:     info.Scope,
+				ClientID:  info.ClientID,
+				TokenType: oauth.TokenTypeBearer,
+				Exp:       info.ExpiresAt.Unix(),
+				Sub:       sub,
+				Iss:       h.cfg.AuthIssuer,
+			}
+		}
+	} else if refresh, err := h.storages.OAuth().GetRefreshToken(c.Request.Context(), &models.OAuthRefreshTokenPrimaryKey{TokenHash: oauth.HashToken(token)}); err == nil {
+		if refresh.Active && refresh.ClientID == client.Id {
+			resp = models.OAuthIntrospectResponse{
+				Active:    true,
+				Scope:     refresh.Scope,
+				ClientID:  refresh.ClientID,
+				TokenType: oauth.TokenTypeRefresh,
+				Exp:       refresh.ExpiresAt,
+				Sub:       refresh.UserID,
+				Iss:       h.cfg.AuthIssuer,
+			}
+		}
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseAuthorizeRequest checks the client and redirect uri of an authorization
+// request, returning err when they are wrong and the error cannot be sent to
+// the client, and then the remaining parameters, returning redirectErr for the
+// client.
+func (h *Handler) parseAuthorizeRequest(c *gin.Context) (req *authorizeRequest, redirectErr *oauth.Error, err error) {
+	param := c.Query
+	if c.Request.Method == http.MethodPost {
+		param = c.PostForm
+	}
+
+	client, err := h.storages.OAuth().GetClient(c.Request.Context(), &models.OAuthClientPrimaryKey{Id: param("client_id")})
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, nil, errors.New("unknown client")
+		}
+		return nil, nil, err
+	}
+
+	redirectURI := param("redirect_uri")
+	if len(redirectURI) <= 0 && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !oauth.HasScope(client.RedirectURIs, redirectURI) {
+		return nil, nil, errors.New("redirect_uri is not registered for this client")
+	}
+
+	req = &authorizeRequest{
+		Client:              client,
+		RedirectURI:         redirectURI,
+		State:               param("state"),
+		CodeChallenge:       param("code_challenge"),
+		CodeChallengeMethod: param("code_challenge_method"),
+		Nonce:               param("nonce"),
+	}
+
+	switch {
+	case param("response_type") != oauth.ResponseTypeCode:
+		return req, oauth.NewError(oauth.ErrUnsupportedResponseType, "response_type must be code"), nil
+	case !oauth.HasScope(client.GrantTypes, oauth.GrantAuthorizationCode):
+		return req, oauth.NewError(oauth.ErrUnauthorizedClient, "the client may not use the authorization_code grant"), nil
+	case len(req.CodeChallenge) <= 0 || req.CodeChallengeMethod != oauth.ChallengeS256:
+		return req, oauth.NewError(oauth.ErrInvalidRequest, "PKCE with code_challenge_method S256 is required"), nil
+	}
+
+	scopes := oauth.ParseScope(param("scope"))
+	if len(scopes) <= 0 {
+		scopes = client.Scopes
+	}
+	if !oauth.ScopeAllowed(scopes, client.Scopes) {
+		return req, oauth.NewError(oauth.ErrInvalidScope, "the client may not request this scope"), nil
+	}
+	// relying parties cannot check an ID token signed with our HS256 secret
+	if oauth.HasScope(scopes, oidc.ScopeOpenID) && h.cfg.AuthSigningAlg == tokens.AlgHS256 {
+		return req, oauth.NewError(oauth.ErrInvalidScope, "openid needs AUTH_SIGNING_ALG RS256 or EdDSA"), nil
+	}
+	req.Scope = oauth.FormatScope(scopes)
+
+	return req, nil, nil
+}
+
+// redirectAuthorize sends the browser back to the client with params and the state.
+func (h *Handler) redirectAuthorize(c *gin.Context, req *authorizeRequest, params url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		h.handlerResponse(c, "oauth authorize", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && len(values[0]) > 0 {
+			query.Set(key, values[0])
+		}
+	}
+	if len(req.State) > 0 {
+		query.Set("state", req.State)
+	}
+	u.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, u.String())
+}
+
+// renderConsent shows the consent page with a form token bound to the signed
+// in user, or to the client when the form asks for a login.
+func (h *Handler) renderConsent(c *gin.Context, code int, req *authorizeRequest, user *models.User, message string) {
+	subject := req.Client.Id
+	if user != nil {
+		subject = user.Id
+	}
+
+	consentToken, err := h.links.Sign(tokens.PurposeOAuthConsent, subject, "", consentTTL)
+	if err != nil {
+		h.handlerResponse(c, "oauth authorize", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var providers []providerLink
+	if user == nil {
+		returnTo := url.QueryEscape(authorizeURL(req))
+		for _, name := range oidc.Names(h.providers) {
+			providers = append(providers, providerLink{Name: name, URL: "/login/" + name + "?return_to=" + returnTo})
+		}
+	}
+
+	c.Header("X-Frame-Options", "DENY")
+	noStore(c)
+	c.Render(code, render.HTML{
+		Template: consentPage,
+		Data: consentView{
+			authorizeRequest: req,
+			Scopes:           oauth.ParseScope(req.Scope),
+			User:             user,
+			Providers:        providers,
+			ConsentToken:     consentToken,
+			Error:            message,
+		},
+	})
+}
+
+// authorizeURL is the path of the consent page for req.
+func authorizeURL(req *authorizeRequest) string {
+	params := url.Values{
+		"response_type":         {oauth.ResponseTypeCode},
+		"client_id":             {req.Client.Id},
+		"redirect_uri":          {req.RedirectURI},
+		"scope":                 {req.Scope},
+		"code_challenge":        {req.CodeChallenge},
+		"code_challenge_method": {req.CodeChallengeMethod},
+	}
+	if len(req.State) > 0 {
+		params.Set("state", req.State)
+	}
+	if len(req.Nonce) > 0 {
+		params.Set("nonce", req.Nonce)
+	}
+
+	return "/oauth/authorize?" + params.Encode()
+}
+
+// cookieUser returns the user of a valid login cookie, or nil.
+func (h *Handler) cookieUser(c *gin.Context) *models.User {
+	value, err := c.Cookie("token")
+	if err != nil {
+		return nil
+	}
+
+	info, err := h.tokens.Verify(value)
+	if err != nil || len(info.UserID) <= 0 || !h.checkSession(c, info) {
+		return nil
+	}
+
+	user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: info.UserID})
+	if err != nil {
+		return nil
+	}
+
+	return user
+}
+
+// authenticateClient identifies the client of a token, revoke or introspect
+// request by HTTP Basic or the client_id and client_secret fields. Public
+// clients send no secret.
+func (h *Handler) authenticateClient(c *gin.Context) (*models.OAuthClient, *oauth.Error) {
+	id, secret, basic := c.Request.BasicAuth()
+	if basic {
+		// RFC 6749 section 2.3.1 form-urlencodes both before joining them
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id = c.PostForm("client_id")
+		secret = c.PostForm("client_secret")
+	}
+
+	failed := oauth.NewError(oauth.ErrInvalidClient, "client authentication failed")
+	if len(id) <= 0 {
+		return nil, failed
+	}
+
+	client, err := h.storages.OAuth().GetClient(c.Request.Context(), &models.OAuthClientPrimaryKey{Id: id})
+	if err != nil {
+		return nil, failed
+	}
+
+	if client.Public {
+		if len(secret) > 0 {
+			return nil, failed
+		}
+	} else if !oauth.CheckTokenHash(secret, client.SecretHash) {
+		return nil, failed
+	}
+
+	return client, nil
+}
+
+func (h *Handler) grantAuthorizationCode(c *gin.Context, client *models.OAuthClient) (*models.OAuthTokenResponse, *oauth.Error) {
+	code, err := h.storages.OAuth().ConsumeCode(c.Request.Context(), &models.OAuthCodePrimaryKey{CodeHash: oauth.HashToken(c.PostForm("code"))})
+	if err != nil {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "the code is invalid, expired or already used")
+	}
+
+	if code.ClientID != client.Id {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "the code was issued to another client")
+	}
+	if redirectURI := c.PostForm("redirect_uri"); len(redirectURI) > 0 && redirectURI != code.RedirectURI {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !oauth.VerifyPKCE(c.PostForm("code_verifier"), code.CodeChallenge, code.CodeChallengeMethod) {
+		return nil, oauth.NewError(oauth.ErrInvalidGrant, "code_verifier does not match the code_challenge")
+	}
+
+	// the grant is a session of the user, listed and revoked like any other
+	sessionID, err := h.storages.Session().Create(c.Request.Context(), &models.CreateSession{
+		UserID:     code.UserID,
+		DeviceName: client.Name,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		TTL:        h.cfg.OAuthRefreshTokenTTL,
+	})
+	if err != nil {
+		h.log(c).Error("storage.session.create", logger.Error(err))
+		return nil, oauth.NewError(oauth.ErrServerError, "")
+	}
+
+	return h.issueOAuthTokens(c, client, code.UserID, sessionID, code.Scope, code.Nonce)
+}
+
+func (h *Handler) grantRefreshToken(c *gin.Context, client *models.OAuthClient) (*models.OAuthTokenResponse, *oauth.Error) {
+	key := &models.OAuthRefreshTokenPrimaryKey{TokenHash: oauth.HashToken(c.PostForm("refresh_token"))}
+	invalid := oauth.NewError(oauth.ErrInvalidGrant, "the refresh token is invalid or expired")
+
+	token, err := h.storages.OAuth().GetRefreshToken(c.Request.Context(), key)
+	if err != nil || token.ClientID != client.Id {
+		return nil, invalid
+	}
+	if token.Used {
+		h.revokeReusedGrant(c, token)
+		return nil, invalid
+	}
+	if !token.Active {
+		return nil, invalid
+	}
+
+	granted := oauth.ParseScope(token.Scope)
+	scopes := oauth.ParseScope(c.PostForm("scope"))
+	if len(scopes) <= 0 {
+		scopes = granted
+	}
+	if !oauth.ScopeAllowed(scopes, granted) {
+		return nil, oauth.NewError(oauth.ErrInvalidScope, "the scope exceeds the original grant")
+	}
+
+	rowsAffected, err := h.storages.OAuth().UseRefreshToken(c.Request.Context(), key)
+	if err != nil {
+		h.log(c).Error("storage.oauth.useRefreshToken", logger.Error(err))
+		return nil, oauth.NewError(oauth.ErrServerError, "")
+	}
+	if rowsAffected <= 0 {
+		h.revokeReusedGrant(c, token)
+		return nil, invalid
+	}
+
+	return h.issueOAuthTokens(c, client, token.UserID, token.SessionID, oauth.FormatScope(scopes), "")
+}
+
+func (h *Handler) grantClientCredentials(c *gin.Context, client *models.OAuthClient) (*models.OAuthTokenResponse, *oauth.Error) {
+	if client.Public {
+		return nil, oauth.NewError(oauth.ErrUnauthorizedClient, "public clients cannot use the client_credentials grant")
+	}
+
+	scopes := oauth.ParseScope(c.PostForm("scope"))
+	if len(scopes) <= 0 {
+		scopes = client.Scopes
+	}
+	if !oauth.ScopeAllowed(scopes, client.Scopes) {
+		return nil, oauth.NewError(oauth.ErrInvalidScope, "the client may not request this scope")
+	}
+
+	return h.issueOAuthTokens(c, client, "", "", oauth.FormatScope(scopes), "")
+}
+
+// issueOAuthTokens signs an access token and, for grants with a session and
+// clients allowed to refresh, creates a refresh token that ends with the session.
+// Grants of a user with the openid scope also get an ID token.
+func (h *Handler) issueOAuthTokens(c *gin.Context, client *models.OAuthClient, userID, sessionID, scope, nonce string) (*models.OAuthTokenResponse, *oauth.Error) {
+	ttl := h.cfg.OAuthAccessTokenTTL
+
+	accessToken, err := h.tokens.Issue(helper.TokenInfo{
+		UserID:    userID,
+		SessionID: sessionID,
+		ClientID:  client.Id,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		h.log(c).Error("issue token", logger.Error(err))
+		return nil, oauth.NewError(oauth.ErrServerError, "")
+	}
+
+	resp := &models.OAuthTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   oauth.TokenTypeBearer,
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       scope,
+	}
+
+	if len(sessionID) > 0 && oauth.HasScope(client.GrantTypes, oauth.GrantRefreshToken) {
+		refreshToken, err := oauth.GenerateToken()
+		if err != nil {
+			h.log(c).Error("generate refresh token", logger.Error(err))
+			return nil, oauth.NewError(oauth.ErrServerError, "")
+		}
+
+		_, err = h.storages.OAuth().CreateRefreshToken(c.Request.Context(), &models.CreateOAuthRefreshToken{
+			TokenHash: oauth.HashToken(refreshToken),
+			ClientID:  client.Id,
+			UserID:    userID,
+			SessionID: sessionID,
+			Scope:     scope,
+		})
+		if err != nil {
+			h.log(c).Error("storage.oauth.createRefreshToken", logger.Error(err))
+			return nil, oauth.NewError(oauth.ErrServerError, "")
+		}
+
+		resp.RefreshToken = refreshToken
+	}
+
+	if len(userID) > 0 && oauth.HasScope(oauth.ParseScope(scope), oidc.ScopeOpenID) {
+		info, err := h.userInfo(c, userID, scope)
+		if err != nil {
+			h.log(c).Error("user info", logger.Error(err))
+			return nil, oauth.NewError(oauth.ErrServerError, "")
+		}
+
+		resp.IDToken, err = h.tokens.IssueIDToken(helper.IDToken{
+			Audience:            client.Id,
+			Nonce:               nonce,
+			ExpiresAt:           time.Now().Add(ttl),
+			Subject:             info.Sub,
+			Name:                info.Name,
+			PhoneNumber:         info.PhoneNumber,
+			PhoneNumberVerified: info.PhoneNumberVerified,
+		})
+		if err != nil {
+			h.log(c).Error("issue id token", logger.Error(err))
+			return nil, oauth.NewError(oauth.ErrServerError, "")
+		}
+	}
+
+	return resp, nil
+}
+
+// revokeReusedGrant ends the session of a refresh token presented after it
+// was rotated: either the client or someone who stole the token is replaying it.
+func (h *Handler) revokeReusedGrant(c *gin.Context, token *models.OAuthRefreshToken) {
+	h.log(c).Warn("refresh token reused, revoking the grant",
+		logger.String("client_id", token.ClientID),
+		logger.String("session_id", token.SessionID),
+	)
+
+	_, err := h.storages.Session().Revoke(c.Request.Context(), &models.SessionPrimaryKey{Id: token.SessionID, UserID: token.UserID})
+	if err != nil {
+		h.log(c).Error("storage.session.revoke", logger.Error(err))
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionOAuthRefreshReuse,
+		ActorID:    token.UserID,
+		TargetType: audit.TargetSession,
+		TargetID:   token.SessionID,
+	})
+}
+
+// grantOfToken returns the user and session behind a refresh or access token
+// issued to client.
+func (h *Handler) grantOfToken(c *gin.Context, client *models.OAuthClient, token string) (userID, sessionID string, ok bool) {
+	refresh, err := h.storages.OAuth().GetRefreshToken(c.Request.Context(), &models.OAuthRefreshTokenPrimaryKey{TokenHash: oauth.HashToken(token)})
+	if err == nil {
+		return refresh.UserID, refresh.SessionID, refresh.ClientID == client.Id
+	}
+
+	info, err := h.tokens.Verify(token)
+	if err != nil || info.ClientID != client.Id || len(info.SessionID) <= 0 {
+		return "", "", false
+	}
+
+	return info.UserID, info.SessionID, true
+}
+
+// oauthError writes an RFC 6749 error body with the status its code calls for.
+func (h *Handler) oauthError(c *gin.Context, err *oauth.Error) {
+	code := http.StatusBadRequest
+	switch err.Code {
+	case oauth.ErrInvalidClient:
+		code = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	case oauth.ErrServerError:
+		code = http.StatusInternalServerError
+	}
+
+	h.log(c).Warn(c.FullPath(), logger.String("error", err.Error()))
+
+	noStore(c)
+	c.JSON(code, err)
+}
+
+// noStore keeps token responses out of caches.
+func noStore(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+}
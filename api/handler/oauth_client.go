@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/oauth"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Security ApiKeyAuth
+// Create OAuth Client godoc
+// @ID create_oauth_client
+// @Router /v1/admin/oauth/clients [POST]
+// @Summary Create OAuth Client
+// @Description Registers an app that logs users in through this service. Confidential clients get a client_secret which is shown only in this response; public clients (SPAs, mobile apps) get none and must use PKCE. grant_types defaults to authorization_code and refresh_token.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param client body models.CreateOAuthClient true "CreateOAuthClientRequest"
+// @Success 201 {object} Response{data=models.CreateOAuthClientResponse} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) CreateOAuthClient(c *gin.Context) {
+
+	var createClient models.CreateOAuthClient
+
+	err := bindJSON(c, &createClient)
+	if err != nil {
+		h.handlerResponse(c, "create oauth client", bindStatus(err), err.Error())
+		return
+	}
+
+	if err = oauth.ValidateClient(&createClient); err != nil {
+		h.handlerResponse(c, "create oauth client", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var secret string
+	if !createClient.Public {
+		secret, err = oauth.GenerateToken()
+		if err != nil {
+			h.handlerResponse(c, "generate client secret", http.StatusInternalServerError, err.Error())
+			return
+		}
+		createClient.SecretHash = oauth.HashToken(secret)
+	}
+
+	id, err := h.storages.OAuth().CreateClient(c.Request.Context(), &createClient)
+	if err != nil {
+		h.handlerResponse(c, "storage.oauth.createClient", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp, err := h.storages.OAuth().GetClient(c.Request.Context(), &models.OAuthClientPrimaryKey{Id: id})
+	if err != nil {
+		h.handlerResponse(c, "storage.oauth.getClient", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionOAuthClientCreate,
+		TargetType: audit.TargetClient,
+		TargetID:   id,
+		Changes:    audit.Diff(nil, resp),
+	})
+
+	h.handlerResponse(c, "create oauth client", http.StatusCreated, models.CreateOAuthClientResponse{Client: resp, ClientSecret: secret})
+}
+
+// @Security ApiKeyAuth
+// Get List OAuth Client godoc
+// @ID get_list_oauth_client
+// @Router /v1/admin/oauth/clients [GET]
+// @Summary Get List OAuth Client
+// @Description Get List OAuth Client, oldest first
+// @Tags Admin
+// @Produce json
+// @Param offset query string false "offset"
+// @Param limit query string false "limit"
+// @Success 200 {object} Response{data=models.GetListOAuthClientResponse} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) GetListOAuthClient(c *gin.Context) {
+
+	offset, err := h.getOffsetQuery(c.Query("offset"))
+	if err != nil {
+		h.handlerResponse(c, "get list oauth client", http.StatusBadRequest, "invalid offset")
+		return
+	}
+
+	limit, err := h.getLimitQuery(c.Query("limit"))
+	if err != nil {
+		h.handlerResponse(c, "get list oauth client", http.StatusBadRequest, "invalid limit")
+		return
+	}
+
+	resp, err := h.storages.OAuth().GetListClient(c.Request.Context(), &models.GetListOAuthClientRequest{
+		Offset: offset,
+		Limit:  limit,
+	})
+	if err != nil {
+		h.handlerResponse(c, "storage.oauth.getListClient", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.handlerResponse(c, "get list oauth client", http.StatusOK, resp)
+}
+
+// @Security ApiKeyAuth
+// Delete OAuth Client godoc
+// @ID delete_oauth_client
+// @Router /v1/admin/oauth/clients/{id} [DELETE]
+// @Summary Delete OAuth Client
+// @Description Deletes a client with its pending codes and refresh tokens. Access tokens already issued stay valid until they expire.
+// @Tags Admin
+// @Produce json
+// @Param id path string true "client_id"
+// @Success 204 {object} Response{data=string} "Success Request"
+// @Response 404 {object} Response{data=string} "Not Found"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) DeleteOAuthClient(c *gin.Context) {
+
+	id := c.Param("id")
+
+	rowsAffected, err := h.storages.OAuth().DeleteClient(c.Request.Context(), &models.OAuthClientPrimaryKey{Id: id})
+	if err != nil {
+		h.handlerResponse(c, "storage.oauth.deleteClient", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rowsAffected <= 0 {
+		h.handlerResponse(c, "storage.oauth.deleteClient", http.StatusNotFound, "client not found")
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionOAuthClientDelete,
+		TargetType: audit.TargetClient,
+		TargetID:   id,
+	})
+
+	h.handlerResponse(c, "delete oauth client", http.StatusNoContent, nil)
+}
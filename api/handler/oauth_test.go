@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/oauth"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testRedirectURI  = "http://client.test/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mJ92K9wE8KqHxFbGtwvqdXp0MnFLaQ"
+)
+
+var consentTokenInput = regexp.MustCompile(`name="consent_token" value="([^"]+)"`)
+
+// oauthTest is an authorization server on a memStore with a signed in user
+// and a public client which may use the code and refresh grants.
+type oauthTest struct {
+	store   *memStore
+	handler *Handler
+	router  *gin.Engine
+	browser *testClient
+	user    *models.User
+	client  *models.OAuthClient
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	t.Helper()
+
+	store := newMemStore()
+	user := store.addUser(models.User{Login: "alice"})
+	client := &models.OAuthClient{
+		Id:           "client-1",
+		Name:         "Client",
+		Public:       true,
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{"profile", "phone"},
+		GrantTypes:   []string{oauth.GrantAuthorizationCode, oauth.GrantRefreshToken},
+	}
+	store.clients[client.Id] = client
+	store.clients["service"] = &models.OAuthClient{
+		Id:         "service",
+		Name:       "Service",
+		SecretHash: oauth.HashToken("service-secret"),
+		Scopes:     []string{"profile"},
+		GrantTypes: []string{oauth.GrantClientCredentials},
+	}
+
+	cfg := testConfig()
+	cfg.OAuthCodeTTL = time.Minute
+	cfg.OAuthAccessTokenTTL = time.Hour
+	cfg.OAuthRefreshTokenTTL = 24 * time.Hour
+	h := newTestHandler(t, cfg, store, nil)
+
+	r := gin.New()
+	r.GET("/oauth/authorize", h.Authorize)
+	r.POST("/oauth/authorize", h.AuthorizeDecision)
+	r.POST("/oauth/token", h.Token)
+	r.GET("/userinfo", h.UserInfo)
+	r.GET("/v1/user/:id", h.AuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// the browser is signed in
+	sessionID, err := store.Session().Create(context.Background(), &models.CreateSession{UserID: user.Id, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := h.tokens.Issue(helper.TokenInfo{UserID: user.Id, SessionID: sessionID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	browser := newTestClient(r)
+	browser.cookies["token"] = token
+
+	return &oauthTest{store: store, handler: h, router: r, browser: browser, user: user, client: client}
+}
+
+// authorize approves the consent page for params and returns the query of
+// the redirect to the client.
+func (ot *oauthTest) authorize(t *testing.T, params url.Values) url.Values {
+	t.Helper()
+
+	w := ot.browser.do(t, http.MethodGet, "/oauth/authorize?"+params.Encode(), nil)
+	if w.Code != http.StatusOK {
+		return redirectQuery(t, w)
+	}
+	match := consentTokenInput.FindStringSubmatch(w.Body.String())
+	if match == nil {
+		t.Fatalf("consent page without a consent_token: %s", w.Body)
+	}
+
+	form := url.Values{"consent_token": {match[1]}, "action": {"allow"}}
+	for key := range params {
+		form.Set(key, params.Get(key))
+	}
+
+	return redirectQuery(t, ot.browser.send(formRequest("/oauth/authorize", form)))
+}
+
+// authorizeParams are the parameters of a valid request of the client.
+func (ot *oauthTest) authorizeParams() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {ot.client.Id},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"code_challenge":        {oauth.S256Challenge(testCodeVerifier)},
+		"code_challenge_method": {oauth.ChallengeS256},
+	}
+}
+
+// token posts form to the token endpoint and decodes the answer into a token
+// response or an error.
+func (ot *oauthTest) token(t *testing.T, form url.Values) (int, models.OAuthTokenResponse, oauth.Error) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	ot.router.ServeHTTP(w, formRequest("/oauth/token", form))
+
+	var (
+		resp   models.OAuthTokenResponse
+		errObj oauth.Error
+	)
+	if w.Code == http.StatusOK {
+		decode(t, w, &resp)
+	} else {
+		decode(t, w, &errObj)
+	}
+
+	return w.Code, resp, errObj
+}
+
+// exchange trades code for tokens with verifier.
+func (ot *oauthTest) exchange(t *testing.T, code, verifier string) (int, models.OAuthTokenResponse, oauth.Error) {
+	t.Helper()
+
+	return ot.token(t, url.Values{
+		"grant_type":    {oauth.GrantAuthorizationCode},
+		"client_id":     {ot.client.Id},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	})
+}
+
+func (ot *oauthTest) refresh(t *testing.T, refreshToken string) (int, models.OAuthTokenResponse, oauth.Error) {
+	t.Helper()
+
+	return ot.token(t, url.Values{
+		"grant_type":    {oauth.GrantRefreshToken},
+		"client_id":     {ot.client.Id},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// get sends a GET with accessToken as a Bearer token.
+func (ot *oauthTest) get(target, accessToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	ot.router.ServeHTTP(w, req)
+
+	return w
+}
+
+func formRequest(target string, form url.Values) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return req
+}
+
+func redirectQuery(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("authorize = %d %s, want a redirect", w.Code, w.Body)
+	}
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(u.String(), testRedirectURI+"?") {
+		t.Fatalf("redirect to %q, want %s", w.Header().Get("Location"), testRedirectURI)
+	}
+
+	return u.Query()
+}
+
+func TestOAuthAuthorizationCode(t *testing.T) {
+	ot := newOAuthTest(t)
+
+	query := ot.authorize(t, ot.authorizeParams())
+	code := query.Get("code")
+	if len(code) <= 0 || query.Get("state") != "xyz" {
+		t.Fatalf("redirect query = %v, want a code and the state", query)
+	}
+
+	status, resp, errObj := ot.exchange(t, code, testCodeVerifier)
+	if status != http.StatusOK {
+		t.Fatalf("token = %d %+v", status, errObj)
+	}
+	if len(resp.AccessToken) <= 0 || len(resp.RefreshToken) <= 0 || resp.Scope != "profile" || resp.TokenType != oauth.TokenTypeBearer {
+		t.Fatalf("token response = %+v", resp)
+	}
+
+	info, err := ot.handler.tokens.Verify(resp.AccessToken)
+	if err != nil || info.UserID != ot.user.Id || info.ClientID != ot.client.Id || info.Scope != "profile" || len(info.SessionID) <= 0 {
+		t.Fatalf("access token = %+v, %v", info, err)
+	}
+
+	// a code is used once
+	status, _, errObj = ot.exchange(t, code, testCodeVerifier)
+	if status != http.StatusBadRequest || errObj.Code != oauth.ErrInvalidGrant {
+		t.Fatalf("token with a used code = %d %+v, want %s", status, errObj, oauth.ErrInvalidGrant)
+	}
+}
+
+func TestOAuthPKCE(t *testing.T) {
+	ot := newOAuthTest(t)
+
+	code := ot.authorize(t, ot.authorizeParams()).Get("code")
+	status, _, errObj := ot.exchange(t, code, "wrong-verifier-wrong-verifier-wrong-verifier")
+	if status != http.StatusBadRequest || errObj.Code != oauth.ErrInvalidGrant {
+		t.Fatalf("token with a wrong code_verifier = %d %+v, want %s", status, errObj, oauth.ErrInvalidGrant)
+	}
+
+	// the failed exchange used the code up
+	if status, _, _ = ot.exchange(t, code, testCodeVerifier); status != http.StatusBadRequest {
+		t.Fatalf("token after a failed exchange = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		change func(url.Values)
+	}{
+		{"no challenge", func(p url.Values) { p.Del("code_challenge") }},
+		{"plain", func(p url.Values) { p.Set("code_challenge_method", "plain") }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			params := ot.authorizeParams()
+			tt.change(params)
+
+			query := redirectQuery(t, ot.browser.do(t, http.MethodGet, "/oauth/authorize?"+params.Encode(), nil))
+			if query.Get("error") != oauth.ErrInvalidRequest || len(query.Get("code")) > 0 {
+				t.Fatalf("redirect query = %v, want %s", query, oauth.ErrInvalidRequest)
+			}
+		})
+	}
+}
+
+func TestOAuthRefreshTokenReuse(t *testing.T) {
+	ot := newOAuthTest(t)
+
+	_, first, _ := ot.exchange(t, ot.authorize(t, ot.authorizeParams()).Get("code"), testCodeVerifier)
+
+	status, second, errObj := ot.refresh(t, first.RefreshToken)
+	if status != http.StatusOK || len(second.RefreshToken) <= 0 || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh = %d %+v %+v, want a new refresh token", status, second, errObj)
+	}
+
+	// the rotated token comes back: the whole grant ends
+	status, _, errObj = ot.refresh(t, first.RefreshToken)
+	if status != http.StatusBadRequest || errObj.Code != oauth.ErrInvalidGrant {
+		t.Fatalf("refresh with a used token = %d %+v, want %s", status, errObj, oauth.ErrInvalidGrant)
+	}
+
+	status, _, errObj = ot.refresh(t, second.RefreshToken)
+	if status != http.StatusBadRequest || errObj.Code != oauth.ErrInvalidGrant {
+		t.Fatalf("refresh with the latest token after a reuse = %d %+v, want %s", status, errObj, oauth.ErrInvalidGrant)
+	}
+	if w := ot.get("/userinfo", second.AccessToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("userinfo with an access token of the revoked grant = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if actions := ot.store.auditActions(); actions[len(actions)-1] != audit.ActionOAuthRefreshReuse {
+		t.Fatalf("audit = %v, want %s last", actions, audit.ActionOAuthRefreshReuse)
+	}
+}
+
+func TestOAuthAccessTokenOutsideUserInfo(t *testing.T) {
+	ot := newOAuthTest(t)
+
+	_, resp, _ := ot.exchange(t, ot.authorize(t, ot.authorizeParams()).Get("code"), testCodeVerifier)
+
+	status, service, errObj := ot.token(t, url.Values{
+		"grant_type":    {oauth.GrantClientCredentials},
+		"client_id":     {"service"},
+		"client_secret": {"service-secret"},
+	})
+	if status != http.StatusOK || len(service.RefreshToken) > 0 {
+		t.Fatalf("client_credentials = %d %+v %+v, want an access token only", status, service, errObj)
+	}
+
+	for name, token := range map[string]string{"authorization code": resp.AccessToken, "client credentials": service.AccessToken} {
+		t.Run(name, func(t *testing.T) {
+			if w := ot.get("/v1/user/"+ot.user.Id, token); w.Code != http.StatusForbidden {
+				t.Fatalf("GET /v1/user/:id = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+
+	// /userinfo takes the token and asks for the openid scope
+	w := ot.get("/userinfo", resp.AccessToken)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Header().Get("WWW-Authenticate"), "insufficient_scope") {
+		t.Fatalf("userinfo = %d %q, want insufficient_scope", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+}
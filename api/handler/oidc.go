@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/oauth"
+	"app/pkg/oidc"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenID Configuration godoc
+// @ID openid_configuration
+// @Router /.well-known/openid-configuration [GET]
+// @Summary OpenID Connect Discovery
+// @Description Endpoints and capabilities of the OpenID Connect provider. The issuer is PUBLIC_URL. The openid scope is only granted when tokens are signed with RS256 or EdDSA.
+// @Tags OAuth
+// @Produce json
+// @Success 200 {object} models.OpenIDConfiguration "Discovery Document"
+func (h *Handler) OpenIDConfiguration(c *gin.Context) {
+	base := h.cfg.PublicURL
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, models.OpenIDConfiguration{
+		Issuer:                            base,
+		AuthorizationEndpoint:             base + "/oauth/authorize",
+		TokenEndpoint:                     base + "/oauth/token",
+		UserinfoEndpoint:                  base + "/userinfo",
+		JwksURI:                           base + "/.well-known/jwks.json",
+		RevocationEndpoint:                base + "/oauth/revoke",
+		IntrospectionEndpoint:             base + "/oauth/introspect",
+		ScopesSupported:                   oidc.Scopes,
+		ResponseTypesSupported:            []string{oauth.ResponseTypeCode},
+		GrantTypesSupported:               []string{oauth.GrantAuthorizationCode, oauth.GrantRefreshToken, oauth.GrantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{h.cfg.AuthSigningAlg},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{oauth.ChallengeS256},
+		ClaimsSupported:                   oidc.Claims,
+	})
+}
+
+// User Info godoc
+// @ID userinfo
+// @Router /userinfo [GET]
+// @Summary OpenID Connect User Info
+// @Description Claims of the user an access token was issued for, as far as its scopes release them: name with profile, phone_number and phone_number_verified with phone. The token needs the openid scope.
+// @Tags OAuth
+// @Produce json
+// @Param Authorization header string true "Bearer access token"
+// @Success 200 {object} models.UserInfo "Claims"
+// @Response 401 {string} string "Invalid Token"
+// @Response 403 {string} string "Insufficient Scope"
+func (h *Handler) UserInfo(c *gin.Context) {
+
+	token, err := h.requestToken(c)
+	if err != nil {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	info, err := h.tokens.Verify(token)
+	valid := err == nil && len(info.UserID) > 0
+	if valid {
+		_, valid = h.sessionActive(c, info)
+	}
+	if !valid {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if !oauth.HasScope(oauth.ParseScope(info.Scope), oidc.ScopeOpenID) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	resp, err := h.userInfo(c, info.UserID, info.Scope)
+	if err != nil {
+		h.handlerResponse(c, "user info", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, resp)
+}
+
+// userInfo collects the claims of a user which scope releases.
+func (h *Handler) userInfo(c *gin.Context, userID, scope string) (*models.UserInfo, error) {
+	scopes := oauth.ParseScope(scope)
+
+	user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: userID})
+	if err != nil {
+		return nil, err
+	}
+
+	var phones []*models.Phone
+	if oauth.HasScope(scopes, oidc.ScopePhone) {
+		resp, err := h.storages.Phone().GetList(c.Request.Context(), &models.GetListPhoneRequest{UserID: userID, Limit: 100})
+		if err != nil {
+			return nil, err
+		}
+		phones = resp.Phones
+	}
+
+	return oidc.UserInfo(scopes, user, phones), nil
+}
@@ -0,0 +1,412 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/logger"
+	"app/pkg/metrics"
+	"app/pkg/notify"
+	"app/pkg/otp"
+	"app/storage"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInvalidCode     = errors.New("the code is invalid or expired")
+	errTooManyAttempts = errors.New("too many attempts, request a new code")
+)
+
+// Start OTP Login godoc
+// @ID start_otp_login
+// @Router /login/otp/start [POST]
+// @Summary Start OTP Login
+// @Description Sends a code by SMS to a phone number verified on an account, to be passed to /login/otp/verify within OTP_TTL. The response is the same whether or not the number is verified anywhere. A number gets a code at most every OTP_RESEND_INTERVAL and OTP_MAX_SENDS_PER_HOUR times an hour. Not served with SMS_SENDER=none.
+// @Tags Login
+// @Accept json
+// @Produce json
+// @Param login body models.StartOTPLogin true "StartOTPLoginRequest"
+// @Success 202 {object} Response{data=string} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 429 {object} Response{data=string} "Too Many Requests"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) StartOTPLogin(c *gin.Context) {
+
+	var req models.StartOTPLogin
+
+	err := bindJSON(c, &req)
+	if err != nil {
+		h.handlerResponse(c, "start otp login", bindStatus(err), err.Error())
+		return
+	}
+
+	phone, err := helper.NormalizePhone(req.Phone)
+	if err != nil {
+		h.handlerResponse(c, "start otp login", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	owner, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{Phone: phone})
+	if err != nil {
+		if err.Error() != "no rows in result set" {
+			h.handlerResponse(c, "storage.phone.getByPhone", http.StatusInternalServerError, err.Error())
+			return
+		}
+		owner = nil
+	}
+
+	if !h.sendCode(c, "start otp login", otp.PurposeLogin, phone, owner) {
+		return
+	}
+
+	h.handlerResponse(c, "start otp login", http.StatusAccepted, "if the number is verified on an account, a code was sent to it")
+}
+
+// Verify OTP Login godoc
+// @ID verify_otp_login
+// @Router /login/otp/verify [POST]
+// @Summary Verify OTP Login
+// @Description Logs in with the code sent by /login/otp/start, like /login. A code is used once and allows OTP_MAX_ATTEMPTS guesses; only the latest code sent to a number is accepted.
+// @Tags Login
+// @Accept json
+// @Produce json
+// @Param login body models.VerifyOTPLogin true "VerifyOTPLoginRequest"
+// @Success 201 {object} Response{data=string} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 401 {object} Response{data=string} "Unauthorized"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) VerifyOTPLogin(c *gin.Context) {
+
+	var req models.VerifyOTPLogin
+
+	err := bindJSON(c, &req)
+	if err != nil {
+		h.handlerResponse(c, "verify otp login", bindStatus(err), err.Error())
+		return
+	}
+
+	phone, err := helper.NormalizePhone(req.Phone)
+	if err != nil {
+		h.handlerResponse(c, "verify otp login", http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Code) <= 0 {
+		h.handlerResponse(c, "verify otp login", http.StatusBadRequest, "code is required")
+		return
+	}
+
+	code, err := h.checkCode(c, otp.PurposeLogin, phone, "", req.Code)
+	if err == nil {
+		err = h.checkCodeOwner(c, code, phone)
+	}
+	if errors.Is(err, errInvalidCode) || errors.Is(err, errTooManyAttempts) {
+		h.recordAudit(c, &models.CreateAuditEvent{
+			Action:     audit.ActionLoginFailed,
+			TargetType: audit.TargetLogin,
+			TargetID:   phone,
+		})
+		h.metrics.ObserveLogin(metrics.LoginFailure)
+		h.handlerResponse(c, "verify otp login", http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		h.handlerResponse(c, "verify otp login", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: code.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	token, err := h.startSession(c, user, req.DeviceName)
+	if err != nil {
+		h.handlerResponse(c, "start session", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.setCookie(c, "token", token, int(h.tokens.TTL().Seconds()), "/")
+	c.JSON(http.StatusCreated, nil)
+}
+
+// @Security ApiKeyAuth
+// Start Phone Verification godoc
+// @ID start_phone_verification
+// @Router /v1/user/phone/{id}/verification [POST]
+// @Summary Start Phone Verification
+// @Description Sends a code by SMS to one of the current user's phones, to be confirmed within OTP_TTL. A verified number can log in with /login/otp/start; a number is verified on one account at most. Not served with SMS_SENDER=none.
+// @Tags Phone
+// @Produce json
+// @Param id path string true "id"
+// @Success 202 {object} Response{data=string} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 404 {object} Response{data=string} "Not Found"
+// @Response 409 {object} Response{data=string} "Conflict"
+// @Response 429 {object} Response{data=string} "Too Many Requests"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) StartPhoneVerification(c *gin.Context) {
+
+	phone, number, ok := h.unverifiedPhone(c, "start phone verification")
+	if !ok {
+		return
+	}
+
+	_, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{Phone: number})
+	switch {
+	case err == nil:
+		h.handlerResponse(c, "start phone verification", http.StatusConflict, "the number is already verified on an account")
+		return
+	case err.Error() != "no rows in result set":
+		h.handlerResponse(c, "storage.phone.getByPhone", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.sendCode(c, "start phone verification", otp.PurposeVerifyPhone, number, phone) {
+		return
+	}
+
+	h.handlerResponse(c, "start phone verification", http.StatusAccepted, "code sent")
+}
+
+// @Security ApiKeyAuth
+// Confirm Phone Verification godoc
+// @ID confirm_phone_verification
+// @Router /v1/user/phone/{id}/verification/confirm [POST]
+// @Summary Confirm Phone Verification
+// @Description Verifies one of the current user's phones with the code sent to it. A code allows OTP_MAX_ATTEMPTS guesses. Changing the number later clears the verification.
+// @Tags Phone
+// @Accept json
+// @Produce json
+// @Param id path string true "id"
+// @Param code body models.VerifyPhoneRequest true "VerifyPhoneRequest"
+// @Success 200 {object} models.Phone "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 404 {object} Response{data=string} "Not Found"
+// @Response 409 {object} Response{data=string} "Conflict"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) ConfirmPhoneVerification(c *gin.Context) {
+
+	var req models.VerifyPhoneRequest
+
+	err := bindJSON(c, &req)
+	if err != nil {
+		h.handlerResponse(c, "confirm phone verification", bindStatus(err), err.Error())
+		return
+	}
+	if len(req.Code) <= 0 {
+		h.handlerResponse(c, "confirm phone verification", http.StatusBadRequest, "code is required")
+		return
+	}
+
+	phone, number, ok := h.unverifiedPhone(c, "confirm phone verification")
+	if !ok {
+		return
+	}
+
+	_, err = h.checkCode(c, otp.PurposeVerifyPhone, number, phone.Id, req.Code)
+	if errors.Is(err, errInvalidCode) || errors.Is(err, errTooManyAttempts) {
+		h.handlerResponse(c, "confirm phone verification", http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		h.handlerResponse(c, "confirm phone verification", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rowsAffected, err := h.storages.Phone().Verify(c.Request.Context(), &models.VerifyPhone{Id: phone.Id, Phone: phone.Phone})
+	if err != nil {
+		h.handlerResponse(c, "storage.phone.verify", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rowsAffected <= 0 {
+		h.handlerResponse(c, "confirm phone verification", http.StatusConflict, "the number changed or was verified on another account meanwhile")
+		return
+	}
+
+	resp, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{Id: phone.Id})
+	if err != nil {
+		h.handlerResponse(c, "storage.phone.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionPhoneVerify,
+		TargetType: audit.TargetPhone,
+		TargetID:   phone.Id,
+		Changes:    audit.Diff(phone, resp),
+	})
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// unverifiedPhone loads the phone in the id path parameter, which must belong
+// to the current user and not be verified yet, and its normalized number.
+// It writes the error response and returns false when there is none.
+func (h *Handler) unverifiedPhone(c *gin.Context, path string) (*models.Phone, string, bool) {
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return nil, "", false
+	}
+	userData := val.(helper.TokenInfo)
+
+	phone, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{Id: c.Param("id")})
+	if err != nil && err.Error() != "no rows in result set" {
+		h.handlerResponse(c, "storage.phone.getByID", http.StatusInternalServerError, err.Error())
+		return nil, "", false
+	}
+	if err != nil || phone.UserID != userData.UserID {
+		h.handlerResponse(c, path, http.StatusNotFound, "phone not found")
+		return nil, "", false
+	}
+
+	if phone.Verified {
+		h.handlerResponse(c, path, http.StatusBadRequest, "phone already verified")
+		return nil, "", false
+	}
+
+	number, err := helper.NormalizePhone(phone.Phone)
+	if err != nil {
+		h.handlerResponse(c, path, http.StatusBadRequest, err.Error())
+		return nil, "", false
+	}
+
+	return phone, number, true
+}
+
+// sendCode sends a new code for purpose by SMS to phone, a normalized number,
+// unless the number got too many codes lately. owner is the phone the code is
+// for. Without one nothing is sent, but an unusable code is still stored so
+// that unknown numbers count against the limits like known ones and the
+// responses do not tell them apart. It writes the error response and
+// returns false when no code was stored.
+func (h *Handler) sendCode(c *gin.Context, path, purpose, phone string, owner *models.Phone) bool {
+	ctx := c.Request.Context()
+
+	code, err := h.codes.Generate()
+	if err != nil {
+		h.handlerResponse(c, "generate otp", http.StatusInternalServerError, err.Error())
+		return false
+	}
+
+	create := &models.CreateOTPCode{
+		Purpose:        purpose,
+		Phone:          phone,
+		TTL:            h.cfg.OTPTTL,
+		ResendInterval: h.cfg.OTPResendInterval,
+		MaxPerHour:     h.cfg.OTPMaxSendsPerHour,
+	}
+	if owner != nil && len(owner.UserID) > 0 {
+		create.UserID = owner.UserID
+		create.PhoneID = owner.Id
+		create.CodeHash = h.codes.Hash(purpose, phone, code)
+	}
+
+	id, err := h.storages.OTP().Create(ctx, create)
+	switch {
+	case errors.Is(err, storage.ErrOTPResendInterval):
+		c.Header("Retry-After", fmt.Sprintf("%.0f", h.cfg.OTPResendInterval.Seconds()))
+		h.handlerResponse(c, path, http.StatusTooManyRequests, "a code was sent to this number moments ago, try again later")
+		return false
+	case errors.Is(err, storage.ErrOTPHourlyLimit):
+		h.handlerResponse(c, path, http.StatusTooManyRequests, "too many codes were sent to this number, try again later")
+		return false
+	case err != nil:
+		h.handlerResponse(c, "storage.otp.create", http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if len(create.CodeHash) <= 0 {
+		return true
+	}
+
+	body := fmt.Sprintf("%s is your login code. It expires in %s. Do not share it.", code, h.cfg.OTPTTL)
+	if purpose == otp.PurposeVerifyPhone {
+		body = fmt.Sprintf("%s is your code to verify this number. It expires in %s.", code, h.cfg.OTPTTL)
+	}
+
+	// a failed send is only logged so the response stays the same for every
+	// number; a new code can be requested after OTP_RESEND_INTERVAL
+	err = h.sms.SendSMS(ctx, &notify.SMS{To: phone, Body: body})
+	if err != nil {
+		h.log(c).Error("send sms", logger.String("otp_id", id), logger.Error(err))
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionOTPSend,
+		ActorID:    owner.UserID,
+		TargetType: audit.TargetPhone,
+		TargetID:   owner.Id,
+	})
+
+	return true
+}
+
+// checkCode matches code against the latest code sent to phone for purpose,
+// and to the phone phoneID unless it is empty. Every call counts as an
+// attempt; a matching code is used up and returned. It returns
+// errInvalidCode or errTooManyAttempts when the code is not accepted.
+func (h *Handler) checkCode(c *gin.Context, purpose, phone, phoneID, code string) (*models.OTPCode, error) {
+	ctx := c.Request.Context()
+
+	active, err := h.storages.OTP().GetActive(ctx, &models.OTPCodePrimaryKey{Purpose: purpose, Phone: phone})
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return nil, errInvalidCode
+		}
+		return nil, err
+	}
+	if len(phoneID) > 0 && active.PhoneID != phoneID {
+		return nil, errInvalidCode
+	}
+
+	rowsAffected, err := h.storages.OTP().Attempt(ctx, &models.AttemptOTPCode{Id: active.Id, MaxAttempts: h.cfg.OTPMaxAttempts})
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected <= 0 {
+		return nil, errTooManyAttempts
+	}
+
+	// codes of unknown numbers have no hash and never match
+	if !h.codes.Equal(active.CodeHash, purpose, phone, code) {
+		return nil, errInvalidCode
+	}
+
+	rowsAffected, err = h.storages.OTP().Consume(ctx, &models.OTPCodePrimaryKey{Id: active.Id})
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected <= 0 {
+		return nil, errInvalidCode
+	}
+
+	return active, nil
+}
+
+// checkCodeOwner makes sure the phone a login code was sent to is still
+// verified on the same account with the same number.
+func (h *Handler) checkCodeOwner(c *gin.Context, code *models.OTPCode, phone string) error {
+	if len(code.PhoneID) <= 0 {
+		return errInvalidCode
+	}
+
+	owner, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{Id: code.PhoneID})
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			return errInvalidCode
+		}
+		return err
+	}
+
+	number, err := helper.NormalizePhone(owner.Phone)
+	if err != nil || number != phone || !owner.Verified || owner.UserID != code.UserID {
+		return errInvalidCode
+	}
+
+	return nil
+}
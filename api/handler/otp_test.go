@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/notify"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testPhone = "+998901234567"
+
+// smsOutbox keeps the messages sent instead of sending them.
+type smsOutbox struct {
+	mu       sync.Mutex
+	messages []notify.SMS
+}
+
+func (o *smsOutbox) SendSMS(ctx context.Context, sms *notify.SMS) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, *sms)
+
+	return nil
+}
+
+// lastCode returns the code of the latest message, its first word.
+func (o *smsOutbox) lastCode(t *testing.T) string {
+	t.Helper()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.messages) <= 0 {
+		t.Fatal("no sms sent")
+	}
+
+	return strings.Fields(o.messages[len(o.messages)-1].Body)[0]
+}
+
+func (o *smsOutbox) count() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.messages)
+}
+
+// newOTPTest returns a client of the OTP login routes on store, which has a
+// user with testPhone verified, and the outbox of the codes sent.
+func newOTPTest(t *testing.T, store *memStore) (*testClient, *smsOutbox) {
+	t.Helper()
+
+	user := store.addUser(models.User{Login: "alice"})
+	store.phones["phone-1"] = &models.Phone{Id: "phone-1", UserID: user.Id, Phone: "+998 (90) 123-45-67", Verified: true}
+
+	cfg := testConfig()
+	cfg.OTPLength = 6
+	cfg.OTPTTL = 5 * time.Minute
+	cfg.OTPMaxAttempts = 3
+	cfg.OTPResendInterval = time.Minute
+	cfg.OTPMaxSendsPerHour = 3
+
+	outbox := &smsOutbox{}
+	h := newTestHandler(t, cfg, store, nil)
+	h.sms = outbox
+
+	r := gin.New()
+	r.POST("/login/otp/start", h.StartOTPLogin)
+	r.POST("/login/otp/verify", h.VerifyOTPLogin)
+
+	return newTestClient(r), outbox
+}
+
+func startOTP(t *testing.T, client *testClient, phone string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return client.do(t, http.MethodPost, "/login/otp/start", models.StartOTPLogin{Phone: phone})
+}
+
+func verifyOTP(t *testing.T, client *testClient, code string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	return client.do(t, http.MethodPost, "/login/otp/verify", models.VerifyOTPLogin{Phone: testPhone, Code: code})
+}
+
+func TestOTPLogin(t *testing.T) {
+	store := newMemStore()
+	client, outbox := newOTPTest(t, store)
+
+	if w := startOTP(t, client, testPhone); w.Code != http.StatusAccepted {
+		t.Fatalf("start = %d %s", w.Code, w.Body)
+	}
+	if outbox.count() != 1 || outbox.messages[0].To != testPhone {
+		t.Fatalf("sent %+v, want one sms to %s", outbox.messages, testPhone)
+	}
+	code := outbox.lastCode(t)
+
+	if w := verifyOTP(t, client, code); w.Code != http.StatusCreated || len(client.cookies["token"]) <= 0 {
+		t.Fatalf("verify = %d %s, want a login", w.Code, w.Body)
+	}
+
+	// a code is used once
+	if w := verifyOTP(t, client, code); w.Code != http.StatusUnauthorized {
+		t.Fatalf("verify again = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOTPLoginUnknownNumber(t *testing.T) {
+	store := newMemStore()
+	client, outbox := newOTPTest(t, store)
+
+	// the answer is that of a verified number, without an sms
+	if w := startOTP(t, client, "+998907654321"); w.Code != http.StatusAccepted {
+		t.Fatalf("start = %d %s", w.Code, w.Body)
+	}
+	if outbox.count() != 0 {
+		t.Fatalf("%d sms sent to an unknown number", outbox.count())
+	}
+
+	// and it counts against the limits all the same
+	if w := startOTP(t, client, "+998907654321"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("start again = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestOTPSendLimits(t *testing.T) {
+	store := newMemStore()
+	client, outbox := newOTPTest(t, store)
+
+	if w := startOTP(t, client, testPhone); w.Code != http.StatusAccepted {
+		t.Fatalf("start = %d %s", w.Code, w.Body)
+	}
+
+	w := startOTP(t, client, testPhone)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("start within OTP_RESEND_INTERVAL = %d, Retry-After %q, want %d after 60", w.Code, w.Header().Get("Retry-After"), http.StatusTooManyRequests)
+	}
+
+	for i := 1; i < 3; i++ {
+		store.advance(time.Minute + time.Second)
+		if w = startOTP(t, client, testPhone); w.Code != http.StatusAccepted {
+			t.Fatalf("start %d = %d %s", i+1, w.Code, w.Body)
+		}
+	}
+
+	store.advance(time.Minute + time.Second)
+	if w = startOTP(t, client, testPhone); w.Code != http.StatusTooManyRequests || len(w.Header().Get("Retry-After")) > 0 {
+		t.Fatalf("start over OTP_MAX_SENDS_PER_HOUR = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if outbox.count() != 3 {
+		t.Fatalf("%d sms sent, want 3", outbox.count())
+	}
+
+	// the first code leaves the hour
+	store.advance(time.Hour - 3*time.Minute)
+	if w = startOTP(t, client, testPhone); w.Code != http.StatusAccepted {
+		t.Fatalf("start an hour later = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestOTPCodeExpires(t *testing.T) {
+	store := newMemStore()
+	client, outbox := newOTPTest(t, store)
+
+	startOTP(t, client, testPhone)
+	store.advance(5*time.Minute + time.Second)
+
+	if w := verifyOTP(t, client, outbox.lastCode(t)); w.Code != http.StatusUnauthorized {
+		t.Fatalf("verify after OTP_TTL = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOTPAttemptLimit(t *testing.T) {
+	store := newMemStore()
+	client, outbox := newOTPTest(t, store)
+
+	startOTP(t, client, testPhone)
+	code := outbox.lastCode(t)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	for i := 0; i < 3; i++ {
+		if w := verifyOTP(t, client, wrong); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), errInvalidCode.Error()) {
+			t.Fatalf("guess %d = %d %s, want an invalid code", i+1, w.Code, w.Body)
+		}
+	}
+
+	// the right code comes too late
+	if w := verifyOTP(t, client, code); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), errTooManyAttempts.Error()) {
+		t.Fatalf("verify after OTP_MAX_ATTEMPTS = %d %s, want too many attempts", w.Code, w.Body)
+	}
+
+	actions := store.auditActions()
+	if len(actions) != 5 || actions[len(actions)-1] != audit.ActionLoginFailed {
+		t.Fatalf("audit = %v, want the send and four failed logins", actions)
+	}
+}
+
+func TestOTPLatestCodeOnly(t *testing.T) {
+	store := newMemStore()
+	client, outbox := newOTPTest(t, store)
+
+	startOTP(t, client, testPhone)
+	first := outbox.lastCode(t)
+
+	store.advance(time.Minute + time.Second)
+	startOTP(t, client, testPhone)
+	latest := outbox.lastCode(t)
+	if latest == first {
+		t.Skip("the two codes happen to be equal")
+	}
+
+	if w := verifyOTP(t, client, first); w.Code != http.StatusUnauthorized {
+		t.Fatalf("verify the earlier code = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := verifyOTP(t, client, latest); w.Code != http.StatusCreated {
+		t.Fatalf("verify the latest code = %d %s", w.Code, w.Body)
+	}
+}
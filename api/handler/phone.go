@@ -2,9 +2,8 @@ package handler
 
 import (
 	"app/api/models"
+	"app/pkg/audit"
 	"app/pkg/helper"
-	"context"
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -40,31 +39,38 @@ func (h *Handler) CreatePhone(c *gin.Context) {
 
 	var createPhone models.CreatePhone
 
-	err := c.ShouldBindJSON(&createPhone) // parse req body to given type struct
+	err := bindJSON(c, &createPhone) // parse req body to given type struct
 	if err != nil {
-		h.handlerResponse(c, "create phone", http.StatusBadRequest, err.Error())
+		h.handlerResponse(c, "create phone", bindStatus(err), err.Error())
 		return
 	}
 
 	createPhone.UserID = user_id
 
-	if len(createPhone.Phone) > 12 {
-		h.handlerResponse(c, "create phone", http.StatusBadRequest, "Invalid phone number")
+	if err = helper.ValidPhoneNumber(createPhone.Phone); err != nil {
+		h.handlerResponse(c, "create phone", http.StatusBadRequest, err.Error())
 		return
 	}
 
-	id, err := h.storages.Phone().Create(context.Background(), &createPhone)
+	id, err := h.storages.Phone().Create(c.Request.Context(), &createPhone)
 	if err != nil {
 		h.handlerResponse(c, "storage.phone.create", http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	resp, err := h.storages.Phone().GetByID(context.Background(), &models.PhonePrimaryKey{Id: id})
+	resp, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{Id: id})
 	if err != nil {
 		h.handlerResponse(c, "storage.phone.getByID", http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionPhoneCreate,
+		TargetType: audit.TargetPhone,
+		TargetID:   resp.Id,
+		Changes:    audit.Diff(nil, resp),
+	})
+
 	c.JSON(http.StatusCreated, resp)
 }
 
@@ -92,7 +98,7 @@ func (h *Handler) GetByIdPhone(c *gin.Context) {
 	
 	var id string = c.Param("id")
 
-	resp, err := h.storages.Phone().GetByID(context.Background(), &models.PhonePrimaryKey{
+	resp, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{
 		Id: id,
 	})
 	if err != nil {
@@ -144,14 +150,12 @@ func (h *Handler) GetListPhone(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.storages.Phone().GetList(context.Background(), &models.GetListPhoneRequest{
+	resp, err := h.storages.Phone().GetList(c.Request.Context(), &models.GetListPhoneRequest{
 		UserID: user_id,
 		Offset: offset,
 		Limit:  limit,
 		Search: c.Query("search"),
 	})
-	fmt.Println()
-	fmt.Println(c.Query("search"))
 	if err != nil {
 		h.handlerResponse(c, "storage.phone.getlist", http.StatusInternalServerError, err.Error())
 		return
@@ -192,16 +196,22 @@ func (h *Handler) UpdatePhone(c *gin.Context) {
 
 	id := c.Param("id")
 
-	err := c.ShouldBindJSON(&updatePhone)
+	err := bindJSON(c, &updatePhone)
 	if err != nil {
-		h.handlerResponse(c, "update phone", http.StatusBadRequest, err.Error())
+		h.handlerResponse(c, "update phone", bindStatus(err), err.Error())
 		return
 	}
 
 	updatePhone.Id = id
 	updatePhone.UserID = user_id
 
-	rowsAffected, err := h.storages.Phone().Update(context.Background(), &updatePhone)
+	before, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{Id: id})
+	if err != nil {
+		h.handlerResponse(c, "storage.phone.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rowsAffected, err := h.storages.Phone().Update(c.Request.Context(), &updatePhone)
 	if err != nil {
 		h.handlerResponse(c, "storage.phone.update", http.StatusInternalServerError, err.Error())
 		return
@@ -212,7 +222,7 @@ func (h *Handler) UpdatePhone(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.storages.Phone().GetByID(context.Background(), &models.PhonePrimaryKey{
+	resp, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{
 		Id:     id,
 	})
 	if err != nil {
@@ -220,6 +230,13 @@ func (h *Handler) UpdatePhone(c *gin.Context) {
 		return
 	}
 
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionPhoneUpdate,
+		TargetType: audit.TargetPhone,
+		TargetID:   id,
+		Changes:    audit.Diff(before, resp),
+	})
+
 	h.handlerResponse(c, "update phone", http.StatusAccepted, resp)
 }
 
@@ -249,7 +266,13 @@ func (h *Handler) DeletePhone(c *gin.Context) {
 
 	id := c.Param("id")
 
-	rowsAffected, err := h.storages.Phone().Delete(context.Background(), &models.PhonePrimaryKey{
+	before, err := h.storages.Phone().GetByID(c.Request.Context(), &models.PhonePrimaryKey{Id: id})
+	if err != nil {
+		h.handlerResponse(c, "storage.phone.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rowsAffected, err := h.storages.Phone().Delete(c.Request.Context(), &models.PhonePrimaryKey{
 		Id:     id,
 	})
 	if err != nil {
@@ -261,5 +284,12 @@ func (h *Handler) DeletePhone(c *gin.Context) {
 		return
 	}
 
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionPhoneDelete,
+		TargetType: audit.TargetPhone,
+		TargetID:   id,
+		Changes:    audit.Diff(before, nil),
+	})
+
 	h.handlerResponse(c, "delete phone", http.StatusNoContent, nil)
 }
@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/logger"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Security ApiKeyAuth
+// Get List Session godoc
+// @ID get_list_session
+// @Router /v1/user/me/sessions [GET]
+// @Summary Get List Session
+// @Description Lists the active sessions of the current user, most recently used first. The session of this request has current set.
+// @Tags Session
+// @Produce json
+// @Success 200 {object} Response{data=models.GetListSessionResponse} "Success Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) GetListSession(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	resp, err := h.storages.Session().GetList(c.Request.Context(), &models.GetListSessionRequest{UserID: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.session.getList", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, session := range resp.Sessions {
+		session.Current = session.Id == userData.SessionID
+	}
+
+	h.handlerResponse(c, "get list session", http.StatusOK, resp)
+}
+
+// @Security ApiKeyAuth
+// Revoke Session godoc
+// @ID revoke_session
+// @Router /v1/user/me/sessions/{id} [DELETE]
+// @Summary Revoke Session
+// @Description Revokes one session of the current user. Tokens of that session stop working at once.
+// @Tags Session
+// @Produce json
+// @Param id path string true "session id"
+// @Success 204 {object} Response{data=string} "Success Request"
+// @Response 404 {object} Response{data=string} "Not Found"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) RevokeSession(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	id := c.Param("id")
+	if !helper.IsValidUUID(id) {
+		h.handlerResponse(c, "revoke session", http.StatusNotFound, "session not found")
+		return
+	}
+
+	rowsAffected, err := h.storages.Session().Revoke(c.Request.Context(), &models.SessionPrimaryKey{Id: id, UserID: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.session.revoke", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rowsAffected <= 0 {
+		h.handlerResponse(c, "storage.session.revoke", http.StatusNotFound, "session not found")
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionSessionRevoke,
+		TargetType: audit.TargetSession,
+		TargetID:   id,
+	})
+
+	h.handlerResponse(c, "revoke session", http.StatusNoContent, nil)
+}
+
+// @Security ApiKeyAuth
+// Revoke Other Sessions godoc
+// @ID revoke_other_sessions
+// @Router /v1/user/me/sessions [DELETE]
+// @Summary Revoke Other Sessions
+// @Description Revokes every session of the current user except the one of this request.
+// @Tags Session
+// @Produce json
+// @Success 200 {object} Response{data=models.RevokeSessionsResponse} "Success Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) RevokeOtherSessions(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	rowsAffected, err := h.storages.Session().RevokeAll(c.Request.Context(), &models.RevokeSessions{
+		UserID:   userData.UserID,
+		ExceptID: userData.SessionID,
+	})
+	if err != nil {
+		h.handlerResponse(c, "storage.session.revokeAll", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionSessionRevokeOthers,
+		TargetType: audit.TargetUser,
+		TargetID:   userData.UserID,
+	})
+
+	h.handlerResponse(c, "revoke other sessions", http.StatusOK, models.RevokeSessionsResponse{Revoked: rowsAffected})
+}
+
+// checkSession rejects tokens of revoked or expired sessions and records the
+// session as seen, at most once per SESSION_TOUCH_INTERVAL. Tokens without a
+// session pass.
+func (h *Handler) checkSession(c *gin.Context, info helper.TokenInfo) bool {
+	session, ok := h.sessionActive(c, info)
+	if !ok || session == nil {
+		return ok
+	}
+
+	if h.touches.due(session.Id, time.Now()) {
+		_, err := h.storages.Session().Touch(c.Request.Context(), &models.TouchSession{
+			Id:        session.Id,
+			UserAgent: c.Request.UserAgent(),
+			IP:        c.ClientIP(),
+		})
+		if err != nil {
+			h.log(c).Error("touch session", logger.Error(err))
+		}
+	}
+
+	return true
+}
+
+// sessionActive returns the session of a token, reporting false when it is
+// revoked, expired or belongs to someone else. Tokens without a session are
+// active and have a nil session.
+func (h *Handler) sessionActive(c *gin.Context, info helper.TokenInfo) (*models.Session, bool) {
+	if len(info.SessionID) <= 0 {
+		return nil, true
+	}
+
+	session, err := h.storages.Session().GetByID(c.Request.Context(), &models.SessionPrimaryKey{Id: info.SessionID})
+	if err != nil || session.Revoked || session.UserID != info.UserID {
+		return nil, false
+	}
+
+	return session, true
+}
+
+// sessionTouches remembers when each session's last-seen time was last
+// written, so busy sessions are not written on every request. API keys use it
+// too; ids of both are UUIDs, so they never collide.
+type sessionTouches struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newSessionTouches(interval time.Duration) *sessionTouches {
+	return &sessionTouches{
+		interval: interval,
+		seen:     make(map[string]time.Time),
+	}
+}
+
+// due reports whether session id should be touched now, and if so assumes it is.
+func (t *sessionTouches) due(id string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if last, ok := t.seen[id]; ok && now.Sub(last) < t.interval {
+		return false
+	}
+
+	// forget stale entries so the map only holds recently active sessions
+	if len(t.seen) >= 10000 {
+		for key, last := range t.seen {
+			if now.Sub(last) >= t.interval {
+				delete(t.seen, key)
+			}
+		}
+	}
+
+	t.seen[id] = now
+	return true
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/helper"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionTest is a router with a session route behind AuthMiddleware, which
+// answers 200, and RevokeSession. Sessions are touched at most once a minute.
+type sessionTest struct {
+	h     *Handler
+	store *memStore
+	r     *gin.Engine
+}
+
+func newSessionTest(t *testing.T) *sessionTest {
+	t.Helper()
+
+	store := newMemStore()
+	cfg := testConfig()
+	cfg.SessionTouchInterval = time.Minute
+	h := newTestHandler(t, cfg, store, nil)
+
+	r := gin.New()
+	v1 := r.Group("/v1", h.AuthMiddleware())
+	v1.GET("/user/me/sessions", func(c *gin.Context) { c.Status(http.StatusOK) })
+	v1.DELETE("/user/me/sessions/:id", h.RevokeSession)
+
+	return &sessionTest{h: h, store: store, r: r}
+}
+
+// login opens a session of userID which ends after ttl and returns its token.
+func (st *sessionTest) login(t *testing.T, userID string, ttl time.Duration) (sessionID, token string) {
+	t.Helper()
+
+	sessionID, err := st.store.Session().Create(context.Background(), &models.CreateSession{UserID: userID, TTL: ttl})
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	token, err = st.h.tokens.Issue(helper.TokenInfo{UserID: userID, SessionID: sessionID})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	return sessionID, token
+}
+
+func (st *sessionTest) do(method, target, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	st.r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestCheckSession(t *testing.T) {
+	st := newSessionTest(t)
+	alice := st.store.addUser(models.User{Login: "alice1"})
+	bob := st.store.addUser(models.User{Login: "bob123"})
+
+	_, active := st.login(t, alice.Id, time.Hour)
+	revokedID, revoked := st.login(t, alice.Id, time.Hour)
+	st.store.Session().Revoke(context.Background(), &models.SessionPrimaryKey{Id: revokedID, UserID: alice.Id})
+	_, expiring := st.login(t, alice.Id, 10*time.Minute)
+
+	// a token naming a session of someone else
+	bobSessionID, _ := st.login(t, bob.Id, time.Hour)
+	foreign, _ := st.h.tokens.Issue(helper.TokenInfo{UserID: alice.Id, SessionID: bobSessionID})
+	unknown, _ := st.h.tokens.Issue(helper.TokenInfo{UserID: alice.Id, SessionID: "8c5a7a4e-1f2b-4c3d-9e8f-0a1b2c3d4e5f"})
+
+	st.store.advance(10 * time.Minute)
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+	}{
+		{"active", active, http.StatusOK},
+		{"revoked", revoked, http.StatusUnauthorized},
+		{"expired", expiring, http.StatusUnauthorized},
+		{"session of another user", foreign, http.StatusUnauthorized},
+		{"unknown session", unknown, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		if w := st.do(http.MethodGet, "/v1/user/me/sessions", tt.token); w.Code != tt.code {
+			t.Errorf("%s: %d %s, want %d", tt.name, w.Code, w.Body, tt.code)
+		}
+	}
+}
+
+func TestCheckSessionTouch(t *testing.T) {
+	st := newSessionTest(t)
+	user := st.store.addUser(models.User{Login: "alice1"})
+	sessionID, token := st.login(t, user.Id, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if w := st.do(http.MethodGet, "/v1/user/me/sessions", token); w.Code != http.StatusOK {
+			t.Fatalf("request %d = %d %s", i+1, w.Code, w.Body)
+		}
+	}
+
+	// within SESSION_TOUCH_INTERVAL the last-seen time is written once
+	st.store.mu.Lock()
+	defer st.store.mu.Unlock()
+	if got := st.store.touches[sessionID]; got != 1 {
+		t.Fatalf("%d touches for 3 requests, want 1", got)
+	}
+}
+
+func TestSessionTouchesDue(t *testing.T) {
+	touches := newSessionTouches(time.Minute)
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		id   string
+		at   time.Duration
+		want bool
+	}{
+		{"first request", "a", 0, true},
+		{"within the interval", "a", 30 * time.Second, false},
+		{"another session", "b", 30 * time.Second, true},
+		{"just before the interval", "a", time.Minute - time.Nanosecond, false},
+		{"after the interval", "a", time.Minute, true},
+		{"counted from the last touch", "a", time.Minute + 30*time.Second, false},
+	}
+
+	for _, tt := range tests {
+		if got := touches.due(tt.id, now.Add(tt.at)); got != tt.want {
+			t.Errorf("%s: due(%s, +%v) = %v, want %v", tt.name, tt.id, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	st := newSessionTest(t)
+	alice := st.store.addUser(models.User{Login: "alice1"})
+	bob := st.store.addUser(models.User{Login: "bob123"})
+	_, token := st.login(t, alice.Id, time.Hour)
+	otherID, other := st.login(t, alice.Id, time.Hour)
+	bobSessionID, _ := st.login(t, bob.Id, time.Hour)
+
+	tests := []struct {
+		name string
+		id   string
+		code int
+	}{
+		{"not a uuid", "1", http.StatusNotFound},
+		{"session of another user", bobSessionID, http.StatusNotFound},
+		{"own session", otherID, http.StatusNoContent},
+		{"already revoked", otherID, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		if w := st.do(http.MethodDelete, "/v1/user/me/sessions/"+tt.id, token); w.Code != tt.code {
+			t.Fatalf("%s: revoke = %d %s, want %d", tt.name, w.Code, w.Body, tt.code)
+		}
+	}
+
+	if w := st.do(http.MethodGet, "/v1/user/me/sessions", other); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked session = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
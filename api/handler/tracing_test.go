@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"app/pkg/logger"
+	"app/pkg/tracing"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a global tracer provider which keeps the spans in
+// memory. Call the returned function to read the spans ended so far.
+func recordSpans(t *testing.T) func() tracetest.SpanStubs {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider("test", exporter)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	return func() tracetest.SpanStubs {
+		if err := provider.ForceFlush(context.Background()); err != nil {
+			t.Fatalf("ForceFlush: %v", err)
+		}
+		return exporter.GetSpans()
+	}
+}
+
+// newTracingRouter serves routes behind TracingMiddleware. /v1/user/:id
+// opens a child span from the request context, as the storage layer does.
+func newTracingRouter() *gin.Engine {
+	h := &Handler{logger: logger.NewLogger("test", logger.LevelFatal)}
+
+	r := gin.New()
+	r.Use(h.TracingMiddleware())
+	r.GET("/v1/user/:id", func(c *gin.Context) {
+		_, span := tracing.Tracer().Start(c.Request.Context(), "storage.user.GetByID")
+		span.End()
+		c.Status(http.StatusOK)
+	})
+	r.GET("/fail/:code", func(c *gin.Context) {
+		switch c.Param("code") {
+		case "500":
+			c.Status(http.StatusInternalServerError)
+		default:
+			c.Status(http.StatusBadRequest)
+		}
+	})
+
+	return r
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	spans := recordSpans(t)
+	r := newTracingRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/user/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("request = %d", w.Code)
+	}
+
+	got := spans()
+	if len(got) != 2 {
+		t.Fatalf("%d spans, want the child span and the request span", len(got))
+	}
+	child, span := got[0], got[1]
+
+	if span.Name != "GET /v1/user/:id" || span.SpanKind != trace.SpanKindServer {
+		t.Fatalf("span = %q of kind %v, want GET /v1/user/:id of kind server", span.Name, span.SpanKind)
+	}
+
+	// the caller's trace continues
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		span.Parent.SpanID().String() != "00f067aa0ba902b7" || !span.Parent.IsRemote() {
+		t.Fatalf("span %s with parent %s, want a child of the traceparent", span.SpanContext.TraceID(), span.Parent.SpanID())
+	}
+	if child.Name != "storage.user.GetByID" || child.Parent.SpanID() != span.SpanContext.SpanID() {
+		t.Fatalf("child span %q with parent %s, want a child of the request span", child.Name, child.Parent.SpanID())
+	}
+
+	attrs := attribute.NewSet(span.Attributes...)
+	want := map[attribute.Key]attribute.Value{
+		"http.method":      attribute.StringValue("GET"),
+		"http.route":       attribute.StringValue("/v1/user/:id"),
+		"http.target":      attribute.StringValue("/v1/user/42"),
+		"http.status_code": attribute.IntValue(http.StatusOK),
+	}
+	for key, value := range want {
+		if got, _ := attrs.Value(key); got != value {
+			t.Errorf("%s = %v, want %v", key, got.Emit(), value.Emit())
+		}
+	}
+	if span.Status.Code != codes.Unset {
+		t.Errorf("status = %+v, want unset", span.Status)
+	}
+}
+
+func TestTracingMiddlewareStatus(t *testing.T) {
+	tests := []struct {
+		path   string
+		name   string
+		status codes.Code
+	}{
+		{"/fail/500", "GET /fail/:code", codes.Error},
+		{"/fail/400", "GET /fail/:code", codes.Unset},
+		{"/missing", "GET unmatched", codes.Unset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			spans := recordSpans(t)
+			r := newTracingRouter()
+
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			got := spans()
+			if len(got) != 1 {
+				t.Fatalf("%d spans, want 1", len(got))
+			}
+			span := got[0]
+			if span.Name != tt.name || span.Status.Code != tt.status {
+				t.Fatalf("span %q with status %v, want %q with %v", span.Name, span.Status.Code, tt.name, tt.status)
+			}
+			// without a traceparent the request starts a new trace
+			if span.Parent.IsValid() {
+				t.Fatalf("span has the parent %s", span.Parent.SpanID())
+			}
+		})
+	}
+}
@@ -2,8 +2,8 @@ package handler
 
 import (
 	"app/api/models"
+	"app/pkg/audit"
 	"app/pkg/helper"
-	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -26,28 +26,47 @@ func (h *Handler) CreateUser(c *gin.Context) {
 
 	var createUser models.CreateUser
 
-	err := c.ShouldBindJSON(&createUser) // parse req body to given type struct
+	err := bindJSON(c, &createUser) // parse req body to given type struct
 	if err != nil {
-		h.handlerResponse(c, "create user", http.StatusBadRequest, err.Error())
+		h.handlerResponse(c, "create user", bindStatus(err), err.Error())
 		return
 	}
-	if len(createUser.Login) < 6 || len(createUser.Password) < 6 {
-		h.handlerResponse(c, "register user", http.StatusBadRequest, "Login and Password length must be longer than 6")
+	if !h.checkNewPassword(c, "create user", "", createUser.Login, createUser.Name, createUser.Password) {
+		return
+	}
+	if !h.checkEmail(c, "create user", createUser.Email, "") {
+		return
+	}
+
+	createUser.Password, err = h.HashPassword(createUser.Password)
+	if err != nil {
+		h.handlerResponse(c, "hash password", http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	id, err := h.storages.User().Create(context.Background(), &createUser)
+	id, err := h.storages.User().Create(c.Request.Context(), &createUser)
 	if err != nil {
 		h.handlerResponse(c, "storage.user.create", http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	resp, err := h.storages.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: id})
+	resp, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: id})
 	if err != nil {
 		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionUserCreate,
+		TargetType: audit.TargetUser,
+		TargetID:   resp.Id,
+		Changes:    audit.Diff(nil, resp),
+	})
+
+	if len(resp.Email) > 0 {
+		_ = h.sendEmailVerification(c, resp)
+	}
+
 	c.JSON(http.StatusCreated, resp)
 }
 
@@ -66,22 +85,22 @@ func (h *Handler) CreateUser(c *gin.Context) {
 // @Failure 500 {object} Response{data=string} "Server Error"
 func (h *Handler) GetByIdUser(c *gin.Context) {
 
-	value, err := c.Cookie("token")
-	if err != nil {
-		c.String(http.StatusNotFound, " Cookie not found")
-		return
-	}
-
-	info, err := helper.ParseClaims(value, h.cfg.AuthSecretKey)
+	val, exists := c.Get("Auth")
 
-	if err != nil {
-		c.AbortWithError(http.StatusForbidden, err)
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
 		return
 	}
+	userData := val.(helper.TokenInfo)
 
-	id := info.UserID
+	var id string
+	if len(userData.UserID) > 0 {
+		id = userData.UserID
+	} else {
+		id = c.Param("id")
+	}
 
-	resp, err := h.storages.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: id})
+	resp, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: id})
 	if err != nil {
 		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
 		return
@@ -115,7 +134,7 @@ func (h *Handler) GetByNameUser(c *gin.Context) {
 
 	var name string = c.Param("name")
 
-	resp, err := h.storages.User().GetByID(context.Background(), &models.UserPrimaryKey{
+	resp, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{
 		Name:   name,
 		UserID: userData.UserID,
 	})
@@ -164,7 +183,7 @@ func (h *Handler) GetListUser(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.storages.User().GetList(context.Background(), &models.GetListUserRequest{
+	resp, err := h.storages.User().GetList(c.Request.Context(), &models.GetListUserRequest{
 		UserID: userData.UserID,
 		Offset: offset,
 		Limit:  limit,
@@ -211,20 +230,34 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		id = c.Param("id")
 	}
 
-	err := c.ShouldBindJSON(&updateUser)
+	err := bindJSON(c, &updateUser)
 	if err != nil {
-		h.handlerResponse(c, "update user", http.StatusBadRequest, err.Error())
+		h.handlerResponse(c, "update user", bindStatus(err), err.Error())
 		return
 	}
 
 	updateUser.Id = id
 
-	if len(updateUser.Login) < 6 || len(updateUser.Password) < 6 {
-		h.handlerResponse(c, "register user", http.StatusBadRequest, "Login and Password length must be longer than 6")
+	before, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: id})
+	if err != nil {
+		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if !h.checkNewPassword(c, "update user", before.Login, updateUser.Login, updateUser.Name, updateUser.Password) {
+		return
+	}
+	if !h.checkEmail(c, "update user", updateUser.Email, id) {
+		return
+	}
+
+	updateUser.Password, err = h.HashPassword(updateUser.Password)
+	if err != nil {
+		h.handlerResponse(c, "hash password", http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	rowsAffected, err := h.storages.User().Update(context.Background(), &updateUser)
+	rowsAffected, err := h.storages.User().Update(c.Request.Context(), &updateUser)
 	if err != nil {
 		h.handlerResponse(c, "storage.user.update", http.StatusInternalServerError, err.Error())
 		return
@@ -235,12 +268,23 @@ func (h *Handler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.storages.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: id})
+	resp, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: id})
 	if err != nil {
 		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionUserUpdate,
+		TargetType: audit.TargetUser,
+		TargetID:   id,
+		Changes:    audit.Diff(before, resp),
+	})
+
+	if emailChanged(before, resp) {
+		_ = h.sendEmailVerification(c, resp)
+	}
+
 	h.handlerResponse(c, "update user", http.StatusAccepted, resp)
 }
 
@@ -275,7 +319,13 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 		id = c.Param("id")
 	}
 
-	rowsAffected, err := h.storages.User().Delete(context.Background(), &models.UserPrimaryKey{Id: id})
+	before, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: id})
+	if err != nil {
+		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rowsAffected, err := h.storages.User().Delete(c.Request.Context(), &models.UserPrimaryKey{Id: id})
 	if err != nil {
 		h.handlerResponse(c, "storage.user.delete", http.StatusInternalServerError, err.Error())
 		return
@@ -285,5 +335,12 @@ func (h *Handler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionUserDelete,
+		TargetType: audit.TargetUser,
+		TargetID:   id,
+		Changes:    audit.Diff(before, nil),
+	})
+
 	h.handlerResponse(c, "delete user", http.StatusNoContent, nil)
 }
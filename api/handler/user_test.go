@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/helper"
+	"app/pkg/password"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUpdateUserLogin(t *testing.T) {
+	store := newMemStore()
+	// created before logins with "@" were refused
+	user := store.addUser(models.User{Name: "Alice", Login: "alice@old"})
+	cfg := testConfig()
+	cfg.PasswordHashAlg = password.AlgBcrypt
+	cfg.PasswordBcryptCost = bcrypt.MinCost
+	cfg.PasswordMinLength = 8
+	h := newTestHandler(t, cfg, store, nil)
+	h.policy, _ = password.NewPolicy(cfg)
+
+	r := gin.New()
+	r.PUT("/v1/user/:id", func(c *gin.Context) {
+		c.Set("Auth", helper.TokenInfo{UserID: user.Id})
+	}, h.UpdateUser)
+	client := newTestClient(r)
+
+	tests := []struct {
+		name  string
+		login string
+		code  int
+	}{
+		{"unchanged login with @", "alice@old", http.StatusAccepted},
+		{"new login with @", "alice@new", http.StatusBadRequest},
+		{"new login", "alice-new", http.StatusAccepted},
+		{"back to a login with @", "alice@old", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		update := models.UpdateUser{Name: "Alice", Login: tt.login, Password: "Tr0ub4dor&3-horse", Age: 30}
+		if w := client.do(t, http.MethodPut, "/v1/user/"+user.Id, update); w.Code != tt.code {
+			t.Fatalf("%s: update = %d %s, want %d", tt.name, w.Code, w.Body, tt.code)
+		}
+	}
+
+	updated, _ := store.User().GetByID(context.Background(), &models.UserPrimaryKey{Id: user.Id})
+	if updated.Login != "alice-new" {
+		t.Fatalf("login = %q, want alice-new", updated.Login)
+	}
+}
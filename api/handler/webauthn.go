@@ -0,0 +1,447 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/logger"
+	"app/pkg/metrics"
+	"app/pkg/oauth"
+	"app/pkg/tokens"
+	"app/pkg/webauthn"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// webAuthnCookie carries the challenge of a passkey ceremony from its
+	// begin to its finish request.
+	webAuthnCookie     = "webauthn"
+	webAuthnCookiePath = "/webauthn"
+
+	ceremonyRegister = "registration"
+	ceremonyLogin    = "login"
+
+	maxPasskeyNameLength = 100
+)
+
+// Begin WebAuthn Registration godoc
+// @ID begin_webauthn_registration
+// @Router /webauthn/register/begin [POST]
+// @Summary Begin Passkey Registration
+// @Description Returns the options to pass to navigator.credentials.create to add a passkey to the signed-in account, and a cookie with the challenge. Finish within WEBAUTHN_TIMEOUT.
+// @Tags WebAuthn
+// @Produce json
+// @Success 200 {object} models.BeginWebAuthnRegistrationResponse "Creation Options"
+// @Response 401 {object} Response{data=string} "Unauthorized"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) BeginWebAuthnRegistration(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	existing, err := h.storages.WebAuthn().GetList(c.Request.Context(), &models.GetListWebAuthnCredentialRequest{UserID: user.Id})
+	if err != nil {
+		h.handlerResponse(c, "storage.webAuthn.getList", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// the authenticator refuses to make a second passkey for the account
+	var exclude []webauthn.CredentialDescriptor
+	for _, credential := range existing.Credentials {
+		exclude = append(exclude, webauthn.CredentialDescriptor{Type: "public-key", ID: credential.CredentialID, Transports: credential.Transports})
+	}
+
+	challenge, ok := h.startCeremony(c, "begin webauthn registration", ceremonyRegister, user.Id)
+	if !ok {
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, models.BeginWebAuthnRegistrationResponse{
+		PublicKey: h.passkeys.CreationOptions(challenge, webauthn.User{ID: []byte(user.Id), Name: user.Login, DisplayName: user.Name}, exclude),
+	})
+}
+
+// Finish WebAuthn Registration godoc
+// @ID finish_webauthn_registration
+// @Router /webauthn/register/finish [POST]
+// @Summary Finish Passkey Registration
+// @Description Verifies the credential returned by navigator.credentials.create, in its toJSON form, and adds it to the signed-in account.
+// @Tags WebAuthn
+// @Accept json
+// @Produce json
+// @Param registration body models.FinishWebAuthnRegistration true "FinishWebAuthnRegistrationRequest"
+// @Success 201 {object} models.WebAuthnCredential "Passkey"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 401 {object} Response{data=string} "Unauthorized"
+// @Response 409 {object} Response{data=string} "Already Registered"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) FinishWebAuthnRegistration(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	var req models.FinishWebAuthnRegistration
+
+	err := bindJSON(c, &req)
+	if err != nil {
+		h.handlerResponse(c, "finish webauthn registration", bindStatus(err), err.Error())
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	switch {
+	case len(req.Name) <= 0:
+		req.Name = "Passkey"
+	case len(req.Name) > maxPasskeyNameLength:
+		h.handlerResponse(c, "finish webauthn registration", http.StatusBadRequest, "name is too long")
+		return
+	}
+
+	challenge, ok := h.finishCeremony(c, "finish webauthn registration", ceremonyRegister, userData.UserID)
+	if !ok {
+		return
+	}
+
+	credential, err := h.passkeys.VerifyRegistration(&req.Credential, challenge)
+	if err != nil {
+		h.handlerResponse(c, "finish webauthn registration", http.StatusBadRequest, err.Error())
+		return
+	}
+
+	_, err = h.storages.WebAuthn().GetByID(c.Request.Context(), &models.WebAuthnCredentialPrimaryKey{CredentialID: credential.ID})
+	switch {
+	case err == nil:
+		h.handlerResponse(c, "finish webauthn registration", http.StatusConflict, "this passkey is already registered")
+		return
+	case err.Error() != "no rows in result set":
+		h.handlerResponse(c, "storage.webAuthn.getByCredentialID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, err := h.storages.WebAuthn().Create(c.Request.Context(), &models.CreateWebAuthnCredential{
+		UserID:         userData.UserID,
+		Name:           req.Name,
+		CredentialID:   credential.ID,
+		PublicKey:      credential.PublicKey,
+		SignCount:      credential.SignCount,
+		AAGUID:         credential.AAGUID,
+		Transports:     credential.Transports,
+		BackupEligible: credential.BackupEligible,
+		BackedUp:       credential.BackedUp,
+	})
+	if err != nil {
+		h.handlerResponse(c, "storage.webAuthn.create", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp, err := h.storages.WebAuthn().GetByID(c.Request.Context(), &models.WebAuthnCredentialPrimaryKey{Id: id, UserID: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.webAuthn.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionPasskeyRegister,
+		TargetType: audit.TargetPasskey,
+		TargetID:   resp.Id,
+		Changes:    audit.Diff(nil, resp),
+	})
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// Begin WebAuthn Login godoc
+// @ID begin_webauthn_login
+// @Router /webauthn/login/begin [POST]
+// @Summary Begin Passkey Login
+// @Description Returns the options to pass to navigator.credentials.get, which lets the user pick any of their passkeys for this site, and a cookie with the challenge. Finish within WEBAUTHN_TIMEOUT.
+// @Tags WebAuthn
+// @Produce json
+// @Success 200 {object} models.BeginWebAuthnLoginResponse "Request Options"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) BeginWebAuthnLogin(c *gin.Context) {
+
+	challenge, ok := h.startCeremony(c, "begin webauthn login", ceremonyLogin, "")
+	if !ok {
+		return
+	}
+
+	noStore(c)
+	c.JSON(http.StatusOK, models.BeginWebAuthnLoginResponse{
+		PublicKey: h.passkeys.RequestOptions(challenge),
+	})
+}
+
+// Finish WebAuthn Login godoc
+// @ID finish_webauthn_login
+// @Router /webauthn/login/finish [POST]
+// @Summary Finish Passkey Login
+// @Description Verifies the credential returned by navigator.credentials.get, in its toJSON form, and logs its user in like /login. A signature counter which did not grow, as with a cloned authenticator, fails the login.
+// @Tags WebAuthn
+// @Accept json
+// @Produce json
+// @Param login body models.FinishWebAuthnLogin true "FinishWebAuthnLoginRequest"
+// @Success 201 {object} Response{data=string} "Success Request"
+// @Response 400 {object} Response{data=string} "Bad Request"
+// @Response 401 {object} Response{data=string} "Unauthorized"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) FinishWebAuthnLogin(c *gin.Context) {
+
+	var req models.FinishWebAuthnLogin
+
+	err := bindJSON(c, &req)
+	if err != nil {
+		h.handlerResponse(c, "finish webauthn login", bindStatus(err), err.Error())
+		return
+	}
+
+	challenge, ok := h.finishCeremony(c, "finish webauthn login", ceremonyLogin, "")
+	if !ok {
+		return
+	}
+
+	stored, err := h.storages.WebAuthn().GetByID(c.Request.Context(), &models.WebAuthnCredentialPrimaryKey{CredentialID: req.Credential.RawID})
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			h.webAuthnLoginFailed(c, base64.RawURLEncoding.EncodeToString(req.Credential.RawID), "unknown passkey")
+			return
+		}
+		h.handlerResponse(c, "storage.webAuthn.getByCredentialID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(req.Credential.Response.UserHandle) > 0 && string(req.Credential.Response.UserHandle) != stored.UserID {
+		h.webAuthnLoginFailed(c, stored.Id, "the passkey does not belong to this account")
+		return
+	}
+
+	assertion, err := h.passkeys.VerifyAssertion(&req.Credential, challenge, stored.PublicKey)
+	if errors.Is(err, webauthn.ErrVerification) {
+		h.webAuthnLoginFailed(c, stored.Id, err.Error())
+		return
+	}
+	if err != nil {
+		h.handlerResponse(c, "finish webauthn login", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Touch only stores a counter which grew, which also catches two logins
+	// racing with the same one
+	var rowsAffected int64
+	if webauthn.SignCountValid(stored.SignCount, assertion.SignCount) {
+		rowsAffected, err = h.storages.WebAuthn().Touch(c.Request.Context(), &models.TouchWebAuthnCredential{
+			Id:        stored.Id,
+			SignCount: assertion.SignCount,
+			BackedUp:  assertion.BackedUp,
+		})
+		if err != nil {
+			h.handlerResponse(c, "storage.webAuthn.touch", http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if rowsAffected <= 0 {
+		h.log(c).Warn("passkey signature counter did not grow, the authenticator may be cloned",
+			logger.String("passkey_id", stored.Id),
+			logger.Any("stored", stored.SignCount),
+			logger.Any("received", assertion.SignCount),
+		)
+		h.webAuthnLoginFailed(c, stored.Id, "the passkey's signature counter did not grow, it may have been cloned")
+		return
+	}
+
+	user, err := h.storages.User().GetByID(c.Request.Context(), &models.UserPrimaryKey{Id: stored.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.user.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	token, err := h.startSession(c, user, req.DeviceName)
+	if err != nil {
+		h.handlerResponse(c, "start session", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.setCookie(c, "token", token, int(h.tokens.TTL().Seconds()), "/")
+	c.JSON(http.StatusCreated, nil)
+}
+
+// @Security ApiKeyAuth
+// Get List Passkey godoc
+// @ID get_list_passkey
+// @Router /v1/user/me/passkeys [GET]
+// @Summary Get List Passkey
+// @Description Lists the passkeys of the current user, oldest first.
+// @Tags WebAuthn
+// @Produce json
+// @Success 200 {object} Response{data=models.GetListWebAuthnCredentialResponse} "Success Request"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) GetListPasskey(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	resp, err := h.storages.WebAuthn().GetList(c.Request.Context(), &models.GetListWebAuthnCredentialRequest{UserID: userData.UserID})
+	if err != nil {
+		h.handlerResponse(c, "storage.webAuthn.getList", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.handlerResponse(c, "get list passkey", http.StatusOK, resp)
+}
+
+// @Security ApiKeyAuth
+// Delete Passkey godoc
+// @ID delete_passkey
+// @Router /v1/user/me/passkeys/{id} [DELETE]
+// @Summary Delete Passkey
+// @Description Removes a passkey of the current user. It stays on the authenticator but can no longer log in.
+// @Tags WebAuthn
+// @Produce json
+// @Param id path string true "id"
+// @Success 204
+// @Response 404 {object} Response{data=string} "Not Found"
+// @Failure 500 {object} Response{data=string} "Server Error"
+func (h *Handler) DeletePasskey(c *gin.Context) {
+
+	val, exists := c.Get("Auth")
+	if !exists {
+		h.handlerResponse(c, "get id in token", http.StatusInternalServerError, "invalid token")
+		return
+	}
+	userData := val.(helper.TokenInfo)
+
+	key := &models.WebAuthnCredentialPrimaryKey{Id: c.Param("id"), UserID: userData.UserID}
+	if !helper.IsValidUUID(key.Id) {
+		h.handlerResponse(c, "delete passkey", http.StatusNotFound, "passkey not found")
+		return
+	}
+
+	before, err := h.storages.WebAuthn().GetByID(c.Request.Context(), key)
+	if err != nil {
+		if err.Error() == "no rows in result set" {
+			h.handlerResponse(c, "delete passkey", http.StatusNotFound, "passkey not found")
+			return
+		}
+		h.handlerResponse(c, "storage.webAuthn.getByID", http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rowsAffected, err := h.storages.WebAuthn().Delete(c.Request.Context(), key)
+	if err != nil {
+		h.handlerResponse(c, "storage.webAuthn.delete", http.StatusInternalServerError, err.Error())
+		return
+	}
+	if rowsAffected <= 0 {
+		h.handlerResponse(c, "delete passkey", http.StatusNotFound, "passkey not found")
+		return
+	}
+
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionPasskeyRemove,
+		TargetType: audit.TargetPasskey,
+		TargetID:   before.Id,
+		Changes:    audit.Diff(before, nil),
+	})
+
+	c.Status(http.StatusNoContent)
+}
+
+// startCeremony makes the challenge of a passkey ceremony and sets the
+// cookie which carries it, bound to userID when registering. It writes the
+// error response and returns false on failure.
+func (h *Handler) startCeremony(c *gin.Context, path, ceremony, userID string) ([]byte, bool) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		h.handlerResponse(c, path, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	cookie, err := h.links.SignState(tokens.PurposeWebAuthn, map[string]string{
+		"ceremony":  ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"user_id":   userID,
+	}, h.cfg.WebAuthnTimeout)
+	if err != nil {
+		h.handlerResponse(c, path, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	h.setCookie(c, webAuthnCookie, cookie, int(h.cfg.WebAuthnTimeout.Seconds()), webAuthnCookiePath)
+
+	return challenge, true
+}
+
+// finishCeremony clears the cookie set by startCeremony and returns its
+// challenge, if it is for ceremony and userID and was not used before. The
+// challenge is recorded as used on the server, as a client may keep the
+// cookie, and a captured response of an authenticator without a signature
+// counter would log in again. It writes the error response and returns false
+// otherwise.
+func (h *Handler) finishCeremony(c *gin.Context, path, ceremony, userID string) ([]byte, bool) {
+	value, _ := c.Cookie(webAuthnCookie)
+	h.setCookie(c, webAuthnCookie, "", -1, webAuthnCookiePath)
+
+	state, err := h.links.VerifyState(tokens.PurposeWebAuthn, value)
+	if err == nil && (state["ceremony"] != ceremony || state["user_id"] != userID) {
+		err = tokens.ErrInvalidToken
+	}
+	var challenge []byte
+	if err == nil {
+		challenge, err = base64.RawURLEncoding.DecodeString(state["challenge"])
+	}
+	if err != nil {
+		h.handlerResponse(c, path, http.StatusBadRequest, "the "+ceremony+" expired, start again")
+		return nil, false
+	}
+
+	rowsAffected, err := h.storages.WebAuthn().UseChallenge(c.Request.Context(), &models.UseWebAuthnChallenge{
+		ChallengeHash: oauth.HashToken(state["challenge"]),
+		TTL:           h.cfg.WebAuthnTimeout,
+	})
+	if err != nil {
+		h.handlerResponse(c, "storage.webAuthn.useChallenge", http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if rowsAffected <= 0 {
+		h.handlerResponse(c, path, http.StatusBadRequest, "the "+ceremony+" was already finished, start again")
+		return nil, false
+	}
+
+	return challenge, true
+}
+
+// webAuthnLoginFailed records a failed passkey login and writes the 401
+// response.
+func (h *Handler) webAuthnLoginFailed(c *gin.Context, targetID, message string) {
+	h.recordAudit(c, &models.CreateAuditEvent{
+		Action:     audit.ActionLoginFailed,
+		TargetType: audit.TargetPasskey,
+		TargetID:   targetID,
+	})
+	h.metrics.ObserveLogin(metrics.LoginFailure)
+	h.handlerResponse(c, "finish webauthn login", http.StatusUnauthorized, message)
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"app/api/models"
+	"app/pkg/audit"
+	"app/pkg/helper"
+	"app/pkg/webauthn/webauthntest"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newPasskeyRouter serves the passkey routes, with the registration and
+// deletion ones signed in as user.
+func newPasskeyRouter(h *Handler, user *models.User) *gin.Engine {
+	signedIn := func(c *gin.Context) {
+		c.Set("Auth", helper.TokenInfo{UserID: user.Id})
+	}
+
+	r := gin.New()
+	r.POST("/webauthn/register/begin", signedIn, h.BeginWebAuthnRegistration)
+	r.POST("/webauthn/register/finish", signedIn, h.FinishWebAuthnRegistration)
+	r.POST("/webauthn/login/begin", h.BeginWebAuthnLogin)
+	r.POST("/webauthn/login/finish", h.FinishWebAuthnLogin)
+	r.DELETE("/v1/user/me/passkeys/:id", signedIn, h.DeletePasskey)
+
+	return r
+}
+
+// registerPasskey adds a passkey of a to the signed-in user of r.
+func registerPasskey(t *testing.T, r http.Handler, a *webauthntest.Authenticator) {
+	t.Helper()
+
+	client := newTestClient(r)
+
+	w := client.do(t, http.MethodPost, "/webauthn/register/begin", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("register begin = %d %s", w.Code, w.Body)
+	}
+	var begin models.BeginWebAuthnRegistrationResponse
+	decode(t, w, &begin)
+
+	resp, err := a.Register(begin.PublicKey)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	w = client.do(t, http.MethodPost, "/webauthn/register/finish", models.FinishWebAuthnRegistration{Name: "Laptop", Credential: *resp})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register finish = %d %s", w.Code, w.Body)
+	}
+}
+
+// beginPasskeyLogin starts a login on a new client and returns the client
+// with the request finishing it, as signed by a.
+func beginPasskeyLogin(t *testing.T, r http.Handler, a *webauthntest.Authenticator) (*testClient, models.FinishWebAuthnLogin) {
+	t.Helper()
+
+	client := newTestClient(r)
+
+	w := client.do(t, http.MethodPost, "/webauthn/login/begin", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login begin = %d %s", w.Code, w.Body)
+	}
+	var begin models.BeginWebAuthnLoginResponse
+	decode(t, w, &begin)
+
+	resp, err := a.Login(begin.PublicKey)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	return client, models.FinishWebAuthnLogin{Credential: *resp}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1"})
+	r := newPasskeyRouter(newTestHandler(t, testConfig(), store, nil), user)
+
+	a := webauthntest.NewAuthenticator("http://app.test")
+	registerPasskey(t, r, a)
+
+	client, finish := beginPasskeyLogin(t, r, a)
+	w := client.do(t, http.MethodPost, "/webauthn/login/finish", finish)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("login finish = %d %s", w.Code, w.Body)
+	}
+	if len(client.cookies["token"]) <= 0 {
+		t.Fatal("login set no token cookie")
+	}
+	if _, ok := client.cookies[webAuthnCookie]; ok {
+		t.Fatal("login kept the challenge cookie")
+	}
+
+	actions := store.auditActions()
+	if len(actions) != 2 || actions[0] != audit.ActionPasskeyRegister || actions[1] != audit.ActionLogin {
+		t.Fatalf("audit actions = %v, want %s and %s", actions, audit.ActionPasskeyRegister, audit.ActionLogin)
+	}
+}
+
+func TestPasskeyLoginReplay(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1"})
+	r := newPasskeyRouter(newTestHandler(t, testConfig(), store, nil), user)
+
+	a := webauthntest.NewAuthenticator("http://app.test")
+	registerPasskey(t, r, a)
+
+	client, finish := beginPasskeyLogin(t, r, a)
+	challengeCookie := client.cookies[webAuthnCookie]
+
+	if w := client.do(t, http.MethodPost, "/webauthn/login/finish", finish); w.Code != http.StatusCreated {
+		t.Fatalf("login finish = %d %s", w.Code, w.Body)
+	}
+
+	// a client which kept the cookie sends the captured response again
+	replay := newTestClient(r)
+	replay.cookies[webAuthnCookie] = challengeCookie
+	if w := replay.do(t, http.MethodPost, "/webauthn/login/finish", finish); w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed login finish = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+	if len(replay.cookies["token"]) > 0 {
+		t.Fatal("the replayed login set a token cookie")
+	}
+}
+
+func TestPasskeyLoginWithoutChallenge(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1"})
+	r := newPasskeyRouter(newTestHandler(t, testConfig(), store, nil), user)
+
+	a := webauthntest.NewAuthenticator("http://app.test")
+	registerPasskey(t, r, a)
+
+	client, finish := beginPasskeyLogin(t, r, a)
+	delete(client.cookies, webAuthnCookie)
+
+	if w := client.do(t, http.MethodPost, "/webauthn/login/finish", finish); w.Code != http.StatusBadRequest {
+		t.Fatalf("login finish without the cookie = %d %s, want %d", w.Code, w.Body, http.StatusBadRequest)
+	}
+}
+
+func TestPasskeyCloneDetection(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1"})
+	r := newPasskeyRouter(newTestHandler(t, testConfig(), store, nil), user)
+
+	a := webauthntest.NewAuthenticator("http://app.test")
+	registerPasskey(t, r, a)
+	clone := a.Clone()
+
+	if client, finish := beginPasskeyLogin(t, r, a); client.do(t, http.MethodPost, "/webauthn/login/finish", finish).Code != http.StatusCreated {
+		t.Fatal("login with the original failed")
+	}
+
+	// the clone signs with the counter the original already used
+	client, finish := beginPasskeyLogin(t, r, clone)
+	if w := client.do(t, http.MethodPost, "/webauthn/login/finish", finish); w.Code != http.StatusUnauthorized {
+		t.Fatalf("login with the clone = %d %s, want %d", w.Code, w.Body, http.StatusUnauthorized)
+	}
+}
+
+func TestPasskeyLoginRace(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1"})
+	r := newPasskeyRouter(newTestHandler(t, testConfig(), store, nil), user)
+
+	a := webauthntest.NewAuthenticator("http://app.test")
+	registerPasskey(t, r, a)
+	clone := a.Clone()
+
+	// both sign with counter 1, each passes SignCountValid against the
+	// stored 0, and Touch lets only one of them through
+	clients := make([]*testClient, 2)
+	finishes := make([]models.FinishWebAuthnLogin, 2)
+	clients[0], finishes[0] = beginPasskeyLogin(t, r, a)
+	clients[1], finishes[1] = beginPasskeyLogin(t, r, clone)
+
+	codes := make([]int, 2)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = clients[i].do(t, http.MethodPost, "/webauthn/login/finish", finishes[i]).Code
+		}(i)
+	}
+	wg.Wait()
+
+	var created, unauthorized int
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusUnauthorized:
+			unauthorized++
+		}
+	}
+	if created != 1 || unauthorized != 1 {
+		t.Fatalf("racing logins = %v, want one %d and one %d", codes, http.StatusCreated, http.StatusUnauthorized)
+	}
+}
+
+func TestDeletePasskey(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser(models.User{Name: "Alice", Login: "alice1"})
+	r := newPasskeyRouter(newTestHandler(t, testConfig(), store, nil), user)
+
+	a := webauthntest.NewAuthenticator("http://app.test")
+	registerPasskey(t, r, a)
+
+	passkeys, _ := store.WebAuthn().GetList(context.Background(), &models.GetListWebAuthnCredentialRequest{UserID: user.Id})
+	id := passkeys.Credentials[0].Id
+
+	client := newTestClient(r)
+	for _, tt := range []struct {
+		name string
+		id   string
+		code int
+	}{
+		{"not a uuid", "1", http.StatusNotFound},
+		{"own passkey", id, http.StatusNoContent},
+		{"already deleted", id, http.StatusNotFound},
+	} {
+		if w := client.do(t, http.MethodDelete, "/v1/user/me/passkeys/"+tt.id, nil); w.Code != tt.code {
+			t.Fatalf("%s: delete = %d %s, want %d", tt.name, w.Code, w.Body, tt.code)
+		}
+	}
+
+	// the passkey logs in no more
+	client, finish := beginPasskeyLogin(t, r, a)
+	if w := client.do(t, http.MethodPost, "/webauthn/login/finish", finish); w.Code != http.StatusUnauthorized {
+		t.Fatalf("login with the deleted passkey = %d %s, want %d", w.Code, w.Body, http.StatusUnauthorized)
+	}
+}
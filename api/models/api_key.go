@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+type APIKey struct {
+	Id         string   `json:"id"`
+	UserID     string   `json:"user_id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"` // the start of the key, to tell keys apart
+	KeyHash    string   `json:"-"`
+	Scopes     []string `json:"scopes"`
+	Active     bool     `json:"-"` // not revoked and not expired
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  string   `json:"expires_at"`   // empty for keys which never expire
+	LastUsedAt string   `json:"last_used_at"` // empty for keys never used
+}
+
+// APIKeyPrimaryKey finds a key by Id of UserID, or else by Prefix.
+type APIKeyPrimaryKey struct {
+	Id     string `json:"id"`
+	UserID string `json:"user_id"`
+	Prefix string `json:"prefix"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 for a key which never expires
+}
+
+type CreateAPIKey struct {
+	UserID  string        `json:"user_id"`
+	Name    string        `json:"name"`
+	Prefix  string        `json:"prefix"`
+	KeyHash string        `json:"-"`
+	Scopes  []string      `json:"scopes"`
+	TTL     time.Duration `json:"ttl"` // 0 for a key which never expires
+}
+
+// CreateAPIKeyResponse carries the key, shown only once.
+type CreateAPIKeyResponse struct {
+	APIKey *APIKey `json:"api_key"`
+	Key    string  `json:"key"`
+}
+
+type GetListAPIKeyRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type GetListAPIKeyResponse struct {
+	Count   int       `json:"count"`
+	APIKeys []*APIKey `json:"api_keys"`
+}
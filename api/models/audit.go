@@ -0,0 +1,47 @@
+package models
+
+type AuditChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type AuditEvent struct {
+	Id         string                 `json:"id"`
+	Seq        int64                  `json:"seq"`
+	Action     string                 `json:"action"`
+	ActorID    string                 `json:"actor_id"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	Changes    map[string]AuditChange `json:"changes"`
+	IP         string                 `json:"ip"`
+	UserAgent  string                 `json:"user_agent"`
+	RequestID  string                 `json:"request_id"`
+	CreatedAt  string                 `json:"created_at"`
+}
+
+type CreateAuditEvent struct {
+	Action     string                 `json:"action"`
+	ActorID    string                 `json:"actor_id"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	Changes    map[string]AuditChange `json:"changes"`
+	IP         string                 `json:"ip"`
+	UserAgent  string                 `json:"user_agent"`
+	RequestID  string                 `json:"request_id"`
+}
+
+type GetListAuditRequest struct {
+	Action     string `json:"action"`
+	ActorID    string `json:"actor_id"`
+	TargetType string `json:"target_type"`
+	TargetID   string `json:"target_id"`
+	DateFrom   string `json:"date_from"`
+	DateTo     string `json:"date_to"`
+	Cursor     int64  `json:"cursor"`
+	Limit      int    `json:"limit"`
+}
+
+type GetListAuditResponse struct {
+	Events     []*AuditEvent `json:"events"`
+	NextCursor int64         `json:"next_cursor"`
+}
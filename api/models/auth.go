@@ -9,8 +9,9 @@ type Register struct {
 }
 
 type Login struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login      string `json:"login"` // login name or email
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name"` // optional, shown in the session list
 }
 
 type LoginResponse struct {
@@ -20,3 +21,10 @@ type LoginResponse struct {
 type RegisterResponse struct {
 	OK string `json:"ok"`
 }
+
+// CSRFToken is sent back in the Header of unsafe requests authenticated with
+// the login cookie.
+type CSRFToken struct {
+	Token  string `json:"csrf_token"`
+	Header string `json:"header"` // X-CSRF-Token
+}
@@ -0,0 +1,42 @@
+package models
+
+// UserIdentity links a user to an account at an upstream OpenID Connect provider.
+type UserIdentity struct {
+	Id          string `json:"id"`
+	UserID      string `json:"user_id"`
+	Provider    string `json:"provider"`
+	Subject     string `json:"subject"`
+	Email       string `json:"email"` // as last reported by the provider
+	CreatedAt   string `json:"created_at"`
+	LastLoginAt string `json:"last_login_at"`
+}
+
+// UserIdentityPrimaryKey finds an identity by Id, optionally only of UserID,
+// or else by Provider and Subject.
+type UserIdentityPrimaryKey struct {
+	Id       string `json:"id"`
+	UserID   string `json:"user_id"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+}
+
+type CreateUserIdentity struct {
+	UserID   string `json:"user_id"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+	Email    string `json:"email"`
+}
+
+type TouchUserIdentity struct {
+	Id    string `json:"id"`
+	Email string `json:"email"`
+}
+
+type GetListUserIdentityRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type GetListUserIdentityResponse struct {
+	Count      int             `json:"count"`
+	Identities []*UserIdentity `json:"identities"`
+}
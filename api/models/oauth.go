@@ -0,0 +1,109 @@
+package models
+
+import "time"
+
+type OAuthClient struct {
+	Id           string   `json:"client_id"`
+	Name         string   `json:"name"`
+	SecretHash   string   `json:"-"`
+	Public       bool     `json:"public"` // no secret, must use PKCE
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grant_types"`
+	CreatedAt    string   `json:"created_at"`
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+type OAuthClientPrimaryKey struct {
+	Id string `json:"client_id"`
+}
+
+type CreateOAuthClient struct {
+	Name         string   `json:"name"`
+	Public       bool     `json:"public"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	GrantTypes   []string `json:"grant_types"`
+	SecretHash   string   `json:"-"`
+}
+
+// CreateOAuthClientResponse carries the client secret, shown only once.
+type CreateOAuthClientResponse struct {
+	Client       *OAuthClient `json:"client"`
+	ClientSecret string       `json:"client_secret,omitempty"`
+}
+
+type GetListOAuthClientRequest struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+type GetListOAuthClientResponse struct {
+	Count   int            `json:"count"`
+	Clients []*OAuthClient `json:"clients"`
+}
+
+type OAuthCode struct {
+	ClientID            string `json:"client_id"`
+	UserID              string `json:"user_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Nonce               string `json:"nonce"` // OpenID Connect, copied into the ID token
+}
+
+type OAuthCodePrimaryKey struct {
+	CodeHash string `json:"code_hash"`
+}
+
+type CreateOAuthCode struct {
+	CodeHash string        `json:"code_hash"`
+	TTL      time.Duration `json:"ttl"`
+	OAuthCode
+}
+
+type OAuthRefreshToken struct {
+	Id        string `json:"id"`
+	ClientID  string `json:"client_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Scope     string `json:"scope"`
+	Used      bool   `json:"used"`
+	Active    bool   `json:"active"` // unused, unexpired and its session not revoked
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type OAuthRefreshTokenPrimaryKey struct {
+	TokenHash string `json:"token_hash"`
+}
+
+// CreateOAuthRefreshToken expires together with its session.
+type CreateOAuthRefreshToken struct {
+	TokenHash string `json:"token_hash"`
+	ClientID  string `json:"client_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Scope     string `json:"scope"`
+}
+
+// OAuthTokenResponse is the RFC 6749 section 5.1 token response.
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"` // when the scope has openid
+}
+
+// OAuthIntrospectResponse is the RFC 7662 introspection response.
+type OAuthIntrospectResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+}
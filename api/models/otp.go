@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// OTPCode is a one-time code sent by SMS. Only a hash of the code is stored.
+type OTPCode struct {
+	Id        string `json:"id"`
+	Purpose   string `json:"purpose"`
+	Phone     string `json:"phone"`    // normalized number the code was sent to
+	UserID    string `json:"user_id"`  // empty when the number belongs to no one
+	PhoneID   string `json:"phone_id"` // empty when the number belongs to no one
+	CodeHash  string `json:"-"`
+	Attempts  int    `json:"attempts"`
+	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type OTPCodePrimaryKey struct {
+	Id      string `json:"id"`
+	Purpose string `json:"purpose"`
+	Phone   string `json:"phone"`
+}
+
+// CreateOTPCode stores a code unless Phone got one in the last
+// ResendInterval, or MaxPerHour of them in the last hour.
+type CreateOTPCode struct {
+	Purpose        string        `json:"purpose"`
+	Phone          string        `json:"phone"`
+	UserID         string        `json:"user_id"`
+	PhoneID        string        `json:"phone_id"`
+	CodeHash       string        `json:"code_hash"`
+	TTL            time.Duration `json:"ttl"`
+	ResendInterval time.Duration `json:"resend_interval"` // 0 for none
+	MaxPerHour     int           `json:"max_per_hour"`
+}
+
+type AttemptOTPCode struct {
+	Id          string `json:"id"`
+	MaxAttempts int    `json:"max_attempts"`
+}
+
+type StartOTPLogin struct {
+	Phone string `json:"phone"`
+}
+
+type VerifyOTPLogin struct {
+	Phone      string `json:"phone"`
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name"` // optional, shown in the session list
+}
@@ -6,12 +6,14 @@ type Phone struct {
 	Phone       string `json:"phone"`
 	Description string `json:"description"`
 	IsFax       bool   `json:"is_fax"`
+	Verified    bool   `json:"verified"` // confirmed with a code sent to the number, which can then sign in
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
 }
 
 type PhonePrimaryKey struct {
-	Id     string `json:"id"`
+	Id    string `json:"id"`
+	Phone string `json:"phone"` // normalized number, looked up among verified phones when Id is empty
 }
 
 type CreatePhone struct {
@@ -40,3 +42,12 @@ type GetListPhoneResponse struct {
 	Count  int      `json:"count"`
 	Phones []*Phone `json:"Phones"`
 }
+
+type VerifyPhone struct {
+	Id    string `json:"id"`
+	Phone string `json:"phone"` // the number the code was sent to
+}
+
+type VerifyPhoneRequest struct {
+	Code string `json:"code"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+type Session struct {
+	Id         string `json:"id"`
+	UserID     string `json:"user_id"`
+	DeviceName string `json:"device_name"`
+	UserAgent  string `json:"user_agent"`
+	IP         string `json:"ip"`
+	Current    bool   `json:"current"`
+	Revoked    bool   `json:"-"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	ExpiresAt  string `json:"expires_at"`
+}
+
+type SessionPrimaryKey struct {
+	Id     string `json:"id"`
+	UserID string `json:"user_id"`
+}
+
+type CreateSession struct {
+	UserID     string        `json:"user_id"`
+	DeviceName string        `json:"device_name"`
+	UserAgent  string        `json:"user_agent"`
+	IP         string        `json:"ip"`
+	TTL        time.Duration `json:"ttl"`
+}
+
+type TouchSession struct {
+	Id        string `json:"id"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+}
+
+// RevokeSessions revokes every active session of UserID except ExceptID.
+type RevokeSessions struct {
+	UserID   string `json:"user_id"`
+	ExceptID string `json:"except_id"`
+}
+
+type GetListSessionRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type GetListSessionResponse struct {
+	Count    int        `json:"count"`
+	Sessions []*Session `json:"sessions"`
+}
+
+type RevokeSessionsResponse struct {
+	Revoked int64 `json:"revoked"`
+}
@@ -1,25 +1,37 @@
 package models
 
+const (
+	// RoleUser is the default role of every registered user.
+	RoleUser = "user"
+	// RoleAdmin grants access to the admin endpoints.
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	Id        string `json:"id"`
-	Name      string `json:"name"`
-	Login     string `json:"login"`
-	Password  string `json:"password"`
-	Age       int    `json:"age"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	Login         string `json:"login"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Password      string `json:"password"`
+	Age           int    `json:"age"`
+	Role          string `json:"role"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
 }
 
 type UserPrimaryKey struct {
-	Id    string `json:"id"`
-	Login string `json:"login"`
-	Name  string  `json:"name"`
-	UserID string 	`json:"user_id"`
+	Id     string `json:"id"`
+	Login  string `json:"login"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	UserID string `json:"user_id"`
 }
 
 type CreateUser struct {
 	Name     string `json:"name"`
 	Login    string `json:"login"`
+	Email    string `json:"email"`
 	Password string `json:"password"`
 	Age      int    `json:"age"`
 }
@@ -28,10 +40,27 @@ type UpdateUser struct {
 	Id       string `json:"id"`
 	Name     string `json:"name"`
 	Login    string `json:"login"`
+	Email    string `json:"email"`
 	Password string `json:"password"`
 	Age      int    `json:"age"`
 }
 
+type UpdateUserPassword struct {
+	Id       string `json:"id"`
+	Password string `json:"password"`
+}
+
+// VerifyUserEmail marks Email verified, unless the user changed it since the link was sent.
+type VerifyUserEmail struct {
+	Id    string `json:"id"`
+	Email string `json:"email"`
+}
+
+type UpdateUserRole struct {
+	Id   string `json:"id"`
+	Role string `json:"role"`
+}
+
 type GetListUserRequest struct {
 	UserID string `json:"user_id"`
 	Offset int    `json:"offset"`
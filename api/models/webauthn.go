@@ -0,0 +1,88 @@
+package models
+
+import (
+	"app/pkg/webauthn"
+	"time"
+)
+
+// WebAuthnCredential is a passkey a user can log in with.
+type WebAuthnCredential struct {
+	Id             string   `json:"id"`
+	UserID         string   `json:"user_id"`
+	Name           string   `json:"name"`
+	CredentialID   []byte   `json:"-"`
+	PublicKey      []byte   `json:"-"` // COSE_Key
+	SignCount      uint32   `json:"-"`
+	AAGUID         []byte   `json:"-"`
+	Transports     []string `json:"transports"`
+	BackupEligible bool     `json:"backup_eligible"` // a passkey which can be synced between devices
+	BackedUp       bool     `json:"backed_up"`
+	CreatedAt      string   `json:"created_at"`
+	LastUsedAt     string   `json:"last_used_at"` // empty for passkeys never used
+}
+
+// WebAuthnCredentialPrimaryKey finds a passkey by Id of UserID, or else by
+// CredentialID.
+type WebAuthnCredentialPrimaryKey struct {
+	Id           string `json:"id"`
+	UserID       string `json:"user_id"`
+	CredentialID []byte `json:"credential_id"`
+}
+
+type CreateWebAuthnCredential struct {
+	UserID         string   `json:"user_id"`
+	Name           string   `json:"name"`
+	CredentialID   []byte   `json:"credential_id"`
+	PublicKey      []byte   `json:"public_key"`
+	SignCount      uint32   `json:"sign_count"`
+	AAGUID         []byte   `json:"aaguid"`
+	Transports     []string `json:"transports"`
+	BackupEligible bool     `json:"backup_eligible"`
+	BackedUp       bool     `json:"backed_up"`
+}
+
+// TouchWebAuthnCredential records a login with the signature counter the
+// authenticator reported.
+type TouchWebAuthnCredential struct {
+	Id        string `json:"id"`
+	SignCount uint32 `json:"sign_count"`
+	BackedUp  bool   `json:"backed_up"`
+}
+
+// UseWebAuthnChallenge records the challenge of a finished ceremony, which
+// stays used until TTL passes.
+type UseWebAuthnChallenge struct {
+	ChallengeHash string        `json:"challenge_hash"`
+	TTL           time.Duration `json:"ttl"`
+}
+
+type GetListWebAuthnCredentialRequest struct {
+	UserID string `json:"user_id"`
+}
+
+type GetListWebAuthnCredentialResponse struct {
+	Count       int                   `json:"count"`
+	Credentials []*WebAuthnCredential `json:"credentials"`
+}
+
+// BeginWebAuthnRegistrationResponse holds the options to pass to
+// navigator.credentials.create.
+type BeginWebAuthnRegistrationResponse struct {
+	PublicKey *webauthn.CreationOptions `json:"publicKey"`
+}
+
+type FinishWebAuthnRegistration struct {
+	Name       string                        `json:"name"` // shown in the passkey list
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+// BeginWebAuthnLoginResponse holds the options to pass to
+// navigator.credentials.get.
+type BeginWebAuthnLoginResponse struct {
+	PublicKey *webauthn.RequestOptions `json:"publicKey"`
+}
+
+type FinishWebAuthnLogin struct {
+	DeviceName string                     `json:"device_name"` // optional, shown in the session list
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"app/config"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// apiCSP lets API responses and the consent page load nothing and not
+	// be framed.
+	apiCSP = "default-src 'none'; frame-ancestors 'none'; base-uri 'none'"
+	// swaggerCSP lets the swagger UI load its own files, including the inline
+	// script and style of its index page.
+	swaggerCSP = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'"
+)
+
+// securityHeadersMiddleware sets the security headers of every response.
+// Strict-Transport-Security goes out on https, served natively or, as
+// PUBLIC_URL says, behind a proxy. Responses default to Cache-Control:
+// no-store as they carry tokens, cookies or account data; the few public
+// documents set their own.
+func securityHeadersMiddleware(cfg *config.Config) gin.HandlerFunc {
+	var hsts string
+	if cfg.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+	behindHTTPS := strings.HasPrefix(cfg.PublicURL, "https://")
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		if len(hsts) > 0 && (c.Request.TLS != nil || behindHTTPS) {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+
+		if strings.HasPrefix(c.Request.URL.Path, "/swagger/") {
+			header.Set("Content-Security-Policy", swaggerCSP)
+		} else {
+			header.Set("Content-Security-Policy", apiCSP)
+			header.Set("Cache-Control", "no-store")
+		}
+
+		c.Next()
+	}
+}
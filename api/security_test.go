@@ -0,0 +1,122 @@
+package api
+
+import (
+	"app/config"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		publicURL string
+		tls       bool
+		path      string
+		hsts      string
+		csp       string
+		cache     string
+	}{
+		{"plain http", "http://localhost:8080", false, "/v1/user", "", apiCSP, "no-store"},
+		{"native https", "http://localhost:8080", true, "/v1/user", "max-age=31536000; includeSubDomains", apiCSP, "no-store"},
+		{"behind an https proxy", "https://app.example.com", false, "/v1/user", "max-age=31536000; includeSubDomains", apiCSP, "no-store"},
+		{"swagger", "http://localhost:8080", false, "/swagger/index.html", "", swaggerCSP, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(securityHeadersMiddleware(&config.Config{
+				PublicURL:             tt.publicURL,
+				HSTSMaxAge:            365 * 24 * time.Hour,
+				HSTSIncludeSubdomains: true,
+				ReferrerPolicy:        "no-referrer",
+			}))
+			r.GET("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			for header, want := range map[string]string{
+				"Strict-Transport-Security": tt.hsts,
+				"Content-Security-Policy":   tt.csp,
+				"Cache-Control":             tt.cache,
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           "DENY",
+				"Referrer-Policy":           "no-referrer",
+			} {
+				if got := w.Header().Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSecurityHeadersWithoutHSTS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(securityHeadersMiddleware(&config.Config{PublicURL: "https://app.example.com"}))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Header().Get("Strict-Transport-Security"); len(got) > 0 {
+		t.Fatalf("Strict-Transport-Security = %q with HSTS_MAX_AGE 0", got)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(bodyLimitMiddleware(16))
+	r.POST("/", func(c *gin.Context) {
+		var tooLarge *http.MaxBytesError
+		if _, err := io.ReadAll(c.Request.Body); errors.As(err, &tooLarge) {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		code    int
+	}{
+		{"at the limit", strings.Repeat("a", 16), false, http.StatusOK},
+		{"declared over the limit", strings.Repeat("a", 17), false, http.StatusRequestEntityTooLarge},
+		{"streamed over the limit", strings.Repeat("a", 17), true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		if tt.chunked {
+			// the length is unknown until the body is read
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.code {
+			t.Errorf("%s: %d, want %d", tt.name, w.Code, tt.code)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"app/api/models"
+	"app/pkg/oauth"
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+	"strings"
+)
+
+var clientHeader = []string{"CLIENT_ID", "NAME", "PUBLIC", "REDIRECT_URIS", "SCOPES", "GRANT_TYPES", "CREATED_AT"}
+
+func clientRow(client *models.OAuthClient) []string {
+	return []string{
+		client.Id,
+		client.Name,
+		strconv.FormatBool(client.Public),
+		strings.Join(client.RedirectURIs, ","),
+		strings.Join(client.Scopes, " "),
+		strings.Join(client.GrantTypes, ","),
+		client.CreatedAt,
+	}
+}
+
+// splitList splits a comma separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// clientCreate registers an OAuth client and prints its secret, which cannot
+// be shown again.
+func clientCreate(ctx context.Context, app *app, args []string) error {
+	var (
+		createClient                     models.CreateOAuthClient
+		redirectURIs, scopes, grantTypes string
+	)
+
+	fs := flag.NewFlagSet("client create", flag.ExitOnError)
+	fs.StringVar(&createClient.Name, "name", "", "client name, shown on the consent page")
+	fs.StringVar(&redirectURIs, "redirect-uri", "", "comma separated redirect uris")
+	fs.StringVar(&scopes, "scope", "", "space separated scopes the client may request")
+	fs.StringVar(&grantTypes, "grant", "", "comma separated grant types, authorization_code,refresh_token when empty")
+	fs.BoolVar(&createClient.Public, "public", false, "client without a secret, must use PKCE")
+	fs.Parse(args)
+
+	createClient.RedirectURIs = splitList(redirectURIs)
+	createClient.Scopes = oauth.ParseScope(scopes)
+	createClient.GrantTypes = splitList(grantTypes)
+
+	if err := oauth.ValidateClient(&createClient); err != nil {
+		return err
+	}
+
+	var secret string
+	if !createClient.Public {
+		var err error
+		secret, err = oauth.GenerateToken()
+		if err != nil {
+			return err
+		}
+		createClient.SecretHash = oauth.HashToken(secret)
+	}
+
+	id, err := app.store.OAuth().CreateClient(ctx, &createClient)
+	if err != nil {
+		return err
+	}
+
+	client, err := app.store.OAuth().GetClient(ctx, &models.OAuthClientPrimaryKey{Id: id})
+	if err != nil {
+		return err
+	}
+
+	resp := models.CreateOAuthClientResponse{Client: client, ClientSecret: secret}
+	return app.out.print(resp, append(clientHeader, "CLIENT_SECRET"), [][]string{append(clientRow(client), secret)})
+}
+
+func clientList(ctx context.Context, app *app, args []string) error {
+	var req models.GetListOAuthClientRequest
+
+	fs := flag.NewFlagSet("client list", flag.ExitOnError)
+	fs.IntVar(&req.Offset, "offset", 0, "offset")
+	fs.IntVar(&req.Limit, "limit", 10, "limit")
+	fs.Parse(args)
+
+	resp, err := app.store.OAuth().GetListClient(ctx, &req)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(resp.Clients))
+	for _, client := range resp.Clients {
+		rows = append(rows, clientRow(client))
+	}
+
+	return app.out.print(resp, clientHeader, rows)
+}
+
+func clientDelete(ctx context.Context, app *app, args []string) error {
+	var id string
+
+	fs := flag.NewFlagSet("client delete", flag.ExitOnError)
+	fs.StringVar(&id, "id", "", "client id")
+	fs.Parse(args)
+
+	client, err := app.store.OAuth().GetClient(ctx, &models.OAuthClientPrimaryKey{Id: id})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := app.store.OAuth().DeleteClient(ctx, &models.OAuthClientPrimaryKey{Id: id})
+	if err != nil {
+		return err
+	}
+	if rowsAffected <= 0 {
+		return errors.New("client not found")
+	}
+
+	return app.out.print(client, clientHeader, [][]string{clientRow(client)})
+}
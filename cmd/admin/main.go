@@ -0,0 +1,108 @@
+package main
+
+import (
+	"app/config"
+	"app/pkg/password"
+	"app/storage"
+	"app/storage/postgresql"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: admin [-o table|json] <command> <subcommand> [flags]
+
+Commands:
+  user create          -name -login -password -age [-email]
+  user reset-password  -login -password
+  user list            [-search] [-offset] [-limit]
+  user grant-role      -login -role
+  phone attach         -login -phone [-description] [-fax]
+  phone detach         -id
+  session list         -login
+  session revoke       -login [-id]
+  client create        -name [-redirect-uri] [-scope] [-grant] [-public]
+  client list          [-offset] [-limit]
+  client delete        -id
+`
+
+// app holds what every command needs.
+type app struct {
+	store  storage.StorageI
+	out    *printer
+	hasher *password.Hasher
+	policy *password.Policy
+}
+
+type command func(ctx context.Context, app *app, args []string) error
+
+var commands = map[string]map[string]command{
+	"user": {
+		"create":         userCreate,
+		"reset-password": userResetPassword,
+		"list":           userList,
+		"grant-role":     userGrantRole,
+	},
+	"phone": {
+		"attach": phoneAttach,
+		"detach": phoneDetach,
+	},
+	"session": {
+		"list":   sessionList,
+		"revoke": sessionRevoke,
+	},
+	"client": {
+		"create": clientCreate,
+		"list":   clientList,
+		"delete": clientDelete,
+	},
+}
+
+func main() {
+	output := flag.String("o", "table", "output format: table or json")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[args[0]][args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s %s\n\n", args[0], args[1])
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	out, err := newPrinter(os.Stdout, *output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+
+	store, err := postgresql.NewConnectPostgresql(&cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error connect to postgresql:", err)
+		os.Exit(1)
+	}
+	defer store.CloseDB()
+
+	policy, err := password.NewPolicy(&cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		store.CloseDB()
+		os.Exit(1)
+	}
+
+	a := &app{store: store, out: out, hasher: password.NewHasher(&cfg), policy: policy}
+	if err = cmd(context.Background(), a, args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		store.CloseDB()
+		os.Exit(1)
+	}
+}
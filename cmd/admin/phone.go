@@ -0,0 +1,75 @@
+package main
+
+import (
+	"app/api/models"
+	"app/pkg/helper"
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+)
+
+var phoneHeader = []string{"ID", "USER_ID", "PHONE", "DESCRIPTION", "IS_FAX", "CREATED_AT", "UPDATED_AT"}
+
+func phoneRow(phone *models.Phone) []string {
+	return []string{phone.Id, phone.UserID, phone.Phone, phone.Description, strconv.FormatBool(phone.IsFax), phone.CreatedAt, phone.UpdatedAt}
+}
+
+func phoneAttach(ctx context.Context, app *app, args []string) error {
+	var (
+		login       string
+		createPhone models.CreatePhone
+	)
+
+	fs := flag.NewFlagSet("phone attach", flag.ExitOnError)
+	fs.StringVar(&login, "login", "", "login of the owner")
+	fs.StringVar(&createPhone.Phone, "phone", "", "phone number")
+	fs.StringVar(&createPhone.Description, "description", "", "description")
+	fs.BoolVar(&createPhone.IsFax, "fax", false, "phone is a fax")
+	fs.Parse(args)
+
+	if err := helper.ValidPhoneNumber(createPhone.Phone); err != nil {
+		return err
+	}
+
+	user, err := app.store.User().GetByID(ctx, &models.UserPrimaryKey{Login: login})
+	if err != nil {
+		return err
+	}
+	createPhone.UserID = user.Id
+
+	id, err := app.store.Phone().Create(ctx, &createPhone)
+	if err != nil {
+		return err
+	}
+
+	phone, err := app.store.Phone().GetByID(ctx, &models.PhonePrimaryKey{Id: id})
+	if err != nil {
+		return err
+	}
+
+	return app.out.print(phone, phoneHeader, [][]string{phoneRow(phone)})
+}
+
+func phoneDetach(ctx context.Context, app *app, args []string) error {
+	var id string
+
+	fs := flag.NewFlagSet("phone detach", flag.ExitOnError)
+	fs.StringVar(&id, "id", "", "phone id")
+	fs.Parse(args)
+
+	phone, err := app.store.Phone().GetByID(ctx, &models.PhonePrimaryKey{Id: id})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := app.store.Phone().Delete(ctx, &models.PhonePrimaryKey{Id: id})
+	if err != nil {
+		return err
+	}
+	if rowsAffected <= 0 {
+		return errors.New("now rows affected")
+	}
+
+	return app.out.print(phone, phoneHeader, [][]string{phoneRow(phone)})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"app/api/models"
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+)
+
+var sessionHeader = []string{"ID", "DEVICE", "IP", "USER_AGENT", "CREATED_AT", "LAST_SEEN_AT", "EXPIRES_AT"}
+
+func sessionList(ctx context.Context, app *app, args []string) error {
+	var login string
+
+	fs := flag.NewFlagSet("session list", flag.ExitOnError)
+	fs.StringVar(&login, "login", "", "login of the user")
+	fs.Parse(args)
+
+	user, err := app.store.User().GetByID(ctx, &models.UserPrimaryKey{Login: login})
+	if err != nil {
+		return err
+	}
+
+	resp, err := app.store.Session().GetList(ctx, &models.GetListSessionRequest{UserID: user.Id})
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(resp.Sessions))
+	for _, s := range resp.Sessions {
+		rows = append(rows, []string{s.Id, s.DeviceName, s.IP, s.UserAgent, s.CreatedAt, s.LastSeenAt, s.ExpiresAt})
+	}
+
+	return app.out.print(resp, sessionHeader, rows)
+}
+
+// sessionRevoke revokes one session with -id, or every session of the user.
+func sessionRevoke(ctx context.Context, app *app, args []string) error {
+	var login, id string
+
+	fs := flag.NewFlagSet("session revoke", flag.ExitOnError)
+	fs.StringVar(&login, "login", "", "login of the user")
+	fs.StringVar(&id, "id", "", "session id, all sessions when empty")
+	fs.Parse(args)
+
+	user, err := app.store.User().GetByID(ctx, &models.UserPrimaryKey{Login: login})
+	if err != nil {
+		return err
+	}
+
+	var rowsAffected int64
+	if len(id) > 0 {
+		rowsAffected, err = app.store.Session().Revoke(ctx, &models.SessionPrimaryKey{Id: id, UserID: user.Id})
+		if err == nil && rowsAffected <= 0 {
+			err = errors.New("session not found")
+		}
+	} else {
+		rowsAffected, err = app.store.Session().RevokeAll(ctx, &models.RevokeSessions{UserID: user.Id})
+	}
+	if err != nil {
+		return err
+	}
+
+	resp := models.RevokeSessionsResponse{Revoked: rowsAffected}
+	return app.out.print(resp, []string{"REVOKED"}, [][]string{{strconv.FormatInt(resp.Revoked, 10)}})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"app/api/models"
+	"app/pkg/helper"
+	"app/pkg/password"
+	"context"
+	"errors"
+	"flag"
+	"strconv"
+)
+
+var userHeader = []string{"ID", "NAME", "LOGIN", "EMAIL", "AGE", "ROLE", "CREATED_AT", "UPDATED_AT"}
+
+func userRow(user *models.User) []string {
+	return []string{user.Id, user.Name, user.Login, user.Email, strconv.Itoa(user.Age), user.Role, user.CreatedAt, user.UpdatedAt}
+}
+
+// printUser hides the password hash before printing.
+func printUser(out *printer, user *models.User) error {
+	user.Password = ""
+	return out.print(user, userHeader, [][]string{userRow(user)})
+}
+
+func userCreate(ctx context.Context, app *app, args []string) error {
+	var createUser models.CreateUser
+
+	fs := flag.NewFlagSet("user create", flag.ExitOnError)
+	fs.StringVar(&createUser.Name, "name", "", "user name")
+	fs.StringVar(&createUser.Login, "login", "", "login")
+	fs.StringVar(&createUser.Email, "email", "", "email, optional")
+	fs.StringVar(&createUser.Password, "password", "", "password")
+	fs.IntVar(&createUser.Age, "age", 0, "age")
+	fs.Parse(args)
+
+	if err := helper.ValidLogin(createUser.Login); err != nil {
+		return err
+	}
+	if err := password.Error(app.policy.Check(createUser.Password, createUser.Login, createUser.Name)); err != nil {
+		return err
+	}
+	if len(createUser.Email) > 0 && !helper.IsValidEmail(createUser.Email) {
+		return errors.New("invalid email")
+	}
+
+	hash, err := app.hasher.Hash(createUser.Password)
+	if err != nil {
+		return err
+	}
+	createUser.Password = hash
+
+	id, err := app.store.User().Create(ctx, &createUser)
+	if err != nil {
+		return err
+	}
+
+	user, err := app.store.User().GetByID(ctx, &models.UserPrimaryKey{Id: id})
+	if err != nil {
+		return err
+	}
+
+	return printUser(app.out, user)
+}
+
+func userResetPassword(ctx context.Context, app *app, args []string) error {
+	var login, newPassword string
+
+	fs := flag.NewFlagSet("user reset-password", flag.ExitOnError)
+	fs.StringVar(&login, "login", "", "login of the user")
+	fs.StringVar(&newPassword, "password", "", "new password")
+	fs.Parse(args)
+
+	user, err := app.store.User().GetByID(ctx, &models.UserPrimaryKey{Login: login})
+	if err != nil {
+		return err
+	}
+
+	if err = password.Error(app.policy.Check(newPassword, user.Login, user.Name)); err != nil {
+		return err
+	}
+
+	hash, err := app.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := app.store.User().UpdatePassword(ctx, &models.UpdateUserPassword{Id: user.Id, Password: hash})
+	if err != nil {
+		return err
+	}
+	if rowsAffected <= 0 {
+		return errors.New("now rows affected")
+	}
+
+	return printUser(app.out, user)
+}
+
+func userList(ctx context.Context, app *app, args []string) error {
+	var req models.GetListUserRequest
+
+	fs := flag.NewFlagSet("user list", flag.ExitOnError)
+	fs.StringVar(&req.Search, "search", "", "search by name")
+	fs.IntVar(&req.Offset, "offset", 0, "offset")
+	fs.IntVar(&req.Limit, "limit", 10, "limit")
+	fs.Parse(args)
+
+	resp, err := app.store.User().GetList(ctx, &req)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(resp.Users))
+	for _, user := range resp.Users {
+		user.Password = ""
+		rows = append(rows, userRow(user))
+	}
+
+	return app.out.print(resp, userHeader, rows)
+}
+
+func userGrantRole(ctx context.Context, app *app, args []string) error {
+	var login, role string
+
+	fs := flag.NewFlagSet("user grant-role", flag.ExitOnError)
+	fs.StringVar(&login, "login", "", "login of the user")
+	fs.StringVar(&role, "role", "", "role to grant: user or admin")
+	fs.Parse(args)
+
+	if err := helper.ValidRole(role); err != nil {
+		return err
+	}
+
+	user, err := app.store.User().GetByID(ctx, &models.UserPrimaryKey{Login: login})
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := app.store.User().UpdateRole(ctx, &models.UpdateUserRole{Id: user.Id, Role: role})
+	if err != nil {
+		return err
+	}
+	if rowsAffected <= 0 {
+		return errors.New("now rows affected")
+	}
+
+	user.Role = role
+	return printUser(app.out, user)
+}
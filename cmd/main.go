@@ -3,16 +3,41 @@ package main
 import (
 	"app/api"
 	"app/config"
+	"app/migrations"
+	"app/pkg/health"
 	"app/pkg/logger"
+	"app/pkg/metrics"
+	"app/pkg/notify"
+	"app/pkg/password"
+	"app/pkg/tokens"
+	"app/pkg/tracing"
+	"app/storage"
 	"app/storage/postgresql"
+	"app/storage/traced"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func main() {
 
-	cfg := config.Load()
+	cfg, args, err := config.LoadArgs(os.Args[1:])
+	if len(args) > 0 {
+		os.Exit(runCommand(&cfg, err, args))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error load config:", err)
+		os.Exit(2)
+	}
 
 	// ----------------------------------------------
 	var loggerLevel = new(string)
@@ -38,6 +63,11 @@ func main() {
 		}
 	}()
 
+	if err = cfg.Validate(); err != nil {
+		log.Panic("Invalid config: ", logger.Error(err))
+		return
+	}
+
 	// ----------------------------------------------
 
 	store, err := postgresql.NewConnectPostgresql(&cfg)
@@ -47,17 +77,201 @@ func main() {
 	}
 	defer store.CloseDB()
 
-	r := gin.New()
+	m := metrics.New(prometheus.NewRegistry())
+	if pool, ok := store.(metrics.PoolStater); ok {
+		m.RegisterPool(pool)
+	}
 
-	// call logger
-	r.Use(gin.Recovery(), gin.Logger())
+	exporter, err := tracing.NewExporter(context.Background(), cfg.TracingExporter, cfg.OTLPEndpoint)
+	if err != nil {
+		log.Panic("Error create tracing exporter: ", logger.Error(err))
+		return
+	}
+	tracerProvider := tracing.NewProvider("app", exporter)
+	defer func() {
+		err := tracerProvider.Shutdown(context.Background())
+		if err != nil {
+			log.Error("Error shutdown tracer provider: ", logger.Error(err))
+		}
+	}()
+
+	// every repository call gets a child span of the request span
+	tracedStore := traced.NewStore(store)
 
-	api.NewApi(r, &cfg, store, log)
+	issuer, err := tokens.NewIssuer(&cfg)
+	if err != nil {
+		log.Panic("Error load token signing keys: ", logger.Error(err))
+		return
+	}
 
-	fmt.Println("Server running on port", cfg.ServerHost+cfg.ServerPort)
-	err = r.Run(cfg.ServerHost + cfg.ServerPort)
+	policy, err := password.NewPolicy(&cfg)
 	if err != nil {
+		log.Panic("Error load password policy: ", logger.Error(err))
+		return
+	}
+
+	emails, err := notify.NewEmailSender(&cfg)
+	if err != nil {
+		log.Panic("Error create email sender: ", logger.Error(err))
+		return
+	}
+
+	sms, err := notify.NewSMSSender(&cfg)
+	if err != nil {
+		log.Panic("Error create sms sender: ", logger.Error(err))
+		return
+	}
+
+	healthRegistry := health.NewRegistry(cfg.HealthCacheTTL)
+	registerHealthChecks(healthRegistry, &cfg, store)
+
+	r := gin.New()
+
+	// access log is written by api.NewApi through the app logger
+	r.Use(gin.Recovery())
+
+	api.NewApi(r, &cfg, tracedStore, log, m, healthRegistry, issuer, policy, emails, sms)
+
+	srv := &http.Server{
+		Addr:              cfg.ServerHost + cfg.ServerPort,
+		Handler:           r,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+
+	// stops the certificate reloads on return
+	tlsCtx, stopTLS := context.WithCancel(context.Background())
+	defer stopTLS()
+
+	var redirectSrv *http.Server
+	if cfg.TLSEnabled() {
+		srv.TLSConfig, err = newTLSConfig(tlsCtx, &cfg, log)
+		if err != nil {
+			log.Panic("Error load TLS config: ", logger.Error(err))
+			return
+		}
+
+		if len(cfg.TLSRedirectPort) > 0 {
+			redirectSrv = &http.Server{
+				Addr:              cfg.ServerHost + cfg.TLSRedirectPort,
+				Handler:           redirectToHTTPS(cfg.PublicURL),
+				ReadTimeout:       cfg.ReadTimeout,
+				ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+				WriteTimeout:      cfg.WriteTimeout,
+				IdleTimeout:       cfg.IdleTimeout,
+				MaxHeaderBytes:    cfg.MaxHeaderBytes,
+			}
+		}
+	}
+
+	serverErr := make(chan error, 2)
+	go func() {
+		if srv.TLSConfig != nil {
+			log.Info("Server running with TLS on port " + srv.Addr)
+			serverErr <- srv.ListenAndServeTLS("", "")
+			return
+		}
+		log.Info("Server running on port " + srv.Addr)
+		serverErr <- srv.ListenAndServe()
+	}()
+	if redirectSrv != nil {
+		go func() {
+			log.Info("Redirecting http to https on port " + redirectSrv.Addr)
+			serverErr <- redirectSrv.ListenAndServe()
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err = <-serverErr:
 		log.Panic("Error listening server: ", logger.Error(err))
 		return
+	case <-ctx.Done():
+		stop()
 	}
+
+	// readiness fails first so the load balancer stops sending new requests,
+	// then in-flight requests drain; deferred calls close the pool and sync the logger
+	log.Info("Shutting down server", logger.Any("delay", cfg.ShutdownDelay), logger.Any("timeout", cfg.ShutdownTimeout))
+	healthRegistry.Shutdown()
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if redirectSrv != nil {
+		if err = redirectSrv.Shutdown(shutdownCtx); err != nil {
+			log.Error("Error shutdown redirect server: ", logger.Error(err))
+		}
+	}
+
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("Error shutdown server: ", logger.Error(err))
+		return
+	}
+
+	log.Info("Server stopped")
+}
+
+func registerHealthChecks(registry *health.Registry, cfg *config.Config, store storage.StorageI) {
+
+	registry.Register("postgres", cfg.HealthCheckTimeout, store.Ping)
+
+	registry.Register("migrations", cfg.HealthCheckTimeout, func(ctx context.Context) error {
+		version, dirty, err := store.MigrationVersion(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("migration %d is dirty", version)
+		}
+		if expected := migrations.LatestVersion(); version != expected {
+			return fmt.Errorf("schema version %d, expected %d", version, expected)
+		}
+		return nil
+	})
+
+	registry.Register("config", cfg.HealthCheckTimeout, func(ctx context.Context) error {
+		if err := cfg.Validate(); err != nil {
+			return errors.New("invalid config: " + err.Error())
+		}
+		return nil
+	})
+}
+
+// runCommand handles "config print [-redacted]" and returns the exit code.
+func runCommand(cfg *config.Config, loadErr error, args []string) int {
+	if len(args) < 2 || args[0] != "config" || args[1] != "print" {
+		fmt.Fprintln(os.Stderr, "Usage: app [-config FILE] [-set KEY=VALUE]... [config print [-redacted]]")
+		return 2
+	}
+
+	var redacted bool
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	fs.BoolVar(&redacted, "redacted", false, "mask passwords and secret keys")
+	if err := fs.Parse(args[2:]); err != nil {
+		return 2
+	}
+
+	if loadErr != nil {
+		fmt.Fprintln(os.Stderr, "Error load config:", loadErr)
+		return 1
+	}
+
+	if err := cfg.Print(os.Stdout, redacted); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid config:", err)
+		return 1
+	}
+
+	return 0
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"app/config"
+	"app/pkg/apikey"
+	"app/pkg/certs"
+	"app/pkg/logger"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// newTLSConfig returns the TLS settings of the server. The certificate is
+// reloaded from its files until ctx is done.
+func newTLSConfig(ctx context.Context, cfg *config.Config, log logger.LoggerI) (*tls.Config, error) {
+	reloader, err := certs.NewReloader(cfg.TLSCertPath, cfg.TLSKeyPath, log)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLSReloadInterval > 0 {
+		go reloader.Watch(ctx, cfg.TLSReloadInterval)
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: reloader.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+	if cfg.TLSMinVersion == "1.3" {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+
+	if cfg.TLSClientAuth == "none" {
+		return tlsConfig, nil
+	}
+
+	// the scopes are those of API keys, which the config package cannot check
+	for _, p := range cfg.TLSClientPrincipals {
+		if err = apikey.ValidateScopes(p.Scopes); err != nil {
+			return nil, fmt.Errorf("TLS_CLIENT_%s_SCOPES: %w", strings.ToUpper(p.Name), err)
+		}
+	}
+
+	tlsConfig.ClientCAs, err = certs.LoadCertPool(cfg.TLSClientCAPath)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if cfg.TLSClientAuth == "required" {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// redirectToHTTPS sends plain http requests to the same path under PUBLIC_URL.
+func redirectToHTTPS(publicURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+
+		http.Redirect(w, r, publicURL+r.URL.RequestURI(), code)
+	})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"app/config"
+	"app/pkg/apikey"
+	"app/pkg/certs/certstest"
+	"app/pkg/logger"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tlsTest has the files of a server certificate and of a client CA.
+type tlsTest struct {
+	ca  *certstest.CA
+	cfg *config.Config
+}
+
+func newTLSTest(t *testing.T) *tlsTest {
+	t.Helper()
+
+	ca := certstest.NewCA(pkix.Name{CommonName: "Test CA"})
+	server := ca.Issue(pkix.Name{CommonName: "app.test"}, "app.test")
+
+	dir := t.TempDir()
+	cfg := &config.Config{
+		TLSCertPath:     filepath.Join(dir, "tls.crt"),
+		TLSKeyPath:      filepath.Join(dir, "tls.key"),
+		TLSMinVersion:   "1.2",
+		TLSClientAuth:   "none",
+		TLSClientCAPath: filepath.Join(dir, "ca.pem"),
+	}
+	for path, data := range map[string][]byte{cfg.TLSCertPath: server.CertPEM, cfg.TLSKeyPath: server.KeyPEM, cfg.TLSClientCAPath: ca.CertPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+
+	return &tlsTest{ca: ca, cfg: cfg}
+}
+
+func (ts *tlsTest) config(t *testing.T) *tls.Config {
+	t.Helper()
+
+	tlsConfig, err := newTLSConfig(context.Background(), ts.cfg, logger.NewLogger("test", logger.LevelFatal))
+	if err != nil {
+		t.Fatalf("newTLSConfig: %v", err)
+	}
+
+	return tlsConfig
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		minVersion string
+		clientAuth string
+		wantMin    uint16
+		wantAuth   tls.ClientAuthType
+	}{
+		{"defaults", "1.2", "none", tls.VersionTLS12, tls.NoClientCert},
+		{"TLS 1.3 only", "1.3", "none", tls.VersionTLS13, tls.NoClientCert},
+		{"optional client certificates", "1.2", "optional", tls.VersionTLS12, tls.VerifyClientCertIfGiven},
+		{"required client certificates", "1.2", "required", tls.VersionTLS12, tls.RequireAndVerifyClientCert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTLSTest(t)
+			ts.cfg.TLSMinVersion, ts.cfg.TLSClientAuth = tt.minVersion, tt.clientAuth
+			tlsConfig := ts.config(t)
+
+			if tlsConfig.MinVersion != tt.wantMin || tlsConfig.ClientAuth != tt.wantAuth {
+				t.Fatalf("MinVersion %x, ClientAuth %v, want %x, %v", tlsConfig.MinVersion, tlsConfig.ClientAuth, tt.wantMin, tt.wantAuth)
+			}
+			if (tlsConfig.ClientCAs != nil) != (tt.clientAuth != "none") {
+				t.Fatalf("ClientCAs set %v with TLS_CLIENT_AUTH %s", tlsConfig.ClientCAs != nil, tt.clientAuth)
+			}
+
+			cert, err := tlsConfig.GetCertificate(nil)
+			if err != nil || cert.Leaf.Subject.CommonName != "app.test" {
+				t.Fatalf("GetCertificate = %v, %v, want the certificate of app.test", cert, err)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfigUnknownScope(t *testing.T) {
+	ts := newTLSTest(t)
+	ts.cfg.TLSClientAuth = "optional"
+	ts.cfg.TLSClientPrincipals = []config.TLSClientPrincipal{{Name: "billing", Subject: "CN=billing", Scopes: []string{"user:everything"}}}
+
+	_, err := newTLSConfig(context.Background(), ts.cfg, logger.NewLogger("test", logger.LevelFatal))
+	if err == nil || !strings.Contains(err.Error(), "TLS_CLIENT_BILLING_SCOPES") {
+		t.Fatalf("newTLSConfig = %v, want an error naming TLS_CLIENT_BILLING_SCOPES", err)
+	}
+}
+
+// TestClientCertificateSubject checks that a verified client certificate
+// reaches handlers with the RFC 2253 subject TLS_CLIENT_{NAME}_SUBJECT is
+// compared with.
+func TestClientCertificateSubject(t *testing.T) {
+	ts := newTLSTest(t)
+	ts.cfg.TLSClientAuth = "optional"
+	ts.cfg.TLSClientPrincipals = []config.TLSClientPrincipal{{Name: "billing", Subject: "CN=billing,OU=Services,O=Example", Scopes: []string{apikey.ScopeUserRead}}}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) <= 0 {
+			io.WriteString(w, "no certificate")
+			return
+		}
+		io.WriteString(w, r.TLS.VerifiedChains[0][0].Subject.String())
+	}))
+	srv.TLS = ts.config(t)
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.ca.Cert)
+	client := ts.ca.Issue(pkix.Name{CommonName: "billing", OrganizationalUnit: []string{"Services"}, Organization: []string{"Example"}})
+	clientCert, err := tls.X509KeyPair(client.CertPEM, client.KeyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		certs []tls.Certificate
+		want  string
+	}{
+		{"with a client certificate", []tls.Certificate{clientCert}, ts.cfg.TLSClientPrincipals[0].Subject},
+		{"without one", nil, "no certificate"},
+	} {
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      roots,
+			ServerName:   "app.test",
+			Certificates: tt.certs,
+		}}}
+
+		resp, err := httpClient.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("%s: GET: %v", tt.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if string(body) != tt.want {
+			t.Errorf("%s: subject %q, want %q", tt.name, body, tt.want)
+		}
+	}
+}
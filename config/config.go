@@ -1,8 +1,14 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"net/mail"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -18,13 +24,42 @@ const (
 	ReleaseMode = "release"
 
 	TimeExpiredAt = time.Hour * 24
+
+	defaultAuthSecretKey    = "secret"
+	defaultLinkSecretKey    = "link-secret"
+	defaultPostgresPassword = "1234"
 )
 
+var providerName = regexp.MustCompile(`^[a-z0-9]+$`)
+
 type Config struct {
 	Environment string // debug, test, release
 
 	ServerHost string
 	ServerPort string
+	PublicURL  string // scheme://host[:port] the service is reached at, used in links sent to users and as the OpenID Connect issuer
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	MaxBodyBytes      int64
+	ShutdownDelay     time.Duration // readiness reports down this long before the server stops accepting
+	ShutdownTimeout   time.Duration // in-flight requests are cut off after this
+
+	HSTSMaxAge            time.Duration // Strict-Transport-Security on https, 0 leaves it out
+	HSTSIncludeSubdomains bool
+	ReferrerPolicy        string
+
+	TLSCertPath         string        // PEM certificate chain; with TLS_KEY_PATH the server speaks https on HTTP_PORT
+	TLSKeyPath          string        // PEM private key
+	TLSReloadInterval   time.Duration // how often the files are checked for changes, 0 never
+	TLSMinVersion       string        // 1.2, 1.3
+	TLSRedirectPort     string        // plain http listener redirecting to PUBLIC_URL, empty for none
+	TLSClientAuth       string        // none, optional, required
+	TLSClientCAPath     string        // PEM bundle of the CAs client certificates must chain to, read at start
+	TLSClientPrincipals []TLSClientPrincipal
 
 	PostgresHost           string
 	PostgresUser           string
@@ -33,44 +68,647 @@ type Config struct {
 	PostgresPort           string
 	PostgresMaxConnections int32
 
-	AuthSecretKey string
+	AuthSigningAlg         string // HS256, RS256, EdDSA
+	AuthSecretKey          string
+	AuthSecretKeyID        string            // kid stamped on new tokens
+	AuthPreviousKeys       map[string]string // kid -> secret, still accepted for verification
+	AuthPrivateKeyPath     string            // PEM signing key for RS256 and EdDSA
+	AuthPreviousPublicKeys map[string]string // kid -> PEM public key path, still accepted for verification
+	AuthIssuer             string
+	AuthAudience           string
+	AuthTokenTTL           time.Duration
+
+	SessionTouchInterval time.Duration // last-seen of a session or API key is written at most this often
+
+	CookieDomain   string // empty for host-only cookies
+	CookieSecure   bool   // send cookies over https only, the default when PUBLIC_URL is https
+	CookieSameSite string // lax, strict, none
+
+	CORS       CORSPolicy   // for the routes no group of CORSGroups covers
+	CORSGroups []CORSPolicy // route groups with their own policy
+
+	OAuthAccessTokenTTL  time.Duration
+	OAuthRefreshTokenTTL time.Duration // lifetime of the session behind an authorization code grant
+	OAuthCodeTTL         time.Duration
+
+	OIDCProviders []OIDCProvider // upstream identity providers users can log in with
+
+	PasswordHashAlg       string // argon2id, bcrypt
+	PasswordArgon2Memory  uint32 // KiB
+	PasswordArgon2Time    uint32
+	PasswordArgon2Threads uint8
+	PasswordBcryptCost    int
+
+	PasswordMinLength      int
+	PasswordMaxLength      int
+	PasswordRequireLower   bool
+	PasswordRequireUpper   bool
+	PasswordRequireDigit   bool
+	PasswordRequireSymbol  bool
+	PasswordRejectUserInfo bool
+	PasswordBlocklist      bool
+	PasswordBlocklistPath  string // gzip compressed, one password per line; empty uses the bundled list
+
+	LinkSecretKey  string // signs links sent to users, e.g. email verification, and keys the hashes of SMS codes
+	EmailVerifyTTL time.Duration
+
+	EmailSender       string // smtp, file
+	EmailFrom         string
+	EmailMailboxDir   string // EMAIL_SENDER=file writes .eml files here
+	EmailSMTPHost     string
+	EmailSMTPPort     string
+	EmailSMTPUsername string
+	EmailSMTPPassword string
+	EmailSMTPTimeout  time.Duration
+
+	OTPLength          int           // digits of the codes sent by SMS
+	OTPTTL             time.Duration // a code expires after this
+	OTPMaxAttempts     int           // guesses allowed per code
+	OTPResendInterval  time.Duration // least time between two codes to one number
+	OTPMaxSendsPerHour int           // codes sent to one number per hour
+
+	SMSSender     string // none, file; none turns login by SMS code off
+	SMSOutboxPath string // SMS_SENDER=file appends messages to this file
+
+	WebAuthnRPID             string   // domain passkeys are bound to, the host of PUBLIC_URL or a parent domain of it
+	WebAuthnRPName           string   // shown by authenticators
+	WebAuthnOrigins          []string // scheme://host[:port] of the pages which use passkeys, all on WEBAUTHN_RP_ID
+	WebAuthnTimeout          time.Duration
+	WebAuthnUserVerification string // required, preferred, discouraged
+
+	TracingExporter string // none, stdout, otlp
+	OTLPEndpoint    string
+
+	HealthCheckTimeout time.Duration
+	HealthCacheTTL     time.Duration
 
 	DefaultOffset int
 	DefaultLimit  int
+
+	settings []setting
+	loadErr  error
+}
+
+// OIDCProvider is an upstream OpenID Connect identity provider, configured with
+// OIDC_{NAME}_ISSUER, OIDC_{NAME}_CLIENT_ID, OIDC_{NAME}_CLIENT_SECRET and
+// OIDC_{NAME}_SCOPES for every name in OIDC_PROVIDERS.
+type OIDCProvider struct {
+	Name         string // in the /login/{name} path
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// TLSClientPrincipal is a service which authenticates with a client
+// certificate, configured with TLS_CLIENT_{NAME}_SUBJECT and
+// TLS_CLIENT_{NAME}_SCOPES for every name in TLS_CLIENT_PRINCIPALS. It may
+// call the routes an API key with the same scopes may.
+type TLSClientPrincipal struct {
+	Name    string
+	Subject string // distinguished name of the certificate as in RFC 2253, e.g. CN=billing,O=Example
+	Scopes  []string
 }
 
+// CORSPolicy decides which other sites browsers let call the API. The
+// default policy is configured with the CORS_* keys; a group named in
+// CORS_GROUPS covers the paths of CORS_{NAME}_PATHS and takes any other
+// CORS_{NAME}_* key over the default one.
+type CORSPolicy struct {
+	Name             string   // empty for the default policy
+	Paths            []string // path prefixes, matched whole segments at a time; the longest match picks the group
+	AllowedOrigins   []string // scheme://host[:port], scheme://*.host[:port] for any subdomain, or * for any origin without credentials
+	AllowCredentials bool     // let the login cookie be sent
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string // response headers scripts may read
+	MaxAge           time.Duration
+}
+
+// Load reads the configuration from the config file named by CONFIG_FILE,
+// ./app.env and the environment. Loading errors are reported by Validate.
 func Load() Config {
+	cfg, _, _ := LoadArgs(nil)
+	return cfg
+}
+
+// LoadArgs is Load with command-line flags on top. Settings are resolved in this
+// order, the first one found wins:
+//
+//  1. -set KEY=VALUE flags
+//  2. environment variables, including the ones from ./app.env
+//  3. the YAML or TOML file given by -config or CONFIG_FILE, where nested keys
+//     are joined with "_" and upper-cased (postgres: {host: x} is POSTGRES_HOST)
+//  4. built-in defaults
+//
+// In every layer KEY_FILE may be set instead of KEY to read the value from a
+// file, as with Docker and Kubernetes secrets. The arguments left after the
+// flags are returned.
+func LoadArgs(args []string) (Config, []string, error) {
+	var (
+		configFile string
+		overrides  = overrideFlag{}
+	)
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.StringVar(&configFile, "config", "", "YAML or TOML config file")
+	fs.Var(overrides, "set", "override a setting, KEY=VALUE (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
 
 	if err := godotenv.Load("./app.env"); err != nil {
-		fmt.Println("No .env file found")
+		fmt.Fprintln(os.Stderr, "No .env file found")
 	}
 
+	if len(configFile) <= 0 {
+		configFile = os.Getenv("CONFIG_FILE")
+	}
+
+	l, err := newLoader(overrides, configFile)
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := l.load()
+
+	return cfg, fs.Args(), cfg.loadErr
+}
+
+func (l *loader) load() Config {
+
 	cfg := Config{}
 
-	cfg.ServerHost = cast.ToString(getOrReturnDefaultValue("SERVICE_HOST", "localhost"))
-	cfg.ServerPort = cast.ToString(getOrReturnDefaultValue("HTTP_PORT", ":8080"))
+	cfg.Environment = cast.ToString(l.getOrReturnDefaultValue("ENVIRONMENT", ReleaseMode))
+
+	cfg.ServerHost = cast.ToString(l.getOrReturnDefaultValue("SERVICE_HOST", "localhost"))
+	cfg.ServerPort = cast.ToString(l.getOrReturnDefaultValue("HTTP_PORT", ":8080"))
+	cfg.PublicURL = strings.TrimRight(cast.ToString(l.getOrReturnDefaultValue("PUBLIC_URL", "http://localhost:8080")), "/")
+
+	cfg.ReadTimeout = cast.ToDuration(l.getOrReturnDefaultValue("HTTP_READ_TIMEOUT", "10s"))
+	cfg.ReadHeaderTimeout = cast.ToDuration(l.getOrReturnDefaultValue("HTTP_READ_HEADER_TIMEOUT", "5s"))
+	cfg.WriteTimeout = cast.ToDuration(l.getOrReturnDefaultValue("HTTP_WRITE_TIMEOUT", "30s"))
+	cfg.IdleTimeout = cast.ToDuration(l.getOrReturnDefaultValue("HTTP_IDLE_TIMEOUT", "120s"))
+	cfg.MaxHeaderBytes = cast.ToInt(l.getOrReturnDefaultValue("HTTP_MAX_HEADER_BYTES", 1<<20))
+	cfg.MaxBodyBytes = cast.ToInt64(l.getOrReturnDefaultValue("HTTP_MAX_BODY_BYTES", 1<<20))
+	cfg.HSTSMaxAge = cast.ToDuration(l.getOrReturnDefaultValue("HTTP_HSTS_MAX_AGE", "4320h"))
+	cfg.HSTSIncludeSubdomains = cast.ToBool(l.getOrReturnDefaultValue("HTTP_HSTS_INCLUDE_SUBDOMAINS", false))
+	cfg.ReferrerPolicy = cast.ToString(l.getOrReturnDefaultValue("HTTP_REFERRER_POLICY", "no-referrer"))
+
+	cfg.TLSCertPath = cast.ToString(l.getOrReturnDefaultValue("TLS_CERT_PATH", ""))
+	cfg.TLSKeyPath = cast.ToString(l.getOrReturnDefaultValue("TLS_KEY_PATH", ""))
+	cfg.TLSReloadInterval = cast.ToDuration(l.getOrReturnDefaultValue("TLS_RELOAD_INTERVAL", "1m"))
+	cfg.TLSMinVersion = cast.ToString(l.getOrReturnDefaultValue("TLS_MIN_VERSION", "1.2"))
+	cfg.TLSRedirectPort = cast.ToString(l.getOrReturnDefaultValue("TLS_REDIRECT_PORT", ""))
+	cfg.TLSClientAuth = cast.ToString(l.getOrReturnDefaultValue("TLS_CLIENT_AUTH", "none"))
+	cfg.TLSClientCAPath = cast.ToString(l.getOrReturnDefaultValue("TLS_CLIENT_CA_PATH", ""))
+	for _, name := range splitList(cast.ToString(l.getOrReturnDefaultValue("TLS_CLIENT_PRINCIPALS", ""))) {
+		prefix := "TLS_CLIENT_" + strings.ToUpper(name) + "_"
+		cfg.TLSClientPrincipals = append(cfg.TLSClientPrincipals, TLSClientPrincipal{
+			Name:    name,
+			Subject: cast.ToString(l.getOrReturnDefaultValue(prefix+"SUBJECT", "")),
+			Scopes:  strings.Fields(cast.ToString(l.getOrReturnDefaultValue(prefix+"SCOPES", ""))),
+		})
+	}
+	cfg.ShutdownDelay = cast.ToDuration(l.getOrReturnDefaultValue("SHUTDOWN_DELAY", "5s"))
+	cfg.ShutdownTimeout = cast.ToDuration(l.getOrReturnDefaultValue("SHUTDOWN_TIMEOUT", "20s"))
+
+	cfg.PostgresHost = cast.ToString(l.getOrReturnDefaultValue("POSTGRES_HOST", "localhost"))
+	cfg.PostgresPort = cast.ToString(l.getOrReturnDefaultValue("POSTGRES_PORT", 5432))
+	cfg.PostgresUser = cast.ToString(l.getOrReturnDefaultValue("POSTGRES_USER", "postgres"))
+	cfg.PostgresPassword = cast.ToString(l.getOrReturnDefaultValue("POSTGRES_PASSWORD", defaultPostgresPassword))
+	cfg.PostgresDatabase = cast.ToString(l.getOrReturnDefaultValue("POSTGRES_DATABASE", "login"))
+	cfg.PostgresMaxConnections = cast.ToInt32(l.getOrReturnDefaultValue("POSTGRES_MAXCONS", 20))
+
+	cfg.DefaultOffset = cast.ToInt(l.getOrReturnDefaultValue("OFFSET", 0))
+	cfg.DefaultLimit = cast.ToInt(l.getOrReturnDefaultValue("LIMIT", 10))
+
+	cfg.AuthSigningAlg = cast.ToString(l.getOrReturnDefaultValue("AUTH_SIGNING_ALG", "HS256"))
+	cfg.AuthSecretKey = cast.ToString(l.getOrReturnDefaultValue("AUTH_SECRET_KEY", defaultAuthSecretKey))
+	cfg.AuthSecretKeyID = cast.ToString(l.getOrReturnDefaultValue("AUTH_SECRET_KEY_ID", "default"))
+	cfg.AuthPreviousKeys = l.parseKeys("AUTH_PREVIOUS_SECRET_KEYS")
+	cfg.AuthPrivateKeyPath = cast.ToString(l.getOrReturnDefaultValue("AUTH_PRIVATE_KEY_PATH", ""))
+	cfg.AuthPreviousPublicKeys = l.parseKeys("AUTH_PREVIOUS_PUBLIC_KEYS")
+	cfg.AuthIssuer = cast.ToString(l.getOrReturnDefaultValue("AUTH_ISSUER", "app"))
+	cfg.AuthAudience = cast.ToString(l.getOrReturnDefaultValue("AUTH_AUDIENCE", "app"))
+	cfg.AuthTokenTTL = cast.ToDuration(l.getOrReturnDefaultValue("AUTH_TOKEN_TTL", TimeExpiredAt))
+	cfg.SessionTouchInterval = cast.ToDuration(l.getOrReturnDefaultValue("SESSION_TOUCH_INTERVAL", "1m"))
 
-	cfg.PostgresHost = cast.ToString(getOrReturnDefaultValue("POSTGRES_HOST", "localhost"))
-	cfg.PostgresPort = cast.ToString(getOrReturnDefaultValue("POSTGRES_PORT", 5432))
-	cfg.PostgresUser = cast.ToString(getOrReturnDefaultValue("POSTGRES_USER", "postgres"))
-	cfg.PostgresPassword = cast.ToString(getOrReturnDefaultValue("POSTGRES_PASSWORD", "1234"))
-	cfg.PostgresDatabase = cast.ToString(getOrReturnDefaultValue("POSTGRES_DATABASE", "login"))
-	cfg.PostgresMaxConnections = cast.ToInt32(getOrReturnDefaultValue("POSTGRES_MAXCONS", 20))
+	cfg.CookieDomain = cast.ToString(l.getOrReturnDefaultValue("COOKIE_DOMAIN", ""))
+	cfg.CookieSecure = cast.ToBool(l.getOrReturnDefaultValue("COOKIE_SECURE", strings.HasPrefix(cfg.PublicURL, "https://")))
+	cfg.CookieSameSite = cast.ToString(l.getOrReturnDefaultValue("COOKIE_SAME_SITE", "lax"))
+
+	cfg.CORS = l.loadCORSPolicy("CORS_", CORSPolicy{
+		AllowCredentials: true,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "Cache-Control", "Platform-Id", "X-CSRF-Token", "X-Request-ID"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		MaxAge:           10 * time.Minute,
+	})
+	for _, name := range splitList(cast.ToString(l.getOrReturnDefaultValue("CORS_GROUPS", ""))) {
+		prefix := "CORS_" + strings.ToUpper(name) + "_"
+		group := l.loadCORSPolicy(prefix, cfg.CORS)
+		group.Name = name
+		group.Paths = splitList(cast.ToString(l.getOrReturnDefaultValue(prefix+"PATHS", "")))
+		cfg.CORSGroups = append(cfg.CORSGroups, group)
+	}
+
+	cfg.OAuthAccessTokenTTL = cast.ToDuration(l.getOrReturnDefaultValue("OAUTH_ACCESS_TOKEN_TTL", "1h"))
+	cfg.OAuthRefreshTokenTTL = cast.ToDuration(l.getOrReturnDefaultValue("OAUTH_REFRESH_TOKEN_TTL", "720h"))
+	cfg.OAuthCodeTTL = cast.ToDuration(l.getOrReturnDefaultValue("OAUTH_CODE_TTL", "1m"))
+
+	for _, name := range strings.Split(cast.ToString(l.getOrReturnDefaultValue("OIDC_PROVIDERS", "")), ",") {
+		name = strings.TrimSpace(name)
+		if len(name) <= 0 {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		cfg.OIDCProviders = append(cfg.OIDCProviders, OIDCProvider{
+			Name:         name,
+			Issuer:       cast.ToString(l.getOrReturnDefaultValue(prefix+"ISSUER", "")),
+			ClientID:     cast.ToString(l.getOrReturnDefaultValue(prefix+"CLIENT_ID", "")),
+			ClientSecret: cast.ToString(l.getOrReturnDefaultValue(prefix+"CLIENT_SECRET", "")),
+			Scopes:       strings.Fields(cast.ToString(l.getOrReturnDefaultValue(prefix+"SCOPES", "openid profile email"))),
+		})
+	}
+
+	cfg.PasswordHashAlg = cast.ToString(l.getOrReturnDefaultValue("PASSWORD_HASH_ALG", "argon2id"))
+	cfg.PasswordArgon2Memory = cast.ToUint32(l.getOrReturnDefaultValue("PASSWORD_ARGON2_MEMORY", 64*1024))
+	cfg.PasswordArgon2Time = cast.ToUint32(l.getOrReturnDefaultValue("PASSWORD_ARGON2_TIME", 3))
+	cfg.PasswordArgon2Threads = cast.ToUint8(l.getOrReturnDefaultValue("PASSWORD_ARGON2_THREADS", 2))
+	cfg.PasswordBcryptCost = cast.ToInt(l.getOrReturnDefaultValue("PASSWORD_BCRYPT_COST", 12))
+
+	cfg.PasswordMinLength = cast.ToInt(l.getOrReturnDefaultValue("PASSWORD_MIN_LENGTH", 8))
+	cfg.PasswordMaxLength = cast.ToInt(l.getOrReturnDefaultValue("PASSWORD_MAX_LENGTH", 64))
+	cfg.PasswordRequireLower = cast.ToBool(l.getOrReturnDefaultValue("PASSWORD_REQUIRE_LOWER", false))
+	cfg.PasswordRequireUpper = cast.ToBool(l.getOrReturnDefaultValue("PASSWORD_REQUIRE_UPPER", false))
+	cfg.PasswordRequireDigit = cast.ToBool(l.getOrReturnDefaultValue("PASSWORD_REQUIRE_DIGIT", false))
+	cfg.PasswordRequireSymbol = cast.ToBool(l.getOrReturnDefaultValue("PASSWORD_REQUIRE_SYMBOL", false))
+	cfg.PasswordRejectUserInfo = cast.ToBool(l.getOrReturnDefaultValue("PASSWORD_REJECT_USER_INFO", true))
+	cfg.PasswordBlocklist = cast.ToBool(l.getOrReturnDefaultValue("PASSWORD_BLOCKLIST", true))
+	cfg.PasswordBlocklistPath = cast.ToString(l.getOrReturnDefaultValue("PASSWORD_BLOCKLIST_PATH", ""))
+
+	cfg.LinkSecretKey = cast.ToString(l.getOrReturnDefaultValue("LINK_SECRET_KEY", defaultLinkSecretKey))
+	cfg.EmailVerifyTTL = cast.ToDuration(l.getOrReturnDefaultValue("EMAIL_VERIFY_TTL", "24h"))
+
+	cfg.EmailSender = cast.ToString(l.getOrReturnDefaultValue("EMAIL_SENDER", "file"))
+	cfg.EmailFrom = cast.ToString(l.getOrReturnDefaultValue("EMAIL_FROM", "App <no-reply@localhost>"))
+	cfg.EmailMailboxDir = cast.ToString(l.getOrReturnDefaultValue("EMAIL_MAILBOX_DIR", "mailbox"))
+	cfg.EmailSMTPHost = cast.ToString(l.getOrReturnDefaultValue("EMAIL_SMTP_HOST", "localhost"))
+	cfg.EmailSMTPPort = cast.ToString(l.getOrReturnDefaultValue("EMAIL_SMTP_PORT", "587"))
+	cfg.EmailSMTPUsername = cast.ToString(l.getOrReturnDefaultValue("EMAIL_SMTP_USERNAME", ""))
+	cfg.EmailSMTPPassword = cast.ToString(l.getOrReturnDefaultValue("EMAIL_SMTP_PASSWORD", ""))
+	cfg.EmailSMTPTimeout = cast.ToDuration(l.getOrReturnDefaultValue("EMAIL_SMTP_TIMEOUT", "10s"))
+
+	cfg.OTPLength = cast.ToInt(l.getOrReturnDefaultValue("OTP_LENGTH", 6))
+	cfg.OTPTTL = cast.ToDuration(l.getOrReturnDefaultValue("OTP_TTL", "5m"))
+	cfg.OTPMaxAttempts = cast.ToInt(l.getOrReturnDefaultValue("OTP_MAX_ATTEMPTS", 5))
+	cfg.OTPResendInterval = cast.ToDuration(l.getOrReturnDefaultValue("OTP_RESEND_INTERVAL", "1m"))
+	cfg.OTPMaxSendsPerHour = cast.ToInt(l.getOrReturnDefaultValue("OTP_MAX_SENDS_PER_HOUR", 5))
+
+	cfg.SMSSender = cast.ToString(l.getOrReturnDefaultValue("SMS_SENDER", "none"))
+	cfg.SMSOutboxPath = cast.ToString(l.getOrReturnDefaultValue("SMS_OUTBOX_PATH", "sms-outbox.log"))
+
+	var publicHost string
+	if u, err := url.Parse(cfg.PublicURL); err == nil {
+		publicHost = u.Hostname()
+	}
+	cfg.WebAuthnRPID = cast.ToString(l.getOrReturnDefaultValue("WEBAUTHN_RP_ID", publicHost))
+	cfg.WebAuthnRPName = cast.ToString(l.getOrReturnDefaultValue("WEBAUTHN_RP_NAME", "App"))
+	for _, origin := range strings.Split(cast.ToString(l.getOrReturnDefaultValue("WEBAUTHN_ORIGINS", cfg.PublicURL)), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); len(origin) > 0 {
+			cfg.WebAuthnOrigins = append(cfg.WebAuthnOrigins, origin)
+		}
+	}
+	cfg.WebAuthnTimeout = cast.ToDuration(l.getOrReturnDefaultValue("WEBAUTHN_TIMEOUT", "5m"))
+	cfg.WebAuthnUserVerification = cast.ToString(l.getOrReturnDefaultValue("WEBAUTHN_USER_VERIFICATION", "preferred"))
 
-	cfg.DefaultOffset = cast.ToInt(getOrReturnDefaultValue("OFFSET", 0))
-	cfg.DefaultLimit = cast.ToInt(getOrReturnDefaultValue("LIMIT", 10))
+	cfg.TracingExporter = cast.ToString(l.getOrReturnDefaultValue("TRACING_EXPORTER", "none"))
+	cfg.OTLPEndpoint = cast.ToString(l.getOrReturnDefaultValue("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4318"))
 
-	cfg.AuthSecretKey = cast.ToString(getOrReturnDefaultValue("AUTH_SECRET_KEY", "secret"))
+	cfg.HealthCheckTimeout = cast.ToDuration(l.getOrReturnDefaultValue("HEALTH_CHECK_TIMEOUT", "2s"))
+	cfg.HealthCacheTTL = cast.ToDuration(l.getOrReturnDefaultValue("HEALTH_CACHE_TTL", "1s"))
+
+	cfg.settings = l.settings
+	cfg.loadErr = l.err
 
 	return cfg
 }
 
-func getOrReturnDefaultValue(key string, defaultValue interface{}) interface{} {
-	val, exists := os.LookupEnv(key)
+// loadCORSPolicy reads the policy of the keys under prefix, with base for
+// the keys which are not set.
+func (l *loader) loadCORSPolicy(prefix string, base CORSPolicy) CORSPolicy {
+	return CORSPolicy{
+		AllowedOrigins:   splitList(cast.ToString(l.getOrReturnDefaultValue(prefix+"ALLOWED_ORIGINS", strings.Join(base.AllowedOrigins, ",")))),
+		AllowCredentials: cast.ToBool(l.getOrReturnDefaultValue(prefix+"ALLOW_CREDENTIALS", base.AllowCredentials)),
+		AllowedMethods:   splitList(cast.ToString(l.getOrReturnDefaultValue(prefix+"ALLOWED_METHODS", strings.Join(base.AllowedMethods, ",")))),
+		AllowedHeaders:   splitList(cast.ToString(l.getOrReturnDefaultValue(prefix+"ALLOWED_HEADERS", strings.Join(base.AllowedHeaders, ",")))),
+		ExposedHeaders:   splitList(cast.ToString(l.getOrReturnDefaultValue(prefix+"EXPOSED_HEADERS", strings.Join(base.ExposedHeaders, ",")))),
+		MaxAge:           cast.ToDuration(l.getOrReturnDefaultValue(prefix+"MAX_AGE", base.MaxAge.String())),
+	}
+}
+
+// TLSEnabled reports whether the server speaks https.
+func (cfg *Config) TLSEnabled() bool {
+	return len(cfg.TLSCertPath) > 0 || len(cfg.TLSKeyPath) > 0
+}
+
+func (cfg *Config) validateTLS() error {
+	if !cfg.TLSEnabled() {
+		if len(cfg.TLSRedirectPort) > 0 || cfg.TLSClientAuth != "none" {
+			return errors.New("TLS_REDIRECT_PORT and TLS_CLIENT_AUTH need TLS_CERT_PATH and TLS_KEY_PATH")
+		}
+		return nil
+	}
+
+	switch {
+	case len(cfg.TLSCertPath) <= 0 || len(cfg.TLSKeyPath) <= 0:
+		return errors.New("TLS_CERT_PATH and TLS_KEY_PATH must be set together")
+	case cfg.TLSReloadInterval < 0:
+		return errors.New("TLS_RELOAD_INTERVAL must not be negative")
+	case cfg.TLSMinVersion != "1.2" && cfg.TLSMinVersion != "1.3":
+		return fmt.Errorf("unknown TLS_MIN_VERSION %q", cfg.TLSMinVersion)
+	case len(cfg.TLSRedirectPort) > 0 && !strings.HasPrefix(cfg.PublicURL, "https://"):
+		return errors.New("TLS_REDIRECT_PORT needs an https PUBLIC_URL to redirect to")
+	case len(cfg.TLSRedirectPort) > 0 && cfg.TLSRedirectPort == cfg.ServerPort:
+		return errors.New("TLS_REDIRECT_PORT must differ from HTTP_PORT")
+	}
+
+	switch cfg.TLSClientAuth {
+	case "none":
+		if len(cfg.TLSClientPrincipals) > 0 {
+			return errors.New("TLS_CLIENT_PRINCIPALS need TLS_CLIENT_AUTH optional or required")
+		}
+		return nil
+	case "optional", "required":
+		if len(cfg.TLSClientCAPath) <= 0 {
+			return errors.New("TLS_CLIENT_CA_PATH is required for TLS_CLIENT_AUTH " + cfg.TLSClientAuth)
+		}
+	default:
+		return fmt.Errorf("unknown TLS_CLIENT_AUTH %q", cfg.TLSClientAuth)
+	}
+
+	names, subjects := map[string]bool{}, map[string]bool{}
+	for _, p := range cfg.TLSClientPrincipals {
+		prefix := "TLS_CLIENT_" + strings.ToUpper(p.Name) + "_"
+		switch {
+		case !providerName.MatchString(p.Name):
+			return fmt.Errorf("TLS_CLIENT_PRINCIPALS: %q must be lower case letters and digits", p.Name)
+		case names[p.Name]:
+			return fmt.Errorf("TLS_CLIENT_PRINCIPALS: %q is listed twice", p.Name)
+		case len(p.Subject) <= 0:
+			return fmt.Errorf("%sSUBJECT is required", prefix)
+		case subjects[p.Subject]:
+			return fmt.Errorf("%sSUBJECT %q is used by another principal", prefix, p.Subject)
+		case len(p.Scopes) <= 0:
+			return fmt.Errorf("%sSCOPES is required", prefix)
+		}
+		names[p.Name], subjects[p.Subject] = true, true
+	}
+
+	return nil
+}
+
+// validCORSPolicy checks p, configured with the keys under prefix.
+func validCORSPolicy(prefix string, p *CORSPolicy) error {
+	if p.MaxAge < 0 {
+		return fmt.Errorf("%sMAX_AGE must not be negative", prefix)
+	}
+
+	for _, origin := range p.AllowedOrigins {
+		if origin == "*" {
+			// browsers refuse credentials with the wildcard
+			if p.AllowCredentials || len(p.AllowedOrigins) > 1 {
+				return fmt.Errorf("%sALLOWED_ORIGINS: * must be alone and needs %sALLOW_CREDENTIALS false", prefix, prefix)
+			}
+			continue
+		}
+
+		u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Hostname()) <= 0 || strings.Contains(u.Host, "*") ||
+			u.User != nil || len(u.Path) > 0 || len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+			return fmt.Errorf("%sALLOWED_ORIGINS: %q must be scheme://host[:port] or scheme://*.host[:port]", prefix, origin)
+		}
+	}
+
+	return nil
+}
+
+// splitList splits a comma-separated setting, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Validate reports the first setting the service cannot run with.
+func (cfg *Config) Validate() error {
+	if cfg.loadErr != nil {
+		return cfg.loadErr
+	}
+
+	switch cfg.Environment {
+	case DebugMode, TestMode:
+	case ReleaseMode:
+		if cfg.AuthSigningAlg == "HS256" && cfg.AuthSecretKey == defaultAuthSecretKey {
+			return errors.New("AUTH_SECRET_KEY must be changed from its default in release mode, or set ENVIRONMENT=debug")
+		}
+		if cfg.LinkSecretKey == defaultLinkSecretKey {
+			return errors.New("LINK_SECRET_KEY must be changed from its default in release mode, or set ENVIRONMENT=debug")
+		}
+		if cfg.PostgresPassword == defaultPostgresPassword {
+			return errors.New("POSTGRES_PASSWORD must be changed from its default in release mode, or set ENVIRONMENT=debug")
+		}
+		// the outbox would hold every login code in clear text
+		if cfg.SMSSender == "file" {
+			return errors.New("SMS_SENDER=file is for local runs, not release mode, or set ENVIRONMENT=debug")
+		}
+	default:
+		return fmt.Errorf("unknown ENVIRONMENT %q", cfg.Environment)
+	}
+
+	switch {
+	case len(cfg.ServerPort) <= 0:
+		return errors.New("HTTP_PORT is required")
+	case cfg.ReadTimeout <= 0 || cfg.ReadHeaderTimeout <= 0 || cfg.WriteTimeout <= 0 || cfg.IdleTimeout <= 0:
+		return errors.New("HTTP timeouts must be positive")
+	case cfg.HSTSMaxAge < 0:
+		return errors.New("HTTP_HSTS_MAX_AGE must not be negative")
+	case cfg.MaxHeaderBytes <= 0 || cfg.MaxBodyBytes <= 0:
+		return errors.New("HTTP_MAX_HEADER_BYTES and HTTP_MAX_BODY_BYTES must be positive")
+	case cfg.ShutdownTimeout <= 0:
+		return errors.New("SHUTDOWN_TIMEOUT must be positive")
+	case len(cfg.PostgresHost) <= 0 || len(cfg.PostgresUser) <= 0 || len(cfg.PostgresDatabase) <= 0:
+		return errors.New("POSTGRES_HOST, POSTGRES_USER and POSTGRES_DATABASE are required")
+	case cfg.PostgresMaxConnections <= 0:
+		return errors.New("POSTGRES_MAXCONS must be positive")
+	case len(cfg.AuthSecretKey) <= 0:
+		return errors.New("AUTH_SECRET_KEY is required")
+	case len(cfg.AuthSecretKeyID) <= 0:
+		return errors.New("AUTH_SECRET_KEY_ID is required")
+	case cfg.AuthSigningAlg != "HS256" && len(cfg.AuthPrivateKeyPath) <= 0:
+		return errors.New("AUTH_PRIVATE_KEY_PATH is required for AUTH_SIGNING_ALG " + cfg.AuthSigningAlg)
+	case cfg.AuthTokenTTL <= 0:
+		return errors.New("AUTH_TOKEN_TTL must be positive")
+	case cfg.SessionTouchInterval <= 0:
+		return errors.New("SESSION_TOUCH_INTERVAL must be positive")
+	case cfg.OAuthAccessTokenTTL <= 0 || cfg.OAuthRefreshTokenTTL <= 0 || cfg.OAuthCodeTTL <= 0:
+		return errors.New("OAUTH_ACCESS_TOKEN_TTL, OAUTH_REFRESH_TOKEN_TTL and OAUTH_CODE_TTL must be positive")
+	case len(cfg.LinkSecretKey) <= 0:
+		return errors.New("LINK_SECRET_KEY is required")
+	case cfg.EmailVerifyTTL <= 0:
+		return errors.New("EMAIL_VERIFY_TTL must be positive")
+	case cfg.EmailSMTPTimeout <= 0:
+		return errors.New("EMAIL_SMTP_TIMEOUT must be positive")
+	case cfg.OTPLength < 4 || cfg.OTPLength > 10:
+		return errors.New("OTP_LENGTH must be between 4 and 10")
+	case cfg.OTPTTL <= 0 || cfg.OTPMaxAttempts <= 0 || cfg.OTPMaxSendsPerHour <= 0:
+		return errors.New("OTP_TTL, OTP_MAX_ATTEMPTS and OTP_MAX_SENDS_PER_HOUR must be positive")
+	case cfg.OTPResendInterval < 0:
+		return errors.New("OTP_RESEND_INTERVAL must not be negative")
+	case cfg.WebAuthnTimeout <= 0:
+		return errors.New("WEBAUTHN_TIMEOUT must be positive")
+	case cfg.DefaultLimit <= 0:
+		return errors.New("LIMIT must be positive")
+	case cfg.HealthCheckTimeout <= 0:
+		return errors.New("HEALTH_CHECK_TIMEOUT must be positive")
+	}
+
+	if err := validCORSPolicy("CORS_", &cfg.CORS); err != nil {
+		return err
+	}
+	groups := map[string]bool{}
+	for i := range cfg.CORSGroups {
+		g := &cfg.CORSGroups[i]
+		prefix := "CORS_" + strings.ToUpper(g.Name) + "_"
+		switch {
+		case !providerName.MatchString(g.Name):
+			return fmt.Errorf("CORS_GROUPS: %q must be lower case letters and digits", g.Name)
+		case groups[g.Name]:
+			return fmt.Errorf("CORS_GROUPS: %q is listed twice", g.Name)
+		case len(g.Paths) <= 0:
+			return fmt.Errorf("%sPATHS is required", prefix)
+		}
+		for _, path := range g.Paths {
+			if !strings.HasPrefix(path, "/") {
+				return fmt.Errorf("%sPATHS: %q must start with /", prefix, path)
+			}
+		}
+		if err := validCORSPolicy(prefix, g); err != nil {
+			return err
+		}
+		groups[g.Name] = true
+	}
+
+	if err := cfg.validateTLS(); err != nil {
+		return err
+	}
+
+	switch cfg.ReferrerPolicy {
+	case "no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+		"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url":
+	default:
+		return fmt.Errorf("unknown HTTP_REFERRER_POLICY %q", cfg.ReferrerPolicy)
+	}
+
+	switch cfg.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		if !cfg.CookieSecure {
+			return errors.New("COOKIE_SAME_SITE none requires COOKIE_SECURE")
+		}
+	default:
+		return fmt.Errorf("unknown COOKIE_SAME_SITE %q", cfg.CookieSameSite)
+	}
+
+	switch cfg.AuthSigningAlg {
+	case "HS256", "RS256", "EdDSA":
+	default:
+		return fmt.Errorf("unknown AUTH_SIGNING_ALG %q", cfg.AuthSigningAlg)
+	}
+
+	switch {
+	case cfg.PasswordHashAlg != "argon2id" && cfg.PasswordHashAlg != "bcrypt":
+		return fmt.Errorf("unknown PASSWORD_HASH_ALG %q", cfg.PasswordHashAlg)
+	case cfg.PasswordArgon2Memory < 8*uint32(cfg.PasswordArgon2Threads) || cfg.PasswordArgon2Time <= 0 || cfg.PasswordArgon2Threads <= 0:
+		return errors.New("PASSWORD_ARGON2_TIME and PASSWORD_ARGON2_THREADS must be positive and PASSWORD_ARGON2_MEMORY at least 8 KiB per thread")
+	case cfg.PasswordBcryptCost < 10 || cfg.PasswordBcryptCost > 31:
+		return errors.New("PASSWORD_BCRYPT_COST must be between 10 and 31")
+	case cfg.PasswordMinLength < 6:
+		return errors.New("PASSWORD_MIN_LENGTH must be at least 6")
+	case cfg.PasswordMaxLength > 0 && cfg.PasswordMaxLength < cfg.PasswordMinLength:
+		return errors.New("PASSWORD_MAX_LENGTH must not be less than PASSWORD_MIN_LENGTH")
+	}
+
+	if _, err := url.Parse(cfg.PublicURL); err != nil || !strings.HasPrefix(cfg.PublicURL, "http") {
+		return fmt.Errorf("PUBLIC_URL %q must be an http or https URL", cfg.PublicURL)
+	}
+
+	names := map[string]bool{}
+	for _, p := range cfg.OIDCProviders {
+		prefix := "OIDC_" + strings.ToUpper(p.Name) + "_"
+		switch {
+		case !providerName.MatchString(p.Name):
+			return fmt.Errorf("OIDC_PROVIDERS: %q must be lower case letters and digits", p.Name)
+		case names[p.Name]:
+			return fmt.Errorf("OIDC_PROVIDERS: %q is listed twice", p.Name)
+		case !strings.HasPrefix(p.Issuer, "http://") && !strings.HasPrefix(p.Issuer, "https://"):
+			return fmt.Errorf("%sISSUER %q must be an http or https URL", prefix, p.Issuer)
+		case len(p.ClientID) <= 0:
+			return fmt.Errorf("%sCLIENT_ID is required", prefix)
+		case !strings.Contains(" "+strings.Join(p.Scopes, " ")+" ", " openid "):
+			return fmt.Errorf("%sSCOPES must include openid", prefix)
+		}
+		names[p.Name] = true
+	}
+
+	if _, err := mail.ParseAddress(cfg.EmailFrom); err != nil {
+		return fmt.Errorf("EMAIL_FROM: %w", err)
+	}
+
+	switch cfg.EmailSender {
+	case "smtp", "file":
+	default:
+		return fmt.Errorf("unknown EMAIL_SENDER %q", cfg.EmailSender)
+	}
+
+	if len(cfg.WebAuthnRPID) <= 0 || len(cfg.WebAuthnOrigins) <= 0 {
+		return errors.New("WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS are required")
+	}
+	for _, origin := range cfg.WebAuthnOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) <= 0 || len(u.Path) > 0 {
+			return fmt.Errorf("WEBAUTHN_ORIGINS: %q must be scheme://host[:port]", origin)
+		}
+		if host := u.Hostname(); host != cfg.WebAuthnRPID && !strings.HasSuffix(host, "."+cfg.WebAuthnRPID) {
+			return fmt.Errorf("WEBAUTHN_ORIGINS: %q is not on WEBAUTHN_RP_ID %q", origin, cfg.WebAuthnRPID)
+		}
+	}
+
+	switch cfg.WebAuthnUserVerification {
+	case "required", "preferred", "discouraged":
+	default:
+		return fmt.Errorf("unknown WEBAUTHN_USER_VERIFICATION %q", cfg.WebAuthnUserVerification)
+	}
+
+	switch cfg.SMSSender {
+	case "none", "file":
+	default:
+		return fmt.Errorf("unknown SMS_SENDER %q", cfg.SMSSender)
+	}
 
-	if exists {
-		return val
+	switch cfg.TracingExporter {
+	case "none", "stdout", "otlp":
+	default:
+		return fmt.Errorf("unknown TRACING_EXPORTER %q", cfg.TracingExporter)
 	}
 
-	return defaultValue
+	return nil
 }
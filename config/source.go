@@ -0,0 +1,209 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceDefault = "default"
+
+	fileSuffix = "_FILE"
+	redacted   = "********"
+)
+
+// layer is one source of settings keyed by the environment variable name.
+type layer struct {
+	name   string
+	lookup func(key string) (string, bool)
+}
+
+type setting struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+type loader struct {
+	layers   []layer // highest precedence first
+	settings []setting
+	err      error
+}
+
+func newLoader(overrides overrideFlag, configFile string) (*loader, error) {
+	l := &loader{
+		layers: []layer{
+			{name: sourceFlag, lookup: lookupMap(overrides)},
+			{name: sourceEnv, lookup: os.LookupEnv},
+		},
+	}
+
+	if len(configFile) > 0 {
+		file, err := readConfigFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		l.layers = append(l.layers, layer{name: sourceFile + " " + configFile, lookup: lookupMap(file)})
+	}
+
+	return l, nil
+}
+
+func (l *loader) getOrReturnDefaultValue(key string, defaultValue interface{}) interface{} {
+	for _, layer := range l.layers {
+		if val, exists := layer.lookup(key); exists {
+			l.settings = append(l.settings, setting{Key: key, Value: val, Source: layer.name})
+			return val
+		}
+
+		if path, exists := layer.lookup(key + fileSuffix); exists {
+			val, err := readSecretFile(path)
+			if err != nil && l.err == nil {
+				l.err = fmt.Errorf("%s%s: %w", key, fileSuffix, err)
+			}
+			l.settings = append(l.settings, setting{Key: key, Value: val, Source: layer.name + " " + key + fileSuffix})
+			return val
+		}
+	}
+
+	l.settings = append(l.settings, setting{Key: key, Value: cast.ToString(defaultValue), Source: sourceDefault})
+	return defaultValue
+}
+
+// parseKeys reads a comma separated list of kid:secret pairs.
+func (l *loader) parseKeys(key string) map[string]string {
+	keys := map[string]string{}
+
+	list := cast.ToString(l.getOrReturnDefaultValue(key, ""))
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) <= 0 {
+			continue
+		}
+
+		kid, secret, ok := strings.Cut(pair, ":")
+		if !ok || len(kid) <= 0 || len(secret) <= 0 {
+			if l.err == nil {
+				l.err = fmt.Errorf("%s: expected kid:secret pairs separated by commas", key)
+			}
+			continue
+		}
+		keys[kid] = secret
+	}
+
+	return keys
+}
+
+// Print writes every setting as KEY=VALUE with the layer it came from.
+// With redact, secrets (passwords, secret keys) are masked.
+func (cfg *Config) Print(w io.Writer, redact bool) error {
+	settings := make([]setting, len(cfg.settings))
+	copy(settings, cfg.settings)
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+
+	for _, s := range settings {
+		val := s.Value
+		if redact && isSecret(s.Key) && len(val) > 0 {
+			val = redacted
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\t# %s\n", s.Key, val, s.Source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isSecret(key string) bool {
+	for _, suffix := range []string{"PASSWORD", "SECRET", "SECRET_KEY", "SECRET_KEYS"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func lookupMap(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		val, exists := m[key]
+		return val, exists
+	}
+}
+
+func readSecretFile(path string) (string, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(body), "\r\n"), nil
+}
+
+// readConfigFile flattens a YAML or TOML document into environment variable names.
+func readConfigFile(path string) (map[string]string, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(body, &doc)
+	case ".toml":
+		err = toml.Unmarshal(body, &doc)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	flatten("", doc, values)
+
+	return values, nil
+}
+
+func flatten(prefix string, doc map[string]interface{}, values map[string]string) {
+	for key, val := range doc {
+		key = strings.ToUpper(prefix + key)
+
+		if nested, ok := val.(map[string]interface{}); ok {
+			flatten(key+"_", nested, values)
+			continue
+		}
+
+		values[key] = cast.ToString(val)
+	}
+}
+
+// overrideFlag collects repeated -set KEY=VALUE flags.
+type overrideFlag map[string]string
+
+func (o overrideFlag) String() string {
+	return ""
+}
+
+func (o overrideFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || len(key) <= 0 {
+		return errors.New("expected KEY=VALUE")
+	}
+
+	o[strings.ToUpper(key)] = val
+	return nil
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"embed"
+	"path"
+	"strconv"
+	"strings"
+)
+
+//go:embed postgres/*.sql
+var files embed.FS
+
+// LatestVersion returns the highest migration version shipped with this build.
+func LatestVersion() int64 {
+	entries, err := files.ReadDir("postgres")
+	if err != nil {
+		return 0
+	}
+
+	var latest int64
+	for _, entry := range entries {
+		name := path.Base(entry.Name())
+		version, err := strconv.ParseInt(strings.SplitN(name, "_", 2)[0], 10, 64)
+		if err == nil && version > latest {
+			latest = version
+		}
+	}
+
+	return latest
+}
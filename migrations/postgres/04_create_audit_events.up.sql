@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+  id UUID PRIMARY KEY,
+  seq BIGSERIAL NOT NULL UNIQUE,
+  action VARCHAR NOT NULL,
+  actor_id UUID,
+  target_type VARCHAR NOT NULL,
+  target_id VARCHAR NOT NULL,
+  changes JSONB,
+  ip VARCHAR,
+  user_agent VARCHAR,
+  request_id VARCHAR,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX on audit_events(actor_id, seq);
+CREATE INDEX on audit_events(target_type, target_id, seq);
+CREATE INDEX on audit_events(action, seq);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+  RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+  BEFORE UPDATE OR DELETE ON audit_events
+  FOR EACH ROW EXECUTE PROCEDURE audit_events_append_only();
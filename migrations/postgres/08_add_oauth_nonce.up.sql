@@ -0,0 +1 @@
+ALTER TABLE oauth_codes ADD COLUMN IF NOT EXISTS nonce VARCHAR NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+  id UUID PRIMARY KEY,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  provider VARCHAR NOT NULL,
+  subject VARCHAR NOT NULL,
+  email VARCHAR,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  last_login_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  UNIQUE (provider, subject)
+);
+
+CREATE INDEX on user_identities(user_id);
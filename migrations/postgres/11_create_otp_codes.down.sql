@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "otp_codes";
+
+DROP INDEX IF EXISTS phones_verified_phone_key;
+
+ALTER TABLE phones DROP COLUMN IF EXISTS verified_at;
@@ -0,0 +1,19 @@
+ALTER TABLE phones ADD COLUMN IF NOT EXISTS verified_at TIMESTAMP;
+
+-- a number signs in to one account only
+CREATE UNIQUE INDEX IF NOT EXISTS phones_verified_phone_key ON phones (regexp_replace(phone, '[^0-9+]', '', 'g')) WHERE verified_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS otp_codes (
+  id UUID PRIMARY KEY,
+  purpose VARCHAR NOT NULL,
+  phone VARCHAR NOT NULL,
+  user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+  phone_id UUID REFERENCES phones(id) ON DELETE CASCADE,
+  code_hash VARCHAR NOT NULL,
+  attempts INT NOT NULL DEFAULT 0,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  consumed_at TIMESTAMP
+);
+
+CREATE INDEX on otp_codes(phone, created_at);
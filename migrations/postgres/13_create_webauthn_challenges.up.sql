@@ -0,0 +1,8 @@
+-- challenges of finished passkey ceremonies, kept until they expire so a
+-- captured response cannot be sent again
+CREATE TABLE IF NOT EXISTS webauthn_challenges (
+  challenge_hash VARCHAR PRIMARY KEY,
+  expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX on webauthn_challenges(expires_at);
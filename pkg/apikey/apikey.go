@@ -0,0 +1,109 @@
+// Package apikey holds personal API keys: their format and the scopes which
+// limit the routes a key may call.
+package apikey
+
+import (
+	"app/pkg/oauth"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Scheme is the Authorization header scheme of API keys.
+	Scheme = "ApiKey"
+
+	ScopeUserRead   = "user:read"
+	ScopeUserWrite  = "user:write"
+	ScopePhoneRead  = "phone:read"
+	ScopePhoneWrite = "phone:write"
+	// ScopeAdmin reaches the admin API, for users with the admin role.
+	ScopeAdmin = "admin"
+
+	// keyPrefix marks a string as an API key, so leaked keys are easy to scan for.
+	keyPrefix = "ak_"
+	// lookupLength is the hex length of the part of a key stored in clear
+	// text to find its row.
+	lookupLength = 12
+)
+
+// Scopes are the scopes a key can be given.
+var Scopes = []string{ScopeUserRead, ScopeUserWrite, ScopePhoneRead, ScopePhoneWrite, ScopeAdmin}
+
+// Generate returns a new key, ak_{lookup}_{secret}, and its lookup prefix.
+// Only oauth.HashToken(key) is stored.
+func Generate() (key, prefix string, err error) {
+	b := make([]byte, lookupLength/2)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	secret, err := oauth.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	prefix = keyPrefix + hex.EncodeToString(b)
+
+	return prefix + "_" + secret, prefix, nil
+}
+
+// Prefix returns the lookup prefix of key, or false when key is not shaped
+// like one made by Generate.
+func Prefix(key string) (string, bool) {
+	n := len(keyPrefix) + lookupLength
+	if len(key) <= n+1 || !strings.HasPrefix(key, keyPrefix) || key[n] != '_' {
+		return "", false
+	}
+
+	return key[:n], true
+}
+
+// ValidateScopes checks that scopes is a non-empty list of known scopes.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) <= 0 {
+		return errors.New("at least one scope is required")
+	}
+
+	for _, scope := range scopes {
+		if !oauth.HasScope(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+
+	return nil
+}
+
+// RequiredScope returns the scope a key needs to call route, a gin route
+// template, with method. It returns "" for routes no key may call, such as
+// the account's sessions, identities and keys, and changing or deleting a
+// user, which would let a leaked key change the password and take the
+// account over. Those need a login.
+func RequiredScope(method, route string) string {
+	read := method == http.MethodGet || method == http.MethodHead
+
+	switch {
+	case strings.HasPrefix(route, "/v1/admin/"):
+		return ScopeAdmin
+	case strings.HasPrefix(route, "/v1/user/me/"):
+		return ""
+	case route == "/v1/user/:id" && (method == http.MethodPut || method == http.MethodDelete):
+		return ""
+	// matched anywhere, as not every phone route sits under /v1/user/phone
+	case strings.Contains(route, "/user/phone"):
+		if read {
+			return ScopePhoneRead
+		}
+		return ScopePhoneWrite
+	case strings.HasPrefix(route, "/v1/user"):
+		if read {
+			return ScopeUserRead
+		}
+		return ScopeUserWrite
+	}
+
+	return ""
+}
@@ -0,0 +1,57 @@
+package apikey
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		route  string
+		want   string
+	}{
+		{http.MethodGet, "/v1/user/:id", ScopeUserRead},
+		{http.MethodHead, "/v1/user", ScopeUserRead},
+		{http.MethodPost, "/v1/user", ScopeUserWrite},
+		{http.MethodGet, "/v1/user/phone/:id", ScopePhoneRead},
+		{http.MethodPut, "/v1/user/phone/:id", ScopePhoneWrite},
+		{http.MethodDelete, "/v1/v1/user/phone/:id", ScopePhoneWrite},
+		{http.MethodPost, "/v1/user/phone/:id/verification", ScopePhoneWrite},
+		{http.MethodGet, "/v1/admin/audit", ScopeAdmin},
+
+		// a key could change the password or email and take the account over
+		{http.MethodPut, "/v1/user/:id", ""},
+		{http.MethodDelete, "/v1/user/:id", ""},
+
+		{http.MethodGet, "/v1/user/me/sessions", ""},
+		{http.MethodDelete, "/v1/user/me/sessions/:id", ""},
+		{http.MethodPost, "/v1/user/me/api-keys", ""},
+		{http.MethodDelete, "/v1/user/me/passkeys/:id", ""},
+		{http.MethodGet, "/userinfo", ""},
+		{http.MethodGet, "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := RequiredScope(tt.method, tt.route); got != tt.want {
+			t.Errorf("RequiredScope(%s, %q) = %q, want %q", tt.method, tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	key, prefix, err := Generate()
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	if got, ok := Prefix(key); !ok || got != prefix {
+		t.Fatalf("Prefix(%q) = %q, %v, want %q", key, got, ok, prefix)
+	}
+
+	for _, key := range []string{"", prefix, prefix + "_", "xx" + key[2:]} {
+		if got, ok := Prefix(key); ok {
+			t.Errorf("Prefix(%q) = %q, want no prefix", key, got)
+		}
+	}
+}
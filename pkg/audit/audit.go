@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"app/api/models"
+	"app/pkg/logger"
+	"app/storage"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const (
+	ActionRegister    = "user.register"
+	ActionLogin       = "auth.login"
+	ActionLoginFailed = "auth.login_failed"
+	ActionLogout      = "auth.logout"
+	ActionUserCreate  = "user.create"
+	ActionUserUpdate  = "user.update"
+	ActionUserDelete  = "user.delete"
+	ActionEmailVerify = "user.email_verify"
+	ActionPhoneCreate = "phone.create"
+	ActionPhoneUpdate = "phone.update"
+	ActionPhoneDelete = "phone.delete"
+	ActionPhoneVerify = "phone.verify"
+	ActionOTPSend     = "auth.otp_send"
+
+	ActionSessionRevoke       = "session.revoke"
+	ActionSessionRevokeOthers = "session.revoke_others"
+
+	ActionOAuthClientCreate = "oauth.client_create"
+	ActionOAuthClientDelete = "oauth.client_delete"
+	ActionOAuthAuthorize    = "oauth.authorize"
+	ActionOAuthRefreshReuse = "oauth.refresh_reuse"
+
+	ActionIdentityLink   = "identity.link"
+	ActionIdentityUnlink = "identity.unlink"
+
+	ActionAPIKeyCreate = "api_key.create"
+	ActionAPIKeyRevoke = "api_key.revoke"
+
+	ActionPasskeyRegister = "passkey.register"
+	ActionPasskeyRemove   = "passkey.remove"
+
+	TargetUser     = "user"
+	TargetPhone    = "phone"
+	TargetLogin    = "login"
+	TargetSession  = "session"
+	TargetClient   = "oauth_client"
+	TargetIdentity = "identity"
+	TargetAPIKey   = "api_key"
+	TargetPasskey  = "passkey"
+
+	redacted = "[REDACTED]"
+)
+
+// secretFields are never written to the audit log in clear text.
+var secretFields = []string{"password", "token", "secret"}
+
+// Recorder ...
+type Recorder interface {
+	Record(ctx context.Context, event *models.CreateAuditEvent)
+}
+
+type recorder struct {
+	repo storage.AuditRepoI
+	log  logger.LoggerI
+}
+
+// NewRecorder returns a Recorder that appends events to the audit_events table.
+// Failures are logged and never fail the audited request.
+func NewRecorder(repo storage.AuditRepoI, log logger.LoggerI) Recorder {
+	return &recorder{
+		repo: repo,
+		log:  log,
+	}
+}
+
+func (r *recorder) Record(ctx context.Context, event *models.CreateAuditEvent) {
+	_, err := r.repo.Create(ctx, event)
+	if err != nil {
+		r.log.Error("audit.record", logger.String("action", event.Action), logger.Error(err))
+	}
+}
+
+// Diff returns the fields which differ between before and after, with secret
+// fields redacted. Either side may be nil for create and delete events.
+func Diff(before, after interface{}) map[string]models.AuditChange {
+	var (
+		b       = toMap(before)
+		a       = toMap(after)
+		changes = map[string]models.AuditChange{}
+	)
+
+	for key, bv := range b {
+		av, ok := a[key]
+		if ok && reflect.DeepEqual(av, bv) {
+			continue
+		}
+		changes[key] = redact(key, models.AuditChange{Before: bv, After: av})
+	}
+
+	for key, av := range a {
+		if _, ok := b[key]; !ok {
+			changes[key] = redact(key, models.AuditChange{After: av})
+		}
+	}
+
+	// timestamps always change and carry no information
+	delete(changes, "created_at")
+	delete(changes, "updated_at")
+
+	return changes
+}
+
+func redact(key string, change models.AuditChange) models.AuditChange {
+	for _, secret := range secretFields {
+		if strings.Contains(strings.ToLower(key), secret) {
+			if change.Before != nil {
+				change.Before = redacted
+			}
+			if change.After != nil {
+				change.After = redacted
+			}
+		}
+	}
+
+	return change
+}
+
+func toMap(v interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return m
+	}
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		return m
+	}
+
+	_ = json.Unmarshal(body, &m)
+	return m
+}
@@ -0,0 +1,138 @@
+// Package certs reads the TLS certificates of the server from files and
+// picks up renewed ones without a restart.
+package certs
+
+import (
+	"app/pkg/logger"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader serves the certificate of a pair of PEM files, loading it again
+// when the files change on disk.
+type Reloader struct {
+	certPath string
+	keyPath  string
+	log      logger.LoggerI
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	stamp string // modification times and sizes of the files cert was loaded from
+}
+
+// NewReloader loads the certificate chain of certPath with the private key
+// of keyPath.
+func NewReloader(certPath, keyPath string, log logger.LoggerI) (*Reloader, error) {
+	r := &Reloader{certPath: certPath, keyPath: keyPath, log: log}
+
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate is the tls.Config callback which serves the current
+// certificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Watch checks the files every interval until ctx is done. A pair which
+// fails to load, such as one caught half written, keeps the current
+// certificate and is tried again on the next check.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reload()
+		if err != nil {
+			r.log.Error("Error reload TLS certificate: ", logger.Error(err))
+			continue
+		}
+		if reloaded {
+			r.mu.RLock()
+			r.log.Info("TLS certificate reloaded", logger.String("subject", r.cert.Leaf.Subject.String()), logger.Any("not_after", r.cert.Leaf.NotAfter))
+			r.mu.RUnlock()
+		}
+	}
+}
+
+// reload loads the files if they changed since the last load, and reports
+// whether it did.
+func (r *Reloader) reload() (bool, error) {
+	stamp, err := fileStamp(r.certPath, r.keyPath)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := stamp == r.stamp
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return false, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.stamp = stamp
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+// fileStamp changes whenever one of the files is replaced or written to.
+// Stat follows symlinks, so the swapped links of Kubernetes secret volumes
+// count as changes too.
+func fileStamp(paths ...string) (string, error) {
+	var stamp string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+
+	return stamp, nil
+}
+
+// LoadCertPool reads a PEM bundle of CA certificates.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no PEM certificate found in " + path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,130 @@
+package certs
+
+import (
+	"app/pkg/certs/certstest"
+	"app/pkg/logger"
+	"context"
+	"crypto/x509/pkix"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePair writes the files of pair and moves their modification time on,
+// as a renewal would, so the change shows on file systems with coarse times.
+func writePair(t *testing.T, certPath, keyPath string, pair *certstest.Pair, at time.Time) {
+	t.Helper()
+
+	for path, data := range map[string][]byte{certPath: pair.CertPEM, keyPath: pair.KeyPEM} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+		if err := os.Chtimes(path, at, at); err != nil {
+			t.Fatalf("chtimes %s: %v", path, err)
+		}
+	}
+}
+
+func serving(t *testing.T, r *Reloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	ca := certstest.NewCA(pkix.Name{CommonName: "Test CA"})
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Hour)
+
+	writePair(t, certPath, keyPath, ca.Issue(pkix.Name{CommonName: "first"}, "app.test"), start)
+	r, err := NewReloader(certPath, keyPath, logger.NewLogger("test", logger.LevelFatal))
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	if got := serving(t, r); got != "first" {
+		t.Fatalf("serving %q, want first", got)
+	}
+
+	if reloaded, err := r.reload(); reloaded || err != nil {
+		t.Fatalf("reload of unchanged files = %v, %v, want no reload", reloaded, err)
+	}
+
+	writePair(t, certPath, keyPath, ca.Issue(pkix.Name{CommonName: "renewed"}, "app.test"), start.Add(time.Minute))
+	if reloaded, err := r.reload(); !reloaded || err != nil {
+		t.Fatalf("reload of renewed files = %v, %v", reloaded, err)
+	}
+	if got := serving(t, r); got != "renewed" {
+		t.Fatalf("serving %q, want renewed", got)
+	}
+
+	// a certificate caught half written keeps the current one
+	renewed, _ := os.ReadFile(certPath)
+	if err := os.WriteFile(certPath, renewed[:len(renewed)/2], 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := r.reload(); err == nil {
+		t.Fatal("reload of a half written certificate succeeded")
+	}
+	if got := serving(t, r); got != "renewed" {
+		t.Fatalf("serving %q after a failed reload, want renewed", got)
+	}
+}
+
+func TestReloaderWatch(t *testing.T) {
+	ca := certstest.NewCA(pkix.Name{CommonName: "Test CA"})
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Hour)
+
+	writePair(t, certPath, keyPath, ca.Issue(pkix.Name{CommonName: "first"}), start)
+	r, err := NewReloader(certPath, keyPath, logger.NewLogger("test", logger.LevelFatal))
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, time.Millisecond)
+
+	writePair(t, certPath, keyPath, ca.Issue(pkix.Name{CommonName: "renewed"}), start.Add(time.Minute))
+	for deadline := time.Now().Add(5 * time.Second); serving(t, r) != "renewed"; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not pick up the renewed certificate")
+		}
+	}
+}
+
+func TestNewReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), logger.NewLogger("test", logger.LevelFatal)); err == nil {
+		t.Fatal("NewReloader without files succeeded")
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	dir := t.TempDir()
+	ca := certstest.NewCA(pkix.Name{CommonName: "Test CA"})
+
+	path := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(path, ca.CertPEM, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadCertPool(path); err != nil {
+		t.Fatalf("LoadCertPool: %v", err)
+	}
+
+	empty := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadCertPool(empty); err == nil {
+		t.Fatal("LoadCertPool of a file without certificates succeeded")
+	}
+}
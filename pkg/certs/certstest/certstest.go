@@ -0,0 +1,97 @@
+// Package certstest issues certificates for tests and local runs, in the
+// spirit of net/http/httptest. A CA signs server and client certificates with
+// ECDSA P-256 keys, valid for a day, and hands them out as PEM.
+package certstest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"sync/atomic"
+	"time"
+)
+
+// Pair is a certificate with its private key.
+type Pair struct {
+	Cert *x509.Certificate
+
+	// CertPEM and KeyPEM are the files tls.LoadX509KeyPair reads.
+	CertPEM []byte
+	KeyPEM  []byte
+
+	key *ecdsa.PrivateKey
+}
+
+// CA is a self-signed certificate authority.
+type CA struct {
+	Pair
+
+	serial int64
+}
+
+// NewCA makes a CA of subject.
+func NewCA(subject pkix.Name) *CA {
+	ca := &CA{}
+	ca.Pair = *ca.sign(&x509.Certificate{
+		Subject:               subject,
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	})
+
+	return ca
+}
+
+// Issue makes a certificate of subject for both server and client auth,
+// valid for dnsNames.
+func (ca *CA) Issue(subject pkix.Name, dnsNames ...string) *Pair {
+	return ca.sign(&x509.Certificate{
+		Subject:     subject,
+		DNSNames:    dnsNames,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	})
+}
+
+// sign makes a key for template and signs it with the key of ca, or with
+// its own while ca has none.
+func (ca *CA) sign(template *x509.Certificate) *Pair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic("certstest: failed to generate a key: " + err.Error())
+	}
+
+	template.SerialNumber = big.NewInt(atomic.AddInt64(&ca.serial, 1))
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(24 * time.Hour)
+
+	parent, signer := template, key
+	if ca.key != nil {
+		parent, signer = ca.Cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		panic("certstest: failed to create a certificate: " + err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic("certstest: failed to parse a certificate: " + err.Error())
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic("certstest: failed to marshal a key: " + err.Error())
+	}
+
+	return &Pair{
+		Cert:    cert,
+		CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		key:     key,
+	}
+}
@@ -0,0 +1,204 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// CheckFunc reports a dependency as healthy by returning nil.
+type CheckFunc func(ctx context.Context) error
+
+// Result ...
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Report ...
+type Report struct {
+	Status    string    `json:"status"`
+	Checks    []Result  `json:"checks"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      CheckFunc
+}
+
+// Registry runs the registered checks concurrently and caches the report for cacheTTL,
+// so frequent probes do not hammer the dependencies.
+type Registry struct {
+	cacheTTL time.Duration
+
+	mu           sync.Mutex
+	checks       []check
+	generation   int // counts Register calls, so runs started before one are not cached
+	cached       *Report
+	running      *flight
+	shuttingDown bool
+}
+
+// flight is a run of the checks which the callers arriving meanwhile wait for.
+type flight struct {
+	done   chan struct{}
+	report Report
+}
+
+func NewRegistry(cacheTTL time.Duration) *Registry {
+	return &Registry{
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Register adds a check which fails when fn does not return within timeout.
+func (r *Registry) Register(name string, timeout time.Duration, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks = append(r.checks, check{name: name, timeout: timeout, fn: fn})
+	r.generation++
+	r.cached = nil
+}
+
+// Shutdown makes every following Run report down, so load balancers stop
+// routing new requests while the in-flight ones drain.
+func (r *Registry) Shutdown() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.shuttingDown = true
+}
+
+// Run returns the cached report or runs every check. The checks run on a
+// context without the deadline and cancellation of ctx, bounded by their own
+// timeouts, and only one run is in flight at a time. A caller whose ctx ends
+// first gets a down report, which is not cached, while the run goes on for
+// the next callers.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.Lock()
+
+	if r.shuttingDown {
+		r.mu.Unlock()
+		return Report{
+			Status:    StatusDown,
+			Checks:    []Result{{Name: "shutdown", Status: StatusDown, Error: "server is shutting down"}},
+			CheckedAt: time.Now(),
+		}
+	}
+
+	if r.cached != nil && time.Since(r.cached.CheckedAt) < r.cacheTTL {
+		report := *r.cached
+		r.mu.Unlock()
+		return report
+	}
+
+	f := r.running
+	if f == nil {
+		f = &flight{done: make(chan struct{})}
+		r.running = f
+		go r.runChecks(detach(ctx), f, r.checks, r.generation)
+	}
+
+	r.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.report
+	case <-ctx.Done():
+		return Report{
+			Status:    StatusDown,
+			Checks:    []Result{{Name: "request", Status: StatusDown, Error: ctx.Err().Error()}},
+			CheckedAt: time.Now(),
+		}
+	}
+}
+
+// runChecks runs checks concurrently and hands the report to f, caching it
+// unless checks were registered meanwhile.
+func (r *Registry) runChecks(ctx context.Context, f *flight, checks []check, generation int) {
+	report := Report{
+		Status:    StatusUp,
+		Checks:    make([]Result, len(checks)),
+		CheckedAt: time.Now(),
+	}
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			report.Checks[i] = run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.running = nil
+	if generation == r.generation {
+		r.cached = &report
+	}
+	f.report = report
+	close(f.done)
+}
+
+func run(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.fn(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{
+		Name:      c.name,
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// detached keeps the values of a context, such as its trace, but not its
+// deadline or cancellation, like context.WithoutCancel of Go 1.21.
+type detached struct {
+	parent context.Context
+}
+
+func detach(ctx context.Context) context.Context { return detached{parent: ctx} }
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
@@ -0,0 +1,176 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+func TestRun(t *testing.T) {
+	r := NewRegistry(time.Minute)
+	r.Register("db", time.Second, func(ctx context.Context) error { return nil })
+	r.Register("cache", time.Second, func(ctx context.Context) error { return errors.New("connection refused") })
+
+	report := r.Run(context.Background())
+	if report.Status != StatusDown || len(report.Checks) != 2 {
+		t.Fatalf("report = %+v, want down with two checks", report)
+	}
+	if got := report.Checks[0]; got.Name != "db" || got.Status != StatusUp {
+		t.Errorf("db = %+v, want up", got)
+	}
+	if got := report.Checks[1]; got.Name != "cache" || got.Status != StatusDown || got.Error != "connection refused" {
+		t.Errorf("cache = %+v, want down with the error", got)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	r := NewRegistry(0)
+	r.Register("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	report := r.Run(context.Background())
+	if report.Status != StatusDown || report.Checks[0].Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("report = %+v, want the check timed out", report)
+	}
+}
+
+func TestRunCaches(t *testing.T) {
+	var calls int32
+	r := NewRegistry(time.Minute)
+	r.Register("db", time.Second, func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	first := r.Run(context.Background())
+	second := r.Run(context.Background())
+	if calls != 1 || !second.CheckedAt.Equal(first.CheckedAt) {
+		t.Fatalf("%d runs, want the second report from the cache", calls)
+	}
+
+	// a new check makes the cached report stale
+	r.Register("cache", time.Second, func(ctx context.Context) error { return nil })
+	if report := r.Run(context.Background()); calls != 2 || len(report.Checks) != 2 {
+		t.Fatalf("%d runs with %d checks, want a new run of both", calls, len(report.Checks))
+	}
+}
+
+// blockingRegistry has one check which counts its calls and waits for release.
+func blockingRegistry(cacheTTL time.Duration) (r *Registry, started chan context.Context, release chan struct{}, calls *int32) {
+	r = NewRegistry(cacheTTL)
+	started = make(chan context.Context, 10)
+	release = make(chan struct{})
+	calls = new(int32)
+
+	r.Register("db", time.Second, func(ctx context.Context) error {
+		atomic.AddInt32(calls, 1)
+		started <- ctx
+		<-release
+		return ctx.Err()
+	})
+
+	return r, started, release, calls
+}
+
+func TestRunCancelledCaller(t *testing.T) {
+	r, started, release, calls := blockingRegistry(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "trace"))
+	done := make(chan Report)
+	go func() { done <- r.Run(ctx) }()
+
+	checkCtx := <-started
+	cancel()
+
+	// the caller gets its answer without waiting for the check
+	report := <-done
+	if report.Status != StatusDown || report.Checks[0].Error != context.Canceled.Error() {
+		t.Fatalf("report = %+v, want down for the cancelled request", report)
+	}
+
+	// the check keeps the values of the request but not its cancellation
+	if checkCtx.Value(ctxKey{}) != "trace" {
+		t.Errorf("check context lost the values of the request")
+	}
+	if checkCtx.Err() != nil {
+		t.Errorf("check context error = %v, want it running on", checkCtx.Err())
+	}
+
+	close(release)
+
+	// the next caller waits for the same run and gets its result, not the
+	// report of the cancelled request
+	report = r.Run(context.Background())
+	if report.Status != StatusUp {
+		t.Fatalf("report = %+v, want up", report)
+	}
+	if report = r.Run(context.Background()); report.Status != StatusUp || atomic.LoadInt32(calls) != 1 {
+		t.Fatalf("report = %+v after %d runs, want the cached report of one run", report, atomic.LoadInt32(calls))
+	}
+}
+
+func TestRunSharesFlight(t *testing.T) {
+	r, started, release, calls := blockingRegistry(0)
+
+	var wg sync.WaitGroup
+	reports := make([]Report, 5)
+	for i := range reports {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reports[i] = r.Run(context.Background())
+		}(i)
+	}
+
+	<-started
+	// the lock is not held while the check runs
+	shutdown := make(chan struct{})
+	go func() {
+		r.Shutdown()
+		close(shutdown)
+	}()
+	select {
+	case <-shutdown:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown waited for the running check")
+	}
+
+	close(release)
+	wg.Wait()
+
+	if atomic.LoadInt32(calls) != 1 {
+		t.Fatalf("%d runs for concurrent callers, want 1", atomic.LoadInt32(calls))
+	}
+	for _, report := range reports {
+		if report.Status != StatusUp && report.Checks[0].Name != "shutdown" {
+			t.Fatalf("report = %+v", report)
+		}
+	}
+	if report := r.Run(context.Background()); report.Status != StatusDown || report.Checks[0].Name != "shutdown" {
+		t.Fatalf("report after Shutdown = %+v, want down", report)
+	}
+}
+
+func TestRunRegisterDuringRun(t *testing.T) {
+	r, started, release, calls := blockingRegistry(time.Minute)
+
+	done := make(chan Report)
+	go func() { done <- r.Run(context.Background()) }()
+	<-started
+
+	r.Register("cache", time.Second, func(ctx context.Context) error { return nil })
+	close(release)
+	<-done
+
+	// the report without the new check was not cached
+	if report := r.Run(context.Background()); len(report.Checks) != 2 || atomic.LoadInt32(calls) != 2 {
+		t.Fatalf("report = %+v after %d runs, want a new run with both checks", report, atomic.LoadInt32(calls))
+	}
+}
@@ -36,19 +36,28 @@ func ReplaceSQL(old, searchPattern string) string {
 
 const otpChars = "1234567890"
 
+// GenerateOTP returns length random digits.
 func GenerateOTP(length int) (string, error) {
+	otpCharsLength := len(otpChars)
+	// bytes from limit up are dropped, so every digit is equally likely
+	limit := 256 - 256%otpCharsLength
+
+	code := make([]byte, 0, length)
 	buffer := make([]byte, length)
-	_, err := rand.Read(buffer)
-	if err != nil {
-		return "", err
-	}
+	for len(code) < length {
+		_, err := rand.Read(buffer)
+		if err != nil {
+			return "", err
+		}
 
-	otpCharsLength := len(otpChars)
-	for i := 0; i < length; i++ {
-		buffer[i] = otpChars[int(buffer[i])%otpCharsLength]
+		for _, b := range buffer {
+			if int(b) < limit && len(code) < length {
+				code = append(code, otpChars[int(b)%otpCharsLength])
+			}
+		}
 	}
 
-	return string(buffer), nil
+	return string(code), nil
 }
 
 func Difference(a, b []int32) []int32 {
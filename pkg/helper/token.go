@@ -4,78 +4,61 @@ import (
 	"errors"
 	"strings"
 	"time"
-
-	"github.com/dgrijalva/jwt-go"
-	"github.com/spf13/cast"
 )
 
 type TokenInfo struct {
-	UserID     string `json:"user_id"`
+	UserID    string    `json:"user_id"` // empty for client_credentials tokens
+	ID        string    `json:"jti"`
+	SessionID string    `json:"sid"`       // empty for tokens not tied to a login session
+	ClientID  string    `json:"client_id"` // set on tokens issued to an OAuth client
+	Scope     string    `json:"scope"`
+	ExpiresAt time.Time `json:"exp"`        // when issuing, zero means now plus TTL
+	APIKeyID  string    `json:"api_key_id"` // set when the request authenticated with a personal API key
+	Principal string    `json:"principal"`  // set when a service authenticated with its client certificate
 }
 
-// GenerateJWT ...
-func GenerateJWT(m map[string]interface{}, tokenExpireTime time.Duration, tokenSecretKey string) (tokenString string, err error) {
-	var token *jwt.Token
-
-	token = jwt.New(jwt.SigningMethodHS256)
-
-	claims := token.Claims.(jwt.MapClaims)
-
-	for key, value := range m {
-		claims[key] = value
-	}
-
-	claims["iat"] = time.Now().Unix()
-	claims["exp"] = time.Now().Add(tokenExpireTime).Unix()
-
-	tokenString, err = token.SignedString([]byte(tokenSecretKey))
-	if err != nil {
-		return "", err
-	}
-
-	return tokenString, nil
+// IDToken is an OpenID Connect ID token. Claims left empty are not released.
+type IDToken struct {
+	Audience            string // client_id
+	Nonce               string
+	ExpiresAt           time.Time
+	Subject             string
+	Name                string
+	PhoneNumber         string
+	PhoneNumberVerified *bool
 }
 
-func ParseClaims(token string, secretKey string) (result TokenInfo, err error) {
-	var claims jwt.MapClaims
-
-	claims, err = ExtractClaims(token, secretKey)
-	if err != nil {
-		return result, err
-	}
-
-	result.UserID = cast.ToString(claims["user_id"])
-	if len(result.UserID) <= 0 {
-		err = errors.New("cannot parse 'user_id' field")
-		return result, err
-	}
-
-
-	return
+// TokenIssuer issues and verifies access tokens.
+type TokenIssuer interface {
+	// Issue returns a signed token carrying info.UserID, or info.ClientID for
+	// tokens issued to a client on its own behalf.
+	Issue(info TokenInfo) (string, error)
+	// IssueIDToken returns a signed OpenID Connect ID token.
+	IssueIDToken(token IDToken) (string, error)
+	// Verify checks tokenString and returns its claims.
+	Verify(tokenString string) (TokenInfo, error)
+	// TTL is the lifetime of issued tokens.
+	TTL() time.Duration
+	// JWKS returns the public keys tokens may be verified with.
+	JWKS() JWKS
 }
 
-// ExtractClaims extracts claims from given token
-func ExtractClaims(tokenString string, tokenSecretKey string) (jwt.MapClaims, error) {
-	var (
-		token *jwt.Token
-		err   error
-	)
-
-	token, err = jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// check token signing method etc
-		return []byte(tokenSecretKey), nil
-	})
-
-	if err != nil {
-		return nil, err
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !(ok && token.Valid) {
-		return nil, errors.New("invalid token")
-	}
+// JWK is a public key in the RFC 7517 JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
 
-	return claims, nil
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
 }
 
 // ExtractToken checks and returns token part of input string
@@ -3,6 +3,7 @@ package helper
 import (
 	"errors"
 	"regexp"
+	"strings"
 )
 
 func ValidPinfl(pinfl string) error {
@@ -63,3 +64,57 @@ func IsValidPrice(price string) bool {
 	r := regexp.MustCompile(`^\d+$`)
 	return r.MatchString(price)
 }
+
+// ValidLogin checks a new login name. It may not contain "@", which marks
+// an email address in the login field of /login.
+func ValidLogin(login string) error {
+	if len(login) < 6 {
+		return errors.New("Login length must be longer than 6")
+	}
+	if strings.Contains(login, "@") {
+		return errors.New("Login must not contain @")
+	}
+	return nil
+}
+
+// ValidLoginPassword checks login credentials. New passwords go through password.Policy instead.
+func ValidLoginPassword(login, password string) error {
+	if len(login) < 6 || len(password) < 6 {
+		return errors.New("Login and Password length must be longer than 6")
+	}
+	return nil
+}
+
+// ValidPhoneNumber ...
+func ValidPhoneNumber(phone string) error {
+	if len(phone) > 12 {
+		return errors.New("Invalid phone number")
+	}
+	return nil
+}
+
+var phoneNumberChars = regexp.MustCompile(`[^0-9+]`)
+
+// NormalizePhone drops everything but digits and "+" from a phone number, so
+// "+998 (90) 123-45-67" and "+998901234567" compare equal, and checks that
+// what is left looks like a number an SMS can be sent to.
+func NormalizePhone(phone string) (string, error) {
+	phone = phoneNumberChars.ReplaceAllString(phone, "")
+
+	digits := strings.TrimPrefix(phone, "+")
+	if len(digits) < 6 || len(digits) > 15 || strings.Contains(digits, "+") {
+		return "", errors.New("invalid phone number")
+	}
+
+	return phone, nil
+}
+
+// ValidRole ...
+func ValidRole(role string) error {
+	switch role {
+	case "user", "admin":
+		return nil
+	default:
+		return errors.New("role must be one of: user, admin")
+	}
+}
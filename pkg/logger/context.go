@@ -0,0 +1,19 @@
+package logger
+
+import "context"
+
+type ctxKey struct{}
+
+// ToContext returns a copy of ctx carrying l.
+func ToContext(ctx context.Context, l LoggerI) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the logger stored in ctx, or fallback when there is none.
+func FromContext(ctx context.Context, fallback LoggerI) LoggerI {
+	if l, ok := ctx.Value(ctxKey{}).(LoggerI); ok {
+		return l
+	}
+
+	return fallback
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "app"
+
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+)
+
+// PoolStater is implemented by storages backed by a pgx connection pool.
+type PoolStater interface {
+	Stat() *pgxpool.Stat
+}
+
+// Metrics ...
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	logins           *prometheus.CounterVec
+	passwordHashTime prometheus.Histogram
+}
+
+// New registers the application metrics on registry. Pass a fresh
+// prometheus.NewRegistry() in tests to scrape it in isolation.
+func New(registry *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		registry: registry,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route template and status.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route template and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Number of login attempts by result.",
+		}, []string{"result"}),
+		passwordHashTime: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "password_hash_duration_seconds",
+			Help:      "Time spent hashing passwords.",
+			Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2, 4},
+		}),
+	}
+
+	registry.MustRegister(
+		m.httpRequests,
+		m.httpDuration,
+		m.logins,
+		m.passwordHashTime,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// RegisterPool exports the connection pool statistics of store.
+func (m *Metrics) RegisterPool(store PoolStater) {
+	m.registry.MustRegister(newPoolCollector(store))
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest ...
+func (m *Metrics) ObserveRequest(method, route, status string, duration time.Duration) {
+	m.httpRequests.WithLabelValues(method, route, status).Inc()
+	m.httpDuration.WithLabelValues(method, route, status).Observe(duration.Seconds())
+}
+
+// ObserveLogin counts a login attempt, result is LoginSuccess or LoginFailure.
+func (m *Metrics) ObserveLogin(result string) {
+	m.logins.WithLabelValues(result).Inc()
+}
+
+// ObservePasswordHash ...
+func (m *Metrics) ObservePasswordHash(duration time.Duration) {
+	m.passwordHashTime.Observe(duration.Seconds())
+}
@@ -0,0 +1,82 @@
+package notify
+
+import (
+	"app/config"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	EmailSenderSMTP = "smtp"
+	EmailSenderFile = "file"
+)
+
+// Email is a plain text message to one recipient.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// EmailSender delivers emails.
+type EmailSender interface {
+	SendEmail(ctx context.Context, email *Email) error
+}
+
+// NewEmailSender returns the sender selected by EMAIL_SENDER.
+func NewEmailSender(cfg *config.Config) (EmailSender, error) {
+	switch cfg.EmailSender {
+	case EmailSenderSMTP:
+		return NewSMTPSender(cfg), nil
+	case EmailSenderFile:
+		return NewMailboxSender(cfg.EmailFrom, cfg.EmailMailboxDir)
+	default:
+		return nil, fmt.Errorf("unsupported email sender %q", cfg.EmailSender)
+	}
+}
+
+// formatMessage renders email as an RFC 5322 message with CRLF line endings.
+func formatMessage(from string, email *Email, now time.Time) ([]byte, error) {
+	if strings.ContainsAny(email.To+email.Subject, "\r\n") {
+		return nil, errors.New("email header contains a line break")
+	}
+	if _, err := mail.ParseAddress(email.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", email.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(email.Body, "\r\n", "\n")
+	for _, line := range strings.Split(body, "\n") {
+		buf.WriteString(line + "\r\n")
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// MailboxSender writes every email as an .eml file into a directory instead
+// of sending it, for local runs. Open the files with any mail client.
+type MailboxSender struct {
+	from string
+	dir  string
+	now  func() time.Time
+}
+
+func NewMailboxSender(from, dir string) (*MailboxSender, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	return &MailboxSender{
+		from: from,
+		dir:  dir,
+		now:  time.Now,
+	}, nil
+}
+
+func (s *MailboxSender) SendEmail(ctx context.Context, email *Email) error {
+	now := s.now()
+
+	msg, err := formatMessage(s.from, email, now)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), unsafeFileChars.ReplaceAllString(email.To, "_"))
+
+	return os.WriteFile(filepath.Join(s.dir, name), msg, 0o600)
+}
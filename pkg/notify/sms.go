@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"app/config"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SMSSenderNone = "none"
+	SMSSenderFile = "file"
+)
+
+// SMS is a text message to one phone number.
+type SMS struct {
+	To   string
+	Body string
+}
+
+// SMSSender delivers text messages.
+type SMSSender interface {
+	SendSMS(ctx context.Context, sms *SMS) error
+}
+
+// NewSMSSender returns the sender selected by SMS_SENDER, or nil for none.
+func NewSMSSender(cfg *config.Config) (SMSSender, error) {
+	switch cfg.SMSSender {
+	case SMSSenderNone:
+		return nil, nil
+	case SMSSenderFile:
+		return NewOutboxSender(cfg.SMSOutboxPath)
+	default:
+		return nil, fmt.Errorf("unsupported sms sender %q", cfg.SMSSender)
+	}
+}
+
+// OutboxSender appends every message as one line to a file instead of
+// sending it, for local runs. Follow it with tail -f.
+type OutboxSender struct {
+	path string
+	now  func() time.Time
+
+	mu sync.Mutex
+}
+
+func NewOutboxSender(path string) (*OutboxSender, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OutboxSender{
+		path: path,
+		now:  time.Now,
+	}, f.Close()
+}
+
+func (s *OutboxSender) SendSMS(ctx context.Context, sms *SMS) error {
+	body := strings.NewReplacer("\r\n", " ", "\n", " ").Replace(sms.Body)
+	line := fmt.Sprintf("%s\t%s\t%s\n", s.now().UTC().Format(time.RFC3339), sms.To, body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.WriteString(line); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
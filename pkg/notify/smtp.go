@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"app/config"
+	"context"
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTPSender delivers emails through an SMTP relay. The connection is
+// upgraded with STARTTLS when the server offers it; credentials are only
+// sent over TLS or to localhost.
+type SMTPSender struct {
+	addr     string
+	host     string
+	from     string
+	username string
+	password string
+	timeout  time.Duration
+	now      func() time.Time
+}
+
+func NewSMTPSender(cfg *config.Config) *SMTPSender {
+	return &SMTPSender{
+		addr:     net.JoinHostPort(cfg.EmailSMTPHost, cfg.EmailSMTPPort),
+		host:     cfg.EmailSMTPHost,
+		from:     cfg.EmailFrom,
+		username: cfg.EmailSMTPUsername,
+		password: cfg.EmailSMTPPassword,
+		timeout:  cfg.EmailSMTPTimeout,
+		now:      time.Now,
+	}
+}
+
+func (s *SMTPSender) SendEmail(ctx context.Context, email *Email) error {
+	msg, err := formatMessage(s.from, email, s.now())
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+
+	if len(s.username) > 0 {
+		if err = client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(to.Address); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,134 @@
+package notify
+
+import (
+	"app/config"
+	"app/pkg/notify/smtptest"
+	"bytes"
+	"context"
+	"io"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSMTPSender(srv *smtptest.Server) *SMTPSender {
+	s := NewSMTPSender(&config.Config{
+		EmailFrom:        "App <no-reply@app.test>",
+		EmailSMTPHost:    srv.Host,
+		EmailSMTPPort:    srv.Port,
+		EmailSMTPTimeout: 5 * time.Second,
+	})
+	s.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	return s
+}
+
+func TestSMTPSender(t *testing.T) {
+	srv := smtptest.NewServer()
+	defer srv.Close()
+
+	err := newTestSMTPSender(srv).SendEmail(context.Background(), &Email{
+		To:      "Alice <alice@example.com>",
+		Subject: "Confirm your email address",
+		Body:    "Hello Alice,\n\nopen this link.\n",
+	})
+	if err != nil {
+		t.Fatalf("SendEmail: %v", err)
+	}
+
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d messages, want 1", len(messages))
+	}
+	got := messages[0]
+	if got.From != "no-reply@app.test" || len(got.To) != 1 || got.To[0] != "alice@example.com" {
+		t.Fatalf("envelope = %s to %v, want no-reply@app.test to [alice@example.com]", got.From, got.To)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(got.Data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	headers := map[string]string{
+		"From":         "App <no-reply@app.test>",
+		"To":           "Alice <alice@example.com>",
+		"Subject":      "Confirm your email address",
+		"Date":         "Fri, 01 Mar 2024 12:00:00 +0000",
+		"Content-Type": "text/plain; charset=utf-8",
+	}
+	for name, want := range headers {
+		if value := msg.Header.Get(name); value != want {
+			t.Errorf("%s = %q, want %q", name, value, want)
+		}
+	}
+	if id := msg.Header.Get("Message-Id"); !strings.HasSuffix(id, "@app.test>") {
+		t.Errorf("Message-Id = %q, want one at app.test", id)
+	}
+
+	// the server hands the DATA lines over with the CRLF turned into LF
+	body, err := io.ReadAll(msg.Body)
+	if err != nil || !strings.HasPrefix(string(body), "Hello Alice,\n\nopen this link.\n") {
+		t.Errorf("body = %q, %v", body, err)
+	}
+}
+
+func TestSMTPSenderEncodesSubject(t *testing.T) {
+	srv := smtptest.NewServer()
+	defer srv.Close()
+
+	err := newTestSMTPSender(srv).SendEmail(context.Background(), &Email{To: "alice@example.com", Subject: "Подтвердите адрес", Body: "-"})
+	if err != nil {
+		t.Fatalf("SendEmail: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(srv.Messages()[0].Data))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	raw := msg.Header.Get("Subject")
+	if !strings.HasPrefix(raw, "=?utf-8?q?") {
+		t.Fatalf("Subject = %q, want it Q-encoded", raw)
+	}
+	subject, err := new(mail.AddressParser).WordDecoder.DecodeHeader(raw)
+	if err != nil || subject != "Подтвердите адрес" {
+		t.Fatalf("decoded Subject = %q, %v", subject, err)
+	}
+}
+
+func TestSMTPSenderRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		email Email
+	}{
+		{"line break in the subject", Email{To: "alice@example.com", Subject: "Hi\r\nBcc: eve@example.com"}},
+		{"line break in the recipient", Email{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi"}},
+		{"invalid recipient", Email{To: "alice", Subject: "Hi"}},
+	}
+
+	srv := smtptest.NewServer()
+	defer srv.Close()
+	sender := newTestSMTPSender(srv)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := sender.SendEmail(context.Background(), &tt.email); err == nil {
+				t.Fatal("SendEmail accepted the email")
+			}
+		})
+	}
+
+	if messages := srv.Messages(); len(messages) > 0 {
+		t.Fatalf("%d messages sent, want none", len(messages))
+	}
+}
+
+func TestSMTPSenderUnreachable(t *testing.T) {
+	srv := smtptest.NewServer()
+	sender := newTestSMTPSender(srv)
+	srv.Close()
+
+	if err := sender.SendEmail(context.Background(), &Email{To: "alice@example.com", Subject: "Hi"}); err == nil {
+		t.Fatal("SendEmail reported no error without a server")
+	}
+}
@@ -0,0 +1,56 @@
+package oauth
+
+import (
+	"app/api/models"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultGrantTypes are given to clients registered without grant types.
+var DefaultGrantTypes = []string{GrantAuthorizationCode, GrantRefreshToken}
+
+// ValidateClient checks a client registration and fills in the default grant
+// types. Redirect URIs must be absolute without a fragment and are later
+// matched exactly.
+func ValidateClient(req *models.CreateOAuthClient) error {
+	if len(strings.TrimSpace(req.Name)) <= 0 {
+		return errors.New("name is required")
+	}
+
+	if len(req.GrantTypes) <= 0 {
+		req.GrantTypes = DefaultGrantTypes
+	}
+
+	for _, grant := range req.GrantTypes {
+		switch grant {
+		case GrantAuthorizationCode, GrantRefreshToken:
+		case GrantClientCredentials:
+			if req.Public {
+				return errors.New("public clients cannot use the client_credentials grant")
+			}
+		default:
+			return fmt.Errorf("unsupported grant type %q", grant)
+		}
+	}
+
+	if HasScope(req.GrantTypes, GrantAuthorizationCode) && len(req.RedirectURIs) <= 0 {
+		return errors.New("the authorization_code grant needs at least one redirect uri")
+	}
+
+	for _, uri := range req.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || len(u.Host) <= 0 || len(u.Fragment) > 0 {
+			return fmt.Errorf("invalid redirect uri %q", uri)
+		}
+	}
+
+	for _, scope := range req.Scopes {
+		if len(scope) <= 0 || strings.ContainsAny(scope, " \t\r\n\"\\") {
+			return fmt.Errorf("invalid scope %q", scope)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+// Package oauth holds the protocol pieces of the OAuth 2.0 authorization
+// server (RFC 6749) that do not depend on HTTP or storage: opaque token
+// generation and hashing, PKCE (RFC 7636), scopes and error codes.
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+
+	ResponseTypeCode = "code"
+
+	ChallengeS256 = "S256"
+
+	// TokenTypeBearer is the token_type of issued access tokens; the others
+	// are token_type_hint values of the revoke and introspect endpoints.
+	TokenTypeBearer  = "Bearer"
+	TokenTypeAccess  = "access_token"
+	TokenTypeRefresh = "refresh_token"
+)
+
+// Error codes of RFC 6749 section 4.1.2.1 and 5.2.
+const (
+	ErrInvalidRequest          = "invalid_request"
+	ErrInvalidClient           = "invalid_client"
+	ErrInvalidGrant            = "invalid_grant"
+	ErrInvalidScope            = "invalid_scope"
+	ErrUnauthorizedClient      = "unauthorized_client"
+	ErrUnsupportedGrantType    = "unsupported_grant_type"
+	ErrUnsupportedResponseType = "unsupported_response_type"
+	ErrAccessDenied            = "access_denied"
+	ErrServerError             = "server_error"
+)
+
+// Error is the JSON error body of the token, revoke and introspect endpoints.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Description) > 0 {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+func NewError(code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+// verifierPattern is the code_verifier alphabet and length of RFC 7636 section 4.1.
+var verifierPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+
+// GenerateToken returns 32 random bytes, base64url encoded, for authorization
+// codes, refresh tokens and client secrets.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 of a generated token. Generated tokens
+// carry 256 bits of entropy, so a fast hash is enough to keep them useless
+// when read from the database.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckTokenHash compares token with a HashToken result in constant time.
+func CheckTokenHash(token, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
+
+// VerifyPKCE checks code_verifier against the S256 code_challenge. The plain
+// method is not supported.
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if method != ChallengeS256 || !verifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(challenge)) == 1
+}
+
+// S256Challenge returns the S256 code_challenge of verifier.
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParseScope splits a space separated scope parameter, dropping duplicates.
+func ParseScope(scope string) []string {
+	var (
+		scopes []string
+		seen   = map[string]bool{}
+	)
+
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+// FormatScope joins scopes into a scope parameter.
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// ScopeAllowed reports whether every requested scope is in allowed.
+func ScopeAllowed(requested, allowed []string) bool {
+	for _, r := range requested {
+		if !HasScope(allowed, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasScope reports whether scopes contains scope.
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+// Package oidc holds the OpenID Connect layer on top of the OAuth 2.0
+// authorization server: the scopes and which user claims each releases. It
+// is also the relying party for logging in through upstream providers.
+package oidc
+
+import (
+	"app/api/models"
+	"app/pkg/oauth"
+)
+
+const (
+	// ScopeOpenID turns an authorization request into an OpenID Connect one,
+	// adding an ID token to the token response.
+	ScopeOpenID = "openid"
+	// ScopeProfile releases name.
+	ScopeProfile = "profile"
+	// ScopePhone releases phone_number and phone_number_verified.
+	ScopePhone = "phone"
+)
+
+// Scopes are the OpenID Connect scopes, in the order of the discovery document.
+var Scopes = []string{ScopeOpenID, ScopeProfile, ScopePhone}
+
+// Claims are the claim names the scopes can release.
+var Claims = []string{"sub", "iss", "aud", "exp", "iat", "nonce", "name", "phone_number", "phone_number_verified"}
+
+// UserInfo returns the claims of user that scopes release. phones are the
+// user's phones, oldest first; the first verified one which is not a fax is
+// released, else the first one which is not a fax.
+func UserInfo(scopes []string, user *models.User, phones []*models.Phone) *models.UserInfo {
+	info := &models.UserInfo{Sub: user.Id}
+
+	if oauth.HasScope(scopes, ScopeProfile) {
+		info.Name = user.Name
+	}
+
+	if oauth.HasScope(scopes, ScopePhone) {
+		var released *models.Phone
+		for _, phone := range phones {
+			if phone.IsFax {
+				continue
+			}
+			if released == nil || (phone.Verified && !released.Verified) {
+				released = phone
+			}
+		}
+
+		if released != nil {
+			verified := released.Verified
+			info.PhoneNumber = released.Phone
+			info.PhoneNumberVerified = &verified
+		}
+	}
+
+	return info
+}
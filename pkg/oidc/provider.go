@@ -0,0 +1,395 @@
+package oidc
+
+import (
+	"app/config"
+	"app/pkg/helper"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// keysRefreshInterval limits how often an unknown kid makes the signing
+	// keys of a provider be fetched again.
+	keysRefreshInterval = time.Minute
+	maxResponseBytes    = 1 << 20
+	httpTimeout         = 10 * time.Second
+)
+
+// idTokenAlgs are the signing algorithms accepted on upstream ID tokens.
+var idTokenAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// ErrInvalidIDToken is returned by Exchange when the ID token fails validation.
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// Identity is the account at an upstream provider which an ID token vouched for.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an upstream OpenID Connect identity provider users log in with
+// through the authorization code flow with PKCE. Its discovery document and
+// signing keys are fetched on first use, so an unreachable provider does not
+// keep the service from starting.
+type Provider struct {
+	Name string
+
+	cfg         config.OIDCProvider
+	redirectURL string
+	client      *http.Client
+	now         func() time.Time
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// metadata is the part of the discovery document a relying party needs.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type idTokenClaims struct {
+	Nonce             string      `json:"nonce"`
+	AuthorizedParty   string      `json:"azp"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"` // some providers send "true"
+	Name              string      `json:"name"`
+	PreferredUsername string      `json:"preferred_username"`
+	jwt.RegisteredClaims
+}
+
+// NewProviders returns the providers of cfg by name. Their redirect URI is
+// {PUBLIC_URL}/login/{name}/callback.
+func NewProviders(cfg *config.Config) map[string]*Provider {
+	providers := make(map[string]*Provider, len(cfg.OIDCProviders))
+
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name] = &Provider{
+			Name:        p.Name,
+			cfg:         p,
+			redirectURL: cfg.PublicURL + "/login/" + p.Name + "/callback",
+			client:      &http.Client{Timeout: httpTimeout},
+			now:         time.Now,
+		}
+	}
+
+	return providers
+}
+
+// Names returns the names of providers, sorted.
+func Names(providers map[string]*Provider) []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// AuthCodeURL returns the URL of the provider's authorization endpoint the
+// user is sent to. challenge is the S256 PKCE code_challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc %s: authorization_endpoint: %w", p.Name, err)
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code at the provider's token endpoint and
+// returns the identity from the validated ID token, which must carry nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {verifier},
+	}
+	if len(p.cfg.ClientSecret) <= 0 {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if len(p.cfg.ClientSecret) > 0 {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var token tokenResponse
+	status, err := p.do(req, &token)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK || len(token.Error) > 0 {
+		return nil, fmt.Errorf("oidc %s: token endpoint: %d %s %s", p.Name, status, token.Error, token.ErrorDescription)
+	}
+
+	return p.verify(ctx, md, token.IDToken, nonce)
+}
+
+// verify validates an ID token per OpenID Connect Core 3.1.3.7.
+func (p *Provider) verify(ctx context.Context, md *metadata, idToken, nonce string) (*Identity, error) {
+	var claims idTokenClaims
+
+	_, err := jwt.ParseWithClaims(idToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, md, kid)
+	},
+		jwt.WithValidMethods(idTokenAlgs),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithTimeFunc(p.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case len(claims.Subject) <= 0:
+		return nil, fmt.Errorf("%w: no sub", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID:
+		return nil, fmt.Errorf("%w: azp %q", ErrInvalidIDToken, claims.AuthorizedParty)
+	}
+
+	identity := &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified == true || claims.EmailVerified == "true",
+		Name:          claims.Name,
+	}
+	if len(identity.Name) <= 0 {
+		identity.Name = claims.PreferredUsername
+	}
+
+	return identity, nil
+}
+
+// discover fetches the discovery document once; failures are retried on the
+// next call.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var md metadata
+	status, err := p.do(req, &md)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("oidc %s: discovery: status %d", p.Name, status)
+	case md.Issuer != p.cfg.Issuer:
+		return nil, fmt.Errorf("oidc %s: discovery issuer %q does not match %q", p.Name, md.Issuer, p.cfg.Issuer)
+	case len(md.AuthorizationEndpoint) <= 0 || len(md.TokenEndpoint) <= 0 || len(md.JwksURI) <= 0:
+		return nil, fmt.Errorf("oidc %s: discovery document is missing endpoints", p.Name)
+	}
+
+	p.metadata = &md
+
+	return p.metadata, nil
+}
+
+// key returns the provider's signing key kid, fetching the key set again when
+// kid is unknown, which is how providers rotate keys. A token without a kid
+// is accepted when the set holds a single key.
+func (p *Provider) key(ctx context.Context, md *metadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	if p.now().Sub(p.keysFetched) < keysRefreshInterval {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	p.keysFetched = p.now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.JwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set helper.JWKS
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc %s: jwks: status %d", p.Name, status)
+	}
+
+	p.keys = make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if len(jwk.Use) > 0 && jwk.Use != "sig" {
+			continue
+		}
+		// keys of unsupported types are skipped, another one may be in use
+		if key, err := parseJWK(jwk); err == nil {
+			p.keys[jwk.Kid] = key
+		}
+	}
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown kid %q", kid)
+}
+
+func (p *Provider) lookupKey(kid string) crypto.PublicKey {
+	if len(kid) <= 0 && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+
+	return p.keys[kid]
+}
+
+// do sends req and decodes the JSON response body into v, whatever the status.
+func (p *Provider) do(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("oidc %s: %w", p.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v); err != nil {
+		return resp.StatusCode, fmt.Errorf("oidc %s: %s: %w", p.Name, req.URL.Path, err)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// parseJWK converts an RSA, EC or Ed25519 JSON Web Key to a public key.
+func parseJWK(jwk helper.JWK) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("ec point not on curve")
+		}
+		return key, nil
+
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
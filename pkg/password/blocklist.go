@@ -0,0 +1,79 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/binary"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// bundledBlocklist holds common and breached passwords, one per line, lower case.
+//
+//go:embed blocklist.txt.gz
+var bundledBlocklist []byte
+
+// Blocklist is a sorted list of truncated SHA-1 hashes of lower cased
+// passwords. 64 bits keep false positives negligible at a few bytes per entry.
+type Blocklist struct {
+	hashes []uint64
+}
+
+// LoadBlocklist reads a gzip compressed list from path, or the bundled
+// list when path is empty.
+func LoadBlocklist(path string) (*Blocklist, error) {
+	var r io.Reader = bytes.NewReader(bundledBlocklist)
+	if len(path) > 0 {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	list := &Blocklist{}
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) <= 0 {
+			continue
+		}
+		list.hashes = append(list.hashes, blocklistHash(line))
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list.hashes, func(i, j int) bool { return list.hashes[i] < list.hashes[j] })
+
+	return list, nil
+}
+
+// Contains reports whether password is on the list, ignoring case.
+func (b *Blocklist) Contains(password string) bool {
+	hash := blocklistHash(password)
+	i := sort.Search(len(b.hashes), func(i int) bool { return b.hashes[i] >= hash })
+	return i < len(b.hashes) && b.hashes[i] == hash
+}
+
+// Len returns the number of entries.
+func (b *Blocklist) Len() int {
+	return len(b.hashes)
+}
+
+func blocklistHash(password string) uint64 {
+	sum := sha1.Sum([]byte(strings.ToLower(password)))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,165 @@
+package password
+
+import (
+	"app/config"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+var (
+	ErrMismatch      = errors.New("password does not match")
+	ErrUnknownFormat = errors.New("unknown password hash format")
+)
+
+// Argon2Params ...
+type Argon2Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// Hasher hashes passwords with the configured algorithm and parameters and
+// verifies hashes made with either algorithm and any parameters.
+type Hasher struct {
+	alg        string
+	argon2     Argon2Params
+	bcryptCost int
+}
+
+func NewHasher(cfg *config.Config) *Hasher {
+	return &Hasher{
+		alg: cfg.PasswordHashAlg,
+		argon2: Argon2Params{
+			Memory:  cfg.PasswordArgon2Memory,
+			Time:    cfg.PasswordArgon2Time,
+			Threads: cfg.PasswordArgon2Threads,
+			KeyLen:  32,
+			SaltLen: 16,
+		},
+		bcryptCost: cfg.PasswordBcryptCost,
+	}
+}
+
+// Hash returns the encoded hash: PHC string format for argon2id
+// ($argon2id$v=19$m=65536,t=3,p=2$salt$hash) and modular crypt format for bcrypt.
+func (h *Hasher) Hash(password string) (string, error) {
+	switch h.alg {
+	case AlgBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		return string(hash), err
+	case AlgArgon2id:
+		salt := make([]byte, h.argon2.SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.argon2.Time, h.argon2.Memory, h.argon2.Threads, h.argon2.KeyLen)
+
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, h.argon2.Memory, h.argon2.Time, h.argon2.Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	default:
+		return "", fmt.Errorf("unsupported password hash algorithm %q", h.alg)
+	}
+}
+
+// Verify compares password with encoded. needsRehash is true when the hash
+// matches but was made with another algorithm or weaker parameters than the
+// configured ones, or encoded is a plaintext password, so the caller should
+// store a fresh Hash.
+func (h *Hasher) Verify(password, encoded string) (needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, ErrMismatch
+		}
+
+		return h.alg != AlgArgon2id ||
+			params.Memory < h.argon2.Memory ||
+			params.Time < h.argon2.Time ||
+			params.Threads < h.argon2.Threads ||
+			uint32(len(key)) < h.argon2.KeyLen, nil
+
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrMismatch
+		}
+		if err != nil {
+			return false, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, err
+		}
+
+		return h.alg != AlgBcrypt || cost < h.bcryptCost, nil
+
+	case strings.HasPrefix(encoded, "$argon2"):
+		return false, ErrUnknownFormat
+
+	case len(encoded) <= 0:
+		// accounts made through an identity provider have no password
+		return false, ErrMismatch
+
+	default:
+		// stored before passwords were hashed; compared as digests, so the
+		// time taken tells nothing of its length
+		want, got := sha256.Sum256([]byte(encoded)), sha256.Sum256([]byte(password))
+		if subtle.ConstantTimeCompare(want[:], got[:]) != 1 {
+			return false, ErrMismatch
+		}
+
+		return true, nil
+	}
+}
+
+func decodeArgon2id(encoded string) (params Argon2Params, salt, key []byte, err error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, ErrUnknownFormat
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, ErrUnknownFormat
+	}
+
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return params, nil, nil, ErrUnknownFormat
+	}
+
+	return params, salt, key, nil
+}
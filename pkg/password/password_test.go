@@ -0,0 +1,124 @@
+package password
+
+import (
+	"app/config"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testHasher returns a Hasher of alg with parameters cheap enough for tests.
+func testHasher(alg string) *Hasher {
+	return NewHasher(&config.Config{
+		PasswordHashAlg:       alg,
+		PasswordArgon2Memory:  64,
+		PasswordArgon2Time:    2,
+		PasswordArgon2Threads: 1,
+		PasswordBcryptCost:    bcrypt.MinCost + 1,
+	})
+}
+
+func TestHashVerify(t *testing.T) {
+	for _, alg := range []string{AlgArgon2id, AlgBcrypt} {
+		t.Run(alg, func(t *testing.T) {
+			h := testHasher(alg)
+
+			hash, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if hash == "correct horse" {
+				t.Fatal("Hash returned the password")
+			}
+
+			if needsRehash, err := h.Verify("correct horse", hash); err != nil || needsRehash {
+				t.Fatalf("Verify = %v, %v, want a match without rehash", needsRehash, err)
+			}
+			if _, err := h.Verify("battery staple", hash); !errors.Is(err, ErrMismatch) {
+				t.Fatalf("Verify of another password = %v, want ErrMismatch", err)
+			}
+
+			// a fresh salt every time
+			if again, _ := h.Hash("correct horse"); again == hash {
+				t.Fatal("two hashes of a password are equal")
+			}
+		})
+	}
+}
+
+func TestHashUnknownAlg(t *testing.T) {
+	if _, err := testHasher("md5").Hash("correct horse"); err == nil {
+		t.Fatal("Hash with md5 succeeded")
+	}
+}
+
+func TestVerifyNeedsRehash(t *testing.T) {
+	argon2Hasher, bcryptHasher := testHasher(AlgArgon2id), testHasher(AlgBcrypt)
+	argon2Hash, _ := argon2Hasher.Hash("correct horse")
+	bcryptHash, _ := bcryptHasher.Hash("correct horse")
+
+	stronger := testHasher(AlgArgon2id)
+	stronger.argon2.Time++
+	higherCost := testHasher(AlgBcrypt)
+	higherCost.bcryptCost++
+	weaker := testHasher(AlgArgon2id)
+	weaker.argon2.Memory /= 2
+
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		hash   string
+		want   bool
+	}{
+		{"current argon2id", argon2Hasher, argon2Hash, false},
+		{"current bcrypt", bcryptHasher, bcryptHash, false},
+		{"argon2id with weaker parameters", stronger, argon2Hash, true},
+		{"bcrypt with a lower cost", higherCost, bcryptHash, true},
+		{"argon2id with stronger parameters", weaker, argon2Hash, false},
+		{"argon2id with bcrypt configured", bcryptHasher, argon2Hash, true},
+		{"bcrypt with argon2id configured", argon2Hasher, bcryptHash, true},
+		{"plaintext", argon2Hasher, "correct horse", true},
+	}
+
+	for _, tt := range tests {
+		needsRehash, err := tt.hasher.Verify("correct horse", tt.hash)
+		if err != nil || needsRehash != tt.want {
+			t.Errorf("%s: Verify = %v, %v, want %v", tt.name, needsRehash, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyPlaintext(t *testing.T) {
+	h := testHasher(AlgArgon2id)
+
+	if _, err := h.Verify("correct horse", "correct horsE"); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("Verify of another password = %v, want ErrMismatch", err)
+	}
+
+	// an account without a password never matches
+	if _, err := h.Verify("", ""); !errors.Is(err, ErrMismatch) {
+		t.Fatalf("Verify of an empty hash = %v, want ErrMismatch", err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	hash, _ := testHasher(AlgArgon2id).Hash("correct horse")
+	parts := strings.Split(hash, "$")
+
+	for _, encoded := range []string{
+		"$argon2id$",
+		"$argon2id$v=19$m=64,t=2,p=1$" + parts[4],
+		strings.Join([]string{"", "argon2id", "v=16", parts[3], parts[4], parts[5]}, "$"),
+		strings.Join([]string{"", "argon2id", parts[2], "m=64", parts[4], parts[5]}, "$"),
+		strings.Join([]string{"", "argon2id", parts[2], parts[3], "!salt", parts[5]}, "$"),
+		strings.Join([]string{"", "argon2id", parts[2], parts[3], parts[4], "!key"}, "$"),
+		"$argon2i$v=19$m=64,t=2,p=1$" + parts[4] + "$" + parts[5],
+		"$2a$04$short",
+	} {
+		if _, err := testHasher(AlgArgon2id).Verify("correct horse", encoded); err == nil || errors.Is(err, ErrMismatch) {
+			t.Errorf("Verify(%q) = %v, want a format error", encoded, err)
+		}
+	}
+}
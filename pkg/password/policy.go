@@ -0,0 +1,143 @@
+package password
+
+import (
+	"app/config"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy rule names reported in Violation.Rule.
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleLower     = "lower"
+	RuleUpper     = "upper"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleUserInfo  = "user_info"
+	RuleBlocklist = "blocklist"
+)
+
+// minUserInfoLen ignores login and name parts too short to matter, like "Al".
+const minUserInfoLen = 3
+
+// Violation is one policy rule the password breaks.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Policy checks new passwords. Existing hashes are never re-checked,
+// so tightening the policy only affects the next password change.
+type Policy struct {
+	minLength     int
+	maxLength     int
+	requireLower  bool
+	requireUpper  bool
+	requireDigit  bool
+	requireSymbol bool
+	userInfo      bool
+	blocklist     *Blocklist
+}
+
+// NewPolicy loads the blocklist configured by PASSWORD_BLOCKLIST and
+// PASSWORD_BLOCKLIST_PATH, so it is meant to be called once at startup.
+func NewPolicy(cfg *config.Config) (*Policy, error) {
+	p := &Policy{
+		minLength:     cfg.PasswordMinLength,
+		maxLength:     cfg.PasswordMaxLength,
+		requireLower:  cfg.PasswordRequireLower,
+		requireUpper:  cfg.PasswordRequireUpper,
+		requireDigit:  cfg.PasswordRequireDigit,
+		requireSymbol: cfg.PasswordRequireSymbol,
+		userInfo:      cfg.PasswordRejectUserInfo,
+	}
+
+	if cfg.PasswordBlocklist {
+		blocklist, err := LoadBlocklist(cfg.PasswordBlocklistPath)
+		if err != nil {
+			return nil, fmt.Errorf("load password blocklist: %w", err)
+		}
+		p.blocklist = blocklist
+	}
+
+	return p, nil
+}
+
+// Check returns every rule password breaks, or nil. login and name are the
+// account's own values, which must not appear in the password.
+func (p *Policy) Check(password, login, name string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.minLength {
+		violations = append(violations, Violation{RuleMinLength, fmt.Sprintf("must be at least %d characters", p.minLength)})
+	}
+	if p.maxLength > 0 && length > p.maxLength {
+		violations = append(violations, Violation{RuleMaxLength, fmt.Sprintf("must be at most %d characters", p.maxLength)})
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.requireLower && !lower {
+		violations = append(violations, Violation{RuleLower, "must contain a lower case letter"})
+	}
+	if p.requireUpper && !upper {
+		violations = append(violations, Violation{RuleUpper, "must contain an upper case letter"})
+	}
+	if p.requireDigit && !digit {
+		violations = append(violations, Violation{RuleDigit, "must contain a digit"})
+	}
+	if p.requireSymbol && !symbol {
+		violations = append(violations, Violation{RuleSymbol, "must contain a symbol"})
+	}
+
+	if p.userInfo && containsUserInfo(password, login, name) {
+		violations = append(violations, Violation{RuleUserInfo, "must not contain the login or name"})
+	}
+
+	if p.blocklist != nil && p.blocklist.Contains(password) {
+		violations = append(violations, Violation{RuleBlocklist, "is too common, it appears in lists of breached passwords"})
+	}
+
+	return violations
+}
+
+func containsUserInfo(password, login, name string) bool {
+	password = strings.ToLower(password)
+
+	for _, part := range append([]string{login}, strings.Fields(name)...) {
+		if len(part) >= minUserInfoLen && strings.Contains(password, strings.ToLower(part)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Error joins violations into one message for callers without structured output.
+func Error(violations []Violation) error {
+	if len(violations) <= 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(violations))
+	for _, v := range violations {
+		messages = append(messages, v.Rule+": "+v.Message)
+	}
+
+	return fmt.Errorf("password %s", strings.Join(messages, "; "))
+}
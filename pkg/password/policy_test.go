@@ -0,0 +1,79 @@
+package password
+
+import (
+	"app/config"
+	"reflect"
+	"testing"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := NewPolicy(&config.Config{
+		PasswordMinLength:      8,
+		PasswordMaxLength:      12,
+		PasswordRequireLower:   true,
+		PasswordRequireUpper:   true,
+		PasswordRequireDigit:   true,
+		PasswordRequireSymbol:  true,
+		PasswordRejectUserInfo: true,
+		PasswordBlocklist:      true,
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		login    string
+		userName string
+		want     []string
+	}{
+		{"valid", "Tr0ub4dor&3", "alice1", "Alice Smith", nil},
+
+		// lengths count runes, not bytes
+		{"too short", "Tr0ub&3", "alice1", "", []string{RuleMinLength}},
+		{"min length", "Tr0ub&3x", "alice1", "", nil},
+		{"max length", "Tr0ub4dor&3x", "alice1", "", nil},
+		{"too long", "Tr0ub4dor&3xy", "alice1", "", []string{RuleMaxLength}},
+		{"multibyte at max length", "Tr0ub4dor&3ё", "alice1", "", nil},
+		{"multibyte under min length", "Парол1!", "alice1", "", []string{RuleMinLength}},
+
+		{"no lower case", "TR0UB4DOR&3", "alice1", "", []string{RuleLower}},
+		{"no upper case", "tr0ub4dor&3", "alice1", "", []string{RuleUpper}},
+		{"no digit", "Troubador&x", "alice1", "", []string{RuleDigit}},
+		{"no symbol", "Tr0ub4dor33", "alice1", "", []string{RuleSymbol}},
+		{"letters only", "troubadorxx", "alice1", "", []string{RuleUpper, RuleDigit, RuleSymbol}},
+
+		{"contains the login", "xAlice1&Tr", "alice1", "", []string{RuleUserInfo}},
+		{"contains part of the name", "Tr0&SMITHx", "alice1", "Alice Smith", []string{RuleUserInfo}},
+		{"name part of 3 characters", "Tr0&bobX99", "alice1", "Bob Li", []string{RuleUserInfo}},
+		{"name part under 3 characters", "Tr0&liX99z", "alice1", "Bob Li", nil},
+
+		{"blocklisted", "Password1", "alice1", "", []string{RuleSymbol, RuleBlocklist}},
+		{"blocklisted in another case", "TRUSTNO1", "alice1", "", []string{RuleLower, RuleSymbol, RuleBlocklist}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []string
+			for _, v := range policy.Check(tt.password, tt.login, tt.userName) {
+				rules = append(rules, v.Rule)
+			}
+
+			if !reflect.DeepEqual(rules, tt.want) {
+				t.Fatalf("Check(%q) = %v, want %v", tt.password, rules, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyOff(t *testing.T) {
+	policy, err := NewPolicy(&config.Config{})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	if violations := policy.Check("password1", "password1", "password1"); violations != nil {
+		t.Fatalf("Check = %v, want no rules configured", violations)
+	}
+}
@@ -0,0 +1,126 @@
+package tokens
+
+import (
+	"app/pkg/helper"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// allowedAlgs is the whitelist handed to the parser, on top of the per key check.
+var allowedAlgs = []string{AlgHS256, AlgRS256, AlgEdDSA}
+
+// key is one verification key, bound to the single algorithm it may be used with.
+type key struct {
+	kid    string
+	method jwt.SigningMethod
+	verify interface{} // []byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// jwk returns the public JWK of k. HMAC keys are secret and never published.
+func (k key) jwk() (helper.JWK, bool) {
+	switch pub := k.verify.(type) {
+	case *rsa.PublicKey:
+		return helper.JWK{
+			Kty: "RSA",
+			Kid: k.kid,
+			Alg: AlgRS256,
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return helper.JWK{
+			Kty: "OKP",
+			Kid: k.kid,
+			Alg: AlgEdDSA,
+			Use: "sig",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	default:
+		return helper.JWK{}, false
+	}
+}
+
+// loadPrivateKey reads a PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) PEM file and
+// checks it matches alg.
+func loadPrivateKey(path, alg string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed interface{}
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch priv := parsed.(type) {
+	case *rsa.PrivateKey:
+		if alg == AlgRS256 {
+			return priv, nil
+		}
+	case ed25519.PrivateKey:
+		if alg == AlgEdDSA {
+			return priv, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s: %T cannot sign %s", path, parsed, alg)
+}
+
+// loadPublicKey reads a PKIX PEM public key and returns it with the algorithm it verifies.
+func loadPublicKey(path string) (jwt.SigningMethod, interface{}, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch pub := parsed.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, pub, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, pub, nil
+	default:
+		return nil, nil, fmt.Errorf("%s: unsupported public key %T", path, parsed)
+	}
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,228 @@
+package tokens
+
+import (
+	"app/config"
+	"app/pkg/helper"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var _ helper.TokenIssuer = (*Issuer)(nil)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// Issuer signs access tokens with the current key and verifies them with the
+// current or any previous key, so keys can be rotated without logging
+// everyone out: move the old key to AUTH_PREVIOUS_SECRET_KEYS (HS256) or
+// AUTH_PREVIOUS_PUBLIC_KEYS (RS256, EdDSA), configure the new key and
+// AUTH_SECRET_KEY_ID, and drop the old key after one TTL.
+type Issuer struct {
+	kid      string
+	method   jwt.SigningMethod
+	signKey  interface{}
+	keys     map[string]key
+	issuer   string
+	audience string
+	ttl      time.Duration
+	// oidcIssuer is the iss of ID tokens, which OpenID Connect requires to be
+	// the URL the discovery document is served under.
+	oidcIssuer string
+	now        func() time.Time
+}
+
+func NewIssuer(cfg *config.Config) (*Issuer, error) {
+	i := &Issuer{
+		kid:      cfg.AuthSecretKeyID,
+		keys:     make(map[string]key),
+		issuer:   cfg.AuthIssuer,
+		audience: cfg.AuthAudience,
+		ttl:      cfg.AuthTokenTTL,
+		now:      time.Now,
+	}
+	i.oidcIssuer = cfg.PublicURL
+
+	for kid, secret := range cfg.AuthPreviousKeys {
+		i.keys[kid] = key{kid: kid, method: jwt.SigningMethodHS256, verify: []byte(secret)}
+	}
+
+	for kid, path := range cfg.AuthPreviousPublicKeys {
+		method, pub, err := loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		i.keys[kid] = key{kid: kid, method: method, verify: pub}
+	}
+
+	switch cfg.AuthSigningAlg {
+	case AlgHS256:
+		i.method = jwt.SigningMethodHS256
+		i.signKey = []byte(cfg.AuthSecretKey)
+		i.keys[i.kid] = key{kid: i.kid, method: i.method, verify: i.signKey}
+	case AlgRS256, AlgEdDSA:
+		priv, err := loadPrivateKey(cfg.AuthPrivateKeyPath, cfg.AuthSigningAlg)
+		if err != nil {
+			return nil, err
+		}
+		i.method = jwt.GetSigningMethod(cfg.AuthSigningAlg)
+		i.signKey = priv
+		i.keys[i.kid] = key{kid: i.kid, method: i.method, verify: priv.Public()}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.AuthSigningAlg)
+	}
+
+	return i, nil
+}
+
+// claims is the payload of an access token.
+type claims struct {
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// idClaims is the payload of an ID token.
+type idClaims struct {
+	Nonce               string `json:"nonce,omitempty"`
+	Name                string `json:"name,omitempty"`
+	PhoneNumber         string `json:"phone_number,omitempty"`
+	PhoneNumberVerified *bool  `json:"phone_number_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// JWKS returns the public keys tokens may be verified with, current and previous.
+func (i *Issuer) JWKS() helper.JWKS {
+	set := helper.JWKS{Keys: []helper.JWK{}}
+	for _, k := range i.keys {
+		if jwk, ok := k.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	sort.Slice(set.Keys, func(a, b int) bool { return set.Keys[a].Kid < set.Keys[b].Kid })
+
+	return set
+}
+
+// TTL is the lifetime of issued tokens.
+func (i *Issuer) TTL() time.Duration {
+	return i.ttl
+}
+
+// Issue returns a signed token for info. It expires after TTL unless
+// info.ExpiresAt is set.
+func (i *Issuer) Issue(info helper.TokenInfo) (string, error) {
+	now := i.now()
+
+	expiresAt := info.ExpiresAt
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(i.ttl)
+	}
+
+	subject := info.UserID
+	if len(subject) <= 0 {
+		subject = info.ClientID
+	}
+
+	token := jwt.NewWithClaims(i.method, claims{
+		UserID:    info.UserID,
+		SessionID: info.SessionID,
+		ClientID:  info.ClientID,
+		Scope:     info.Scope,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    i.issuer,
+			Audience:  jwt.ClaimStrings{i.audience},
+			ID:        uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	token.Header["kid"] = i.kid
+
+	return token.SignedString(i.signKey)
+}
+
+// IssueIDToken returns a signed ID token. It is signed with the current key
+// like access tokens, but its issuer is the public URL and its audience the
+// client it was issued to.
+func (i *Issuer) IssueIDToken(t helper.IDToken) (string, error) {
+	now := i.now()
+
+	token := jwt.NewWithClaims(i.method, idClaims{
+		Nonce:               t.Nonce,
+		Name:                t.Name,
+		PhoneNumber:         t.PhoneNumber,
+		PhoneNumberVerified: t.PhoneNumberVerified,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   t.Subject,
+			Issuer:    i.oidcIssuer,
+			Audience:  jwt.ClaimStrings{t.Audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(t.ExpiresAt),
+		},
+	})
+	token.Header["kid"] = i.kid
+
+	return token.SignedString(i.signKey)
+}
+
+// Verify checks the signature, algorithm, issuer, audience and validity window of
+// tokenString and returns its claims.
+func (i *Issuer) Verify(tokenString string) (result helper.TokenInfo, err error) {
+	var c claims
+
+	token, err := jwt.ParseWithClaims(tokenString, &c, i.keyFunc,
+		jwt.WithValidMethods(allowedAlgs),
+		jwt.WithIssuer(i.issuer),
+		jwt.WithAudience(i.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(i.now),
+	)
+	if err != nil {
+		return result, err
+	}
+	if !token.Valid {
+		return result, ErrInvalidToken
+	}
+
+	if len(c.UserID) <= 0 && len(c.ClientID) <= 0 {
+		return result, errors.New("cannot parse 'user_id' field")
+	}
+
+	result.UserID = c.UserID
+	result.ID = c.ID
+	result.SessionID = c.SessionID
+	result.ClientID = c.ClientID
+	result.Scope = c.Scope
+	result.ExpiresAt = c.ExpiresAt.Time
+
+	return result, nil
+}
+
+func (i *Issuer) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k, ok := i.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	// each key verifies only its own algorithm, whatever alg the token declares
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+
+	return k.verify, nil
+}
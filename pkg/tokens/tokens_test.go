@@ -0,0 +1,418 @@
+package tokens
+
+import (
+	"app/config"
+	"app/pkg/helper"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		AuthSigningAlg:  AlgHS256,
+		AuthSecretKey:   "current-secret",
+		AuthSecretKeyID: "k2",
+		AuthIssuer:      "app",
+		AuthAudience:    "app-api",
+		AuthTokenTTL:    time.Hour,
+	}
+}
+
+func newTestIssuer(t *testing.T, cfg *config.Config) *Issuer {
+	t.Helper()
+
+	i, err := NewIssuer(cfg)
+	if err != nil {
+		t.Fatalf("NewIssuer: %v", err)
+	}
+	i.now = func() time.Time { return testNow }
+
+	return i
+}
+
+// signRaw signs claims as an Issuer would, but with any method, key and kid.
+func signRaw(t *testing.T, method jwt.SigningMethod, signKey interface{}, kid string, c jwt.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, c)
+	token.Header["kid"] = kid
+
+	s, err := token.SignedString(signKey)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	return s
+}
+
+func validClaims(now time.Time) claims {
+	return claims{
+		UserID: "user-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			Issuer:    "app",
+			Audience:  jwt.ClaimStrings{"app-api"},
+			ID:        "jti-1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+func TestIssuerVerify(t *testing.T) {
+	i := newTestIssuer(t, testConfig())
+
+	issued, err := i.Issue(helper.TokenInfo{UserID: "user-1"})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		now     time.Time
+		wantErr error // nil for any error when fail is set
+		fail    bool
+	}{
+		{
+			name:  "valid",
+			token: func() string { return issued },
+			now:   testNow.Add(time.Minute),
+		},
+		{
+			name:    "expired",
+			token:   func() string { return issued },
+			now:     testNow.Add(time.Hour + time.Second),
+			wantErr: jwt.ErrTokenExpired,
+			fail:    true,
+		},
+		{
+			name:    "not yet valid",
+			token:   func() string { return issued },
+			now:     testNow.Add(-time.Minute),
+			wantErr: jwt.ErrTokenNotValidYet,
+			fail:    true,
+		},
+		{
+			name: "issued in the future",
+			token: func() string {
+				c := validClaims(testNow.Add(time.Hour))
+				c.NotBefore = nil
+				return signRaw(t, jwt.SigningMethodHS256, []byte("current-secret"), "k2", c)
+			},
+			now:     testNow,
+			wantErr: jwt.ErrTokenUsedBeforeIssued,
+			fail:    true,
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				c := validClaims(testNow)
+				c.ExpiresAt = nil
+				return signRaw(t, jwt.SigningMethodHS256, []byte("current-secret"), "k2", c)
+			},
+			now:     testNow,
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+			fail:    true,
+		},
+		{
+			name: "wrong algorithm for the key",
+			token: func() string {
+				return signRaw(t, jwt.SigningMethodHS512, []byte("current-secret"), "k2", validClaims(testNow))
+			},
+			now:  testNow,
+			fail: true,
+		},
+		{
+			name: "RS256 under an HS256 kid",
+			token: func() string {
+				return signRaw(t, jwt.SigningMethodRS256, rsaKey, "k2", validClaims(testNow))
+			},
+			now:  testNow,
+			fail: true,
+		},
+		{
+			name: "alg none",
+			token: func() string {
+				return signRaw(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "k2", validClaims(testNow))
+			},
+			now:  testNow,
+			fail: true,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				c := validClaims(testNow)
+				c.Audience = jwt.ClaimStrings{"other-api"}
+				return signRaw(t, jwt.SigningMethodHS256, []byte("current-secret"), "k2", c)
+			},
+			now:     testNow,
+			wantErr: jwt.ErrTokenInvalidAudience,
+			fail:    true,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				c := validClaims(testNow)
+				c.Issuer = "someone-else"
+				return signRaw(t, jwt.SigningMethodHS256, []byte("current-secret"), "k2", c)
+			},
+			now:     testNow,
+			wantErr: jwt.ErrTokenInvalidIssuer,
+			fail:    true,
+		},
+		{
+			name: "tampered payload",
+			token: func() string {
+				c := validClaims(testNow)
+				c.UserID = "admin"
+				forged := signRaw(t, jwt.SigningMethodHS256, []byte("current-secret"), "k2", c)
+				parts := strings.Split(issued, ".")
+				// the claims of one token with the signature of another
+				return parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2]
+			},
+			now:     testNow,
+			wantErr: jwt.ErrTokenSignatureInvalid,
+			fail:    true,
+		},
+		{
+			name: "tampered signature",
+			token: func() string {
+				sig := []byte(issued[strings.LastIndex(issued, ".")+1:])
+				sig[0] ^= 'A' ^ 'B'
+				return issued[:strings.LastIndex(issued, ".")+1] + string(sig)
+			},
+			now:  testNow,
+			fail: true,
+		},
+		{
+			name: "wrong secret",
+			token: func() string {
+				return signRaw(t, jwt.SigningMethodHS256, []byte("guessed-secret"), "k2", validClaims(testNow))
+			},
+			now:     testNow,
+			wantErr: jwt.ErrTokenSignatureInvalid,
+			fail:    true,
+		},
+		{
+			name: "unknown kid",
+			token: func() string {
+				return signRaw(t, jwt.SigningMethodHS256, []byte("current-secret"), "k9", validClaims(testNow))
+			},
+			now:     testNow,
+			wantErr: ErrUnknownKey,
+			fail:    true,
+		},
+		{
+			name: "no user nor client",
+			token: func() string {
+				c := validClaims(testNow)
+				c.UserID = ""
+				return signRaw(t, jwt.SigningMethodHS256, []byte("current-secret"), "k2", c)
+			},
+			now:  testNow,
+			fail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i.now = func() time.Time { return tt.now }
+			defer func() { i.now = func() time.Time { return testNow } }()
+
+			info, err := i.Verify(tt.token())
+			if !tt.fail {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if info.UserID != "user-1" || len(info.ID) <= 0 {
+					t.Fatalf("Verify returned %+v", info)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("Verify accepted the token: %+v", info)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIssuerClaims(t *testing.T) {
+	i := newTestIssuer(t, testConfig())
+
+	// the grant of an OAuth client, as /userinfo and the session checks read it
+	want := helper.TokenInfo{UserID: "user-1", SessionID: "session-1", ClientID: "client-1", Scope: "openid profile"}
+	token, err := i.Issue(want)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	got, err := i.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got.UserID != want.UserID || got.SessionID != want.SessionID || got.ClientID != want.ClientID || got.Scope != want.Scope {
+		t.Fatalf("Verify = %+v, want %+v", got, want)
+	}
+	if !got.ExpiresAt.Equal(testNow.Add(time.Hour)) {
+		t.Fatalf("ExpiresAt = %v, want AUTH_TOKEN_TTL from now", got.ExpiresAt)
+	}
+}
+
+func TestIssuerKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPath, edPubPath := writeKeyPair(t, dir, "ed", edPriv, edPriv.Public())
+	rsaPath, _ := writeKeyPair(t, dir, "rsa", rsaPriv, rsaPriv.Public())
+
+	// k1: HS256, k2: EdDSA with k1 previous, k3: RS256 with k2 previous
+	cfg1 := testConfig()
+	cfg1.AuthSecretKeyID = "k1"
+	cfg1.AuthSecretKey = "old-secret"
+
+	cfg2 := testConfig()
+	cfg2.AuthSigningAlg = AlgEdDSA
+	cfg2.AuthPrivateKeyPath = edPath
+	cfg2.AuthSecretKeyID = "k2"
+	cfg2.AuthPreviousKeys = map[string]string{"k1": "old-secret"}
+
+	cfg3 := testConfig()
+	cfg3.AuthSigningAlg = AlgRS256
+	cfg3.AuthPrivateKeyPath = rsaPath
+	cfg3.AuthSecretKeyID = "k3"
+	cfg3.AuthPreviousPublicKeys = map[string]string{"k2": edPubPath}
+
+	i1, i2, i3 := newTestIssuer(t, cfg1), newTestIssuer(t, cfg2), newTestIssuer(t, cfg3)
+
+	issue := func(i *Issuer) string {
+		token, err := i.Issue(helper.TokenInfo{UserID: "user-1"})
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		return token
+	}
+	t1, t2, t3 := issue(i1), issue(i2), issue(i3)
+
+	tests := []struct {
+		name   string
+		issuer *Issuer
+		token  string
+		ok     bool
+	}{
+		{"own token", i2, t2, true},
+		{"previous HS256 key", i2, t1, true},
+		{"previous public key", i3, t2, true},
+		{"key dropped after one rotation", i3, t1, false},
+		{"newer key unknown to the old issuer", i1, t2, false},
+		{"newer RS256 key unknown to the EdDSA issuer", i2, t3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.issuer.Verify(tt.token)
+			if tt.ok && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrUnknownKey) {
+				t.Fatalf("Verify error = %v, want %v", err, ErrUnknownKey)
+			}
+		})
+	}
+
+	// previous keys are published for verification, secrets never are
+	jwks := i3.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != "k2" || jwks.Keys[1].Kid != "k3" {
+		t.Fatalf("JWKS = %+v, want the k2 and k3 public keys", jwks.Keys)
+	}
+	if keys := i2.JWKS().Keys; len(keys) != 1 || keys[0].Kid != "k2" {
+		t.Fatalf("JWKS = %+v, want only the k2 public key", keys)
+	}
+}
+
+func TestLinkSigner(t *testing.T) {
+	cfg := testConfig()
+	cfg.LinkSecretKey = "link-secret"
+
+	s := NewLinkSigner(cfg)
+	s.now = func() time.Time { return testNow }
+
+	token, err := s.Sign(PurposeVerifyEmail, "user-1", "alice@example.com", time.Minute)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	userID, email, err := s.Verify(PurposeVerifyEmail, token)
+	if err != nil || userID != "user-1" || email != "alice@example.com" {
+		t.Fatalf("Verify = %q, %q, %v", userID, email, err)
+	}
+	if _, _, err = s.Verify("reset-password", token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify for another purpose error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	s.now = func() time.Time { return testNow.Add(2 * time.Minute) }
+	if _, _, err = s.Verify(PurposeVerifyEmail, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify after expiry error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	// a link token is no access token
+	if _, err = newTestIssuer(t, cfg).Verify(token); err == nil {
+		t.Fatal("Issuer accepted a link token")
+	}
+}
+
+// writeKeyPair writes a PKCS#8 private key and its PKIX public key as PEM
+// files and returns their paths.
+func writeKeyPair(t *testing.T, dir, name string, priv, pub interface{}) (string, string) {
+	t.Helper()
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privPath := filepath.Join(dir, name+".key")
+	pubPath := filepath.Join(dir, name+".pub")
+	if err = os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return privPath, pubPath
+}
@@ -0,0 +1,107 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"math/big"
+	"testing"
+)
+
+// coseKey encodes alternating int64 keys and int64 or []byte values as a
+// CBOR map.
+func coseKey(pairs ...interface{}) []byte {
+	out := cborHead(5, uint64(len(pairs)/2))
+	for _, item := range pairs {
+		switch v := item.(type) {
+		case int64:
+			if v < 0 {
+				out = append(out, cborHead(1, uint64(-1-v))...)
+			} else {
+				out = append(out, cborHead(0, uint64(v))...)
+			}
+		case []byte:
+			out = append(append(out, cborHead(2, uint64(len(v)))...), v...)
+		}
+	}
+
+	return out
+}
+
+func cborHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	default:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	}
+}
+
+func rsaKey(n *big.Int, e int64) []byte {
+	return coseKey(
+		int64(coseKty), int64(ktyRSA),
+		int64(coseAlg), int64(AlgRS256),
+		int64(coseCrv), n.Bytes(),
+		int64(coseX), big.NewInt(e).Bytes(),
+	)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	rsa2048, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsa1024, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey := func(x, y []byte) []byte {
+		return coseKey(
+			int64(coseKty), int64(ktyEC2),
+			int64(coseAlg), int64(AlgES256),
+			int64(coseCrv), int64(crvP256),
+			int64(coseX), x,
+			int64(coseY), y,
+		)
+	}
+	pad := func(b []byte) []byte { return append(make([]byte, 32-len(b)), b...) }
+
+	tests := []struct {
+		name string
+		key  []byte
+		ok   bool
+	}{
+		{"RSA exponent 65537", rsaKey(rsa2048.N, 65537), true},
+		{"RSA exponent 3", rsaKey(rsa2048.N, 3), true},
+		{"RSA exponent 1", rsaKey(rsa2048.N, 1), false},
+		{"RSA exponent 0", rsaKey(rsa2048.N, 0), false},
+		{"RSA even exponent", rsaKey(rsa2048.N, 65536), false},
+		{"RSA exponent over 32 bits", rsaKey(rsa2048.N, 1<<33+1), false},
+		{"RSA 1024 bits", rsaKey(rsa1024.N, 65537), false},
+		{"P-256", ecKey(pad(ec.X.Bytes()), pad(ec.Y.Bytes())), true},
+		{"P-256 point off the curve", ecKey(pad(ec.X.Bytes()), pad(new(big.Int).Add(ec.Y, big.NewInt(1)).Bytes())), false},
+		{"trailing data", append(rsaKey(rsa2048.N, 65537), 0), false},
+		{"unsupported algorithm", coseKey(int64(coseKty), int64(ktyEC2), int64(coseAlg), int64(-35)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePublicKey(tt.key)
+			if tt.ok && err != nil {
+				t.Fatalf("parsePublicKey: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("parsePublicKey accepted the key")
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+// Package webauthn implements the relying party side of Web Authentication
+// (https://www.w3.org/TR/webauthn-2/) for passkeys: the options passed to
+// navigator.credentials.create and get, and the verification of what they
+// return. Attestation is not requested, so credentials are trusted on the
+// strength of the signed-in user registering them, not of their maker.
+package webauthn
+
+import (
+	"app/config"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+
+	typePublicKey = "public-key"
+	typeCreate    = "webauthn.create"
+	typeGet       = "webauthn.get"
+
+	// maxCredentialIDLength is the longest credential id the spec allows.
+	maxCredentialIDLength = 1023
+)
+
+// authenticator data flags
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+	flagExtensionData  = 0x80
+)
+
+// ErrVerification is wrapped by every error about a response which does not
+// verify. Its text is safe to show to the caller.
+var ErrVerification = errors.New("webauthn verification failed")
+
+// Bytes is binary data carried as unpadded base64url in JSON, as by the
+// toJSON methods of PublicKeyCredential.
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url: %w", err)
+	}
+
+	*b = decoded
+	return nil
+}
+
+// RelyingParty verifies credentials for one RP ID and the origins on it.
+type RelyingParty struct {
+	id               string
+	name             string
+	origins          []string
+	timeout          time.Duration
+	userVerification string
+}
+
+func New(cfg *config.Config) *RelyingParty {
+	return &RelyingParty{
+		id:               cfg.WebAuthnRPID,
+		name:             cfg.WebAuthnRPName,
+		origins:          cfg.WebAuthnOrigins,
+		timeout:          cfg.WebAuthnTimeout,
+		userVerification: cfg.WebAuthnUserVerification,
+	}
+}
+
+// User is the account a credential is created for.
+type User struct {
+	ID          []byte // user handle, returned by the authenticator on login
+	Name        string
+	DisplayName string
+}
+
+// CredentialDescriptor names an existing credential.
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         Bytes    `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// CredentialParameters offers a key algorithm to the authenticator.
+type CredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions are the publicKey options of navigator.credentials.create.
+type CreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Bytes                  `json:"challenge"`
+	PubKeyCredParams       []CredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the publicKey options of navigator.credentials.get.
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the JSON form of the credential returned by
+// navigator.credentials.create.
+type RegistrationResponse struct {
+	ID       string                   `json:"id"`
+	RawID    Bytes                    `json:"rawId"`
+	Type     string                   `json:"type"`
+	Response AuthenticatorAttestation `json:"response"`
+}
+
+type AuthenticatorAttestation struct {
+	ClientDataJSON    Bytes    `json:"clientDataJSON"`
+	AttestationObject Bytes    `json:"attestationObject"`
+	Transports        []string `json:"transports"`
+}
+
+// AssertionResponse is the JSON form of the credential returned by
+// navigator.credentials.get.
+type AssertionResponse struct {
+	ID       string                 `json:"id"`
+	RawID    Bytes                  `json:"rawId"`
+	Type     string                 `json:"type"`
+	Response AuthenticatorAssertion `json:"response"`
+}
+
+type AuthenticatorAssertion struct {
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AuthenticatorData Bytes `json:"authenticatorData"`
+	Signature         Bytes `json:"signature"`
+	UserHandle        Bytes `json:"userHandle"`
+}
+
+// Credential is a verified new credential.
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// Assertion is the state of a credential after a verified login.
+type Assertion struct {
+	SignCount    uint32
+	BackedUp     bool
+	UserVerified bool
+}
+
+// NewChallenge returns a random challenge for one ceremony.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// CreationOptions asks for a discoverable credential for user which is none
+// of exclude, the user's existing credentials.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user User, exclude []CredentialDescriptor) *CreationOptions {
+	opts := &CreationOptions{
+		RP:                 RPEntity{ID: rp.id, Name: rp.name},
+		User:               UserEntity{ID: user.ID, Name: user.Name, DisplayName: user.DisplayName},
+		Challenge:          challenge,
+		Timeout:            rp.timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:        "required",
+			RequireResidentKey: true,
+			UserVerification:   rp.userVerification,
+		},
+		Attestation: "none",
+	}
+	for _, alg := range Algorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, CredentialParameters{Type: typePublicKey, Alg: alg})
+	}
+
+	if opts.ExcludeCredentials == nil {
+		opts.ExcludeCredentials = []CredentialDescriptor{}
+	}
+
+	return opts
+}
+
+// RequestOptions asks for an assertion by any discoverable credential of
+// this relying party, so the user does not have to type a login first.
+func (rp *RelyingParty) RequestOptions(challenge []byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.timeout.Milliseconds(),
+		RPID:             rp.id,
+		AllowCredentials: []CredentialDescriptor{},
+		UserVerification: rp.userVerification,
+	}
+}
+
+// VerifyRegistration checks a response to CreationOptions with challenge
+// and returns the new credential.
+func (rp *RelyingParty) VerifyRegistration(resp *RegistrationResponse, challenge []byte) (*Credential, error) {
+	if resp.Type != typePublicKey {
+		return nil, verificationError("credential type must be %q", typePublicKey)
+	}
+
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, typeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) > 0 {
+		return nil, verificationError("malformed attestation object")
+	}
+	attestation, _ := item.(map[interface{}]interface{})
+	format, _ := attestation["fmt"].(string)
+	statement, _ := attestation["attStmt"].(map[interface{}]interface{})
+	authData, _ := attestation["authData"].([]byte)
+	// other formats carry a statement about the authenticator, which is not
+	// used as no attestation was asked for
+	if len(format) <= 0 || statement == nil || (format == "none" && len(statement) > 0) {
+		return nil, verificationError("malformed attestation statement")
+	}
+
+	data, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if data.flags&flagAttestedData == 0 {
+		return nil, verificationError("no credential in the authenticator data")
+	}
+	if !bytes.Equal(resp.RawID, data.credentialID) {
+		return nil, verificationError("rawId does not match the credential")
+	}
+
+	return &Credential{
+		ID:             data.credentialID,
+		PublicKey:      data.publicKey,
+		SignCount:      data.signCount,
+		AAGUID:         data.aaguid,
+		Transports:     resp.Response.Transports,
+		BackupEligible: data.flags&flagBackupEligible != 0,
+		BackedUp:       data.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// VerifyAssertion checks a response to RequestOptions with challenge, made
+// by the credential with the COSE publicKey.
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge, publicKey []byte) (*Assertion, error) {
+	if resp.Type != typePublicKey {
+		return nil, verificationError("credential type must be %q", typePublicKey)
+	}
+
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, typeGet, challenge); err != nil {
+		return nil, err
+	}
+
+	data, err := rp.parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if data.flags&flagAttestedData != 0 {
+		return nil, verificationError("unexpected credential in the authenticator data")
+	}
+
+	key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, resp.Response.Signature) {
+		return nil, verificationError("invalid signature")
+	}
+
+	return &Assertion{
+		SignCount:    data.signCount,
+		BackedUp:     data.flags&flagBackedUp != 0,
+		UserVerified: data.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// SignCountValid reports whether an authenticator which had signed stored
+// times reporting received is plausible. A counter which did not grow means
+// the credential may have been cloned. Authenticators without a counter,
+// such as synced passkeys, always report 0.
+func SignCountValid(stored, received uint32) bool {
+	return (stored == 0 && received == 0) || received > stored
+}
+
+// clientData is the part of the collected client data which is checked.
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return verificationError("malformed client data")
+	}
+
+	received, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	switch {
+	case data.Type != ceremony:
+		return verificationError("client data type must be %q", ceremony)
+	case err != nil || subtle.ConstantTimeCompare(received, challenge) != 1:
+		return verificationError("challenge mismatch")
+	case !rp.allowedOrigin(data.Origin):
+		return verificationError("origin %q is not allowed", data.Origin)
+	case data.CrossOrigin:
+		return verificationError("cross-origin ceremonies are not allowed")
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) allowedOrigin(origin string) bool {
+	for _, allowed := range rp.origins {
+		if origin == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authenticatorData is the parsed authenticator data of a response.
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData parses raw and checks that it was made for this
+// relying party with the user present, and verified if that is required.
+func (rp *RelyingParty) parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, verificationError("authenticator data is too short")
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.id))
+	data := &authenticatorData{
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+
+	switch {
+	case subtle.ConstantTimeCompare(raw[:32], rpIDHash[:]) != 1:
+		return nil, verificationError("credential belongs to another relying party")
+	case data.flags&flagUserPresent == 0:
+		return nil, verificationError("user was not present")
+	case rp.userVerification == UserVerificationRequired && data.flags&flagUserVerified == 0:
+		return nil, verificationError("user was not verified")
+	}
+
+	rest := raw[37:]
+	if data.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, verificationError("attested credential data is too short")
+		}
+		data.aaguid = append([]byte(nil), rest[:16]...)
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n <= 0 || n > maxCredentialIDLength || len(rest) < n {
+			return nil, verificationError("invalid credential id")
+		}
+		data.credentialID = append([]byte(nil), rest[:n]...)
+		rest = rest[n:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, verificationError("malformed credential public key")
+		}
+		data.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+		rest = after
+
+		if _, err = parsePublicKey(data.publicKey); err != nil {
+			return nil, verificationError("%s", err)
+		}
+	}
+
+	if data.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, verificationError("malformed extension data")
+		}
+		rest = after
+	}
+
+	if len(rest) > 0 {
+		return nil, verificationError("trailing authenticator data")
+	}
+
+	return data, nil
+}
+
+func verificationError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrVerification}, args...)...)
+}
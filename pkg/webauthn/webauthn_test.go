@@ -0,0 +1,299 @@
+package webauthn_test
+
+import (
+	"app/config"
+	"app/pkg/webauthn"
+	"app/pkg/webauthn/webauthntest"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+const testOrigin = "https://app.example.com"
+
+func newRelyingParty() *webauthn.RelyingParty {
+	return webauthn.New(&config.Config{
+		WebAuthnRPID:             "example.com",
+		WebAuthnRPName:           "App",
+		WebAuthnOrigins:          []string{testOrigin},
+		WebAuthnTimeout:          5 * time.Minute,
+		WebAuthnUserVerification: webauthn.UserVerificationPreferred,
+	})
+}
+
+func newChallenge(t *testing.T) []byte {
+	t.Helper()
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatalf("NewChallenge: %v", err)
+	}
+
+	return challenge
+}
+
+var testUser = webauthn.User{ID: []byte("user-1"), Name: "alice", DisplayName: "Alice"}
+
+// register creates a credential on a and verifies it as the server would.
+func register(t *testing.T, rp *webauthn.RelyingParty, a *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+
+	challenge := newChallenge(t)
+	resp, err := a.Register(rp.CreationOptions(challenge, testUser, nil))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	credential, err := rp.VerifyRegistration(resp, challenge)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+
+	return credential
+}
+
+// login signs in with a and verifies the assertion against credential.
+func login(t *testing.T, rp *webauthn.RelyingParty, a *webauthntest.Authenticator, credential *webauthn.Credential) *webauthn.Assertion {
+	t.Helper()
+
+	challenge := newChallenge(t)
+	resp, err := a.Login(rp.RequestOptions(challenge))
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	assertion, err := rp.VerifyAssertion(resp, challenge, credential.PublicKey)
+	if err != nil {
+		t.Fatalf("VerifyAssertion: %v", err)
+	}
+
+	return assertion
+}
+
+func TestRegistration(t *testing.T) {
+	rp := newRelyingParty()
+
+	credential := register(t, rp, webauthntest.NewAuthenticator(testOrigin))
+	if len(credential.ID) <= 0 || len(credential.PublicKey) <= 0 {
+		t.Fatalf("credential without id or public key: %+v", credential)
+	}
+	if credential.SignCount != 0 || len(credential.AAGUID) != 16 {
+		t.Fatalf("credential = %+v, want counter 0 and a 16 byte AAGUID", credential)
+	}
+	if len(credential.Transports) != 1 || credential.Transports[0] != "internal" {
+		t.Fatalf("transports = %v, want [internal]", credential.Transports)
+	}
+
+	tests := []struct {
+		name   string
+		origin string
+		modify func(resp *webauthn.RegistrationResponse, challenge []byte) []byte
+	}{
+		{
+			name:   "other challenge",
+			origin: testOrigin,
+			modify: func(resp *webauthn.RegistrationResponse, challenge []byte) []byte {
+				return append([]byte{challenge[0] + 1}, challenge[1:]...)
+			},
+		},
+		{
+			name:   "origin not configured",
+			origin: "https://other.example.com",
+		},
+		{
+			name:   "credential type",
+			origin: testOrigin,
+			modify: func(resp *webauthn.RegistrationResponse, challenge []byte) []byte {
+				resp.Type = "password"
+				return challenge
+			},
+		},
+		{
+			name:   "rawId of another credential",
+			origin: testOrigin,
+			modify: func(resp *webauthn.RegistrationResponse, challenge []byte) []byte {
+				resp.RawID = []byte("another-credential")
+				return challenge
+			},
+		},
+		{
+			name:   "truncated attestation object",
+			origin: testOrigin,
+			modify: func(resp *webauthn.RegistrationResponse, challenge []byte) []byte {
+				resp.Response.AttestationObject = resp.Response.AttestationObject[:len(resp.Response.AttestationObject)-1]
+				return challenge
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge := newChallenge(t)
+			resp, err := webauthntest.NewAuthenticator(tt.origin).Register(rp.CreationOptions(challenge, testUser, nil))
+			if err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			if tt.modify != nil {
+				challenge = tt.modify(resp, challenge)
+			}
+
+			_, err = rp.VerifyRegistration(resp, challenge)
+			if !errors.Is(err, webauthn.ErrVerification) {
+				t.Fatalf("VerifyRegistration error = %v, want %v", err, webauthn.ErrVerification)
+			}
+		})
+	}
+}
+
+func TestRegistrationExcludesExistingCredentials(t *testing.T) {
+	rp := newRelyingParty()
+	a := webauthntest.NewAuthenticator(testOrigin)
+	credential := register(t, rp, a)
+
+	exclude := []webauthn.CredentialDescriptor{{Type: "public-key", ID: credential.ID}}
+	if _, err := a.Register(rp.CreationOptions(newChallenge(t), testUser, exclude)); err == nil {
+		t.Fatal("the authenticator registered an excluded credential again")
+	}
+}
+
+func TestAssertion(t *testing.T) {
+	rp := newRelyingParty()
+	a := webauthntest.NewAuthenticator(testOrigin)
+	credential := register(t, rp, a)
+
+	assertion := login(t, rp, a, credential)
+	if assertion.SignCount != 1 || !assertion.UserVerified {
+		t.Fatalf("assertion = %+v, want counter 1 and a verified user", assertion)
+	}
+	if assertion = login(t, rp, a, credential); assertion.SignCount != 2 {
+		t.Fatalf("second assertion counter = %d, want 2", assertion.SignCount)
+	}
+
+	other := register(t, rp, webauthntest.NewAuthenticator(testOrigin))
+
+	tests := []struct {
+		name      string
+		publicKey []byte
+		modify    func(resp *webauthn.AssertionResponse, challenge []byte) []byte
+	}{
+		{
+			name:      "other challenge",
+			publicKey: credential.PublicKey,
+			modify: func(resp *webauthn.AssertionResponse, challenge []byte) []byte {
+				return newChallenge(t)
+			},
+		},
+		{
+			name:      "key of another credential",
+			publicKey: other.PublicKey,
+		},
+		{
+			name:      "raised counter",
+			publicKey: credential.PublicKey,
+			modify: func(resp *webauthn.AssertionResponse, challenge []byte) []byte {
+				resp.Response.AuthenticatorData[36]++
+				return challenge
+			},
+		},
+		{
+			name:      "truncated signature",
+			publicKey: credential.PublicKey,
+			modify: func(resp *webauthn.AssertionResponse, challenge []byte) []byte {
+				resp.Response.Signature = resp.Response.Signature[:len(resp.Response.Signature)-1]
+				return challenge
+			},
+		},
+		{
+			name:      "user not present",
+			publicKey: credential.PublicKey,
+			modify: func(resp *webauthn.AssertionResponse, challenge []byte) []byte {
+				resp.Response.AuthenticatorData[32] &^= 0x01
+				return challenge
+			},
+		},
+		{
+			name:      "other relying party",
+			publicKey: credential.PublicKey,
+			modify: func(resp *webauthn.AssertionResponse, challenge []byte) []byte {
+				resp.Response.AuthenticatorData[0] ^= 0xff
+				return challenge
+			},
+		},
+		{
+			name:      "registration client data",
+			publicKey: credential.PublicKey,
+			modify: func(resp *webauthn.AssertionResponse, challenge []byte) []byte {
+				resp.Response.ClientDataJSON = bytes.Replace(resp.Response.ClientDataJSON, []byte("webauthn.get"), []byte("webauthn.create"), 1)
+				return challenge
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge := newChallenge(t)
+			resp, err := a.Login(rp.RequestOptions(challenge))
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			if tt.modify != nil {
+				challenge = tt.modify(resp, challenge)
+			}
+
+			_, err = rp.VerifyAssertion(resp, challenge, tt.publicKey)
+			if !errors.Is(err, webauthn.ErrVerification) {
+				t.Fatalf("VerifyAssertion error = %v, want %v", err, webauthn.ErrVerification)
+			}
+		})
+	}
+}
+
+func TestCloneDetection(t *testing.T) {
+	rp := newRelyingParty()
+	a := webauthntest.NewAuthenticator(testOrigin)
+	credential := register(t, rp, a)
+	stored := credential.SignCount
+
+	clone := a.Clone()
+
+	// the original signs first and the server stores its counter
+	assertion := login(t, rp, a, credential)
+	if !webauthn.SignCountValid(stored, assertion.SignCount) {
+		t.Fatalf("counter %d after %d refused", assertion.SignCount, stored)
+	}
+	stored = assertion.SignCount
+
+	// the clone reports the same counter, its signature is still valid
+	assertion = login(t, rp, clone, credential)
+	if webauthn.SignCountValid(stored, assertion.SignCount) {
+		t.Fatalf("clone counter %d after %d accepted", assertion.SignCount, stored)
+	}
+
+	// the original carries on
+	assertion = login(t, rp, a, credential)
+	if !webauthn.SignCountValid(stored, assertion.SignCount) {
+		t.Fatalf("counter %d after %d refused", assertion.SignCount, stored)
+	}
+}
+
+func TestSignCountValid(t *testing.T) {
+	tests := []struct {
+		stored, received uint32
+		want             bool
+	}{
+		{0, 0, true}, // no counter, as with synced passkeys
+		{0, 1, true},
+		{1, 2, true},
+		{5, 100, true},
+		{1, 1, false},
+		{2, 1, false},
+		{1, 0, false}, // a counter which went back to 0
+	}
+
+	for _, tt := range tests {
+		if got := webauthn.SignCountValid(tt.stored, tt.received); got != tt.want {
+			t.Errorf("SignCountValid(%d, %d) = %v, want %v", tt.stored, tt.received, got, tt.want)
+		}
+	}
+}
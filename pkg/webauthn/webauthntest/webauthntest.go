@@ -0,0 +1,278 @@
+// Package webauthntest provides a software authenticator for tests and local
+// runs, in the spirit of net/http/httptest. It answers the options of
+// package webauthn the way a browser with a platform authenticator would,
+// with ES256 passkeys, "none" attestation and a signature counter.
+package webauthntest
+
+import (
+	"app/pkg/webauthn"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+type Authenticator struct {
+	// Origin is the page the browser reports the ceremonies for.
+	Origin string
+
+	mu          sync.Mutex
+	credentials []*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// NewAuthenticator returns an authenticator without credentials used on
+// pages of origin.
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Clone returns an authenticator with copies of the credentials and their
+// counters, like a cloned hardware key.
+func (a *Authenticator) Clone() *Authenticator {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	clone := &Authenticator{Origin: a.Origin}
+	for _, c := range a.credentials {
+		copied := *c
+		clone.credentials = append(clone.credentials, &copied)
+	}
+
+	return clone
+}
+
+// Register creates a credential as navigator.credentials.create would.
+func (a *Authenticator) Register(opts *webauthn.CreationOptions) (*webauthn.RegistrationResponse, error) {
+	if err := a.checkRPID(opts.RP.ID); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, excluded := range opts.ExcludeCredentials {
+		for _, c := range a.credentials {
+			if bytes.Equal(c.id, excluded.ID) {
+				return nil, errors.New("webauthntest: InvalidStateError: the authenticator already has a credential for this account")
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c := &credential{id: id, rpID: opts.RP.ID, userHandle: opts.User.ID, key: key}
+
+	// a new credential replaces the one of the same account, as with passkeys
+	kept := a.credentials[:0]
+	for _, old := range a.credentials {
+		if old.rpID != c.rpID || !bytes.Equal(old.userHandle, c.userHandle) {
+			kept = append(kept, old)
+		}
+	}
+	a.credentials = append(kept, c)
+
+	coseKey := encodeMap(
+		int64(1), int64(2), // kty: EC2
+		int64(3), int64(webauthn.AlgES256),
+		int64(-1), int64(1), // crv: P-256
+		int64(-2), pad32(key.X.Bytes()),
+		int64(-3), pad32(key.Y.Bytes()),
+	)
+
+	attested := make([]byte, 16, 16+2+len(id)+len(coseKey)) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, coseKey...)
+
+	authData := authenticatorData(c.rpID, flagUserPresent|flagUserVerified|flagAttestedData, c.signCount, attested)
+
+	resp := &webauthn.RegistrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(id),
+		RawID: id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = a.clientData("webauthn.create", opts.Challenge)
+	resp.Response.AttestationObject = encodeMap(
+		"fmt", "none",
+		"attStmt", cborValue(encodeMap()),
+		"authData", authData,
+	)
+	resp.Response.Transports = []string{"internal"}
+
+	return resp, nil
+}
+
+// Login signs in as navigator.credentials.get would, with the latest
+// credential for the relying party which opts allow.
+func (a *Authenticator) Login(opts *webauthn.RequestOptions) (*webauthn.AssertionResponse, error) {
+	if err := a.checkRPID(opts.RPID); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var c *credential
+	for _, candidate := range a.credentials {
+		if candidate.rpID == opts.RPID && allowed(opts.AllowCredentials, candidate.id) {
+			c = candidate
+		}
+	}
+	if c == nil {
+		return nil, errors.New("webauthntest: NotAllowedError: no credential for this relying party")
+	}
+
+	c.signCount++
+
+	authData := authenticatorData(c.rpID, flagUserPresent|flagUserVerified, c.signCount, nil)
+	clientData := a.clientData("webauthn.get", opts.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(c.id),
+		RawID: c.id,
+		Type:  "public-key",
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = sig
+	resp.Response.UserHandle = c.userHandle
+
+	return resp, nil
+}
+
+// checkRPID refuses relying parties the origin may not use, as browsers do.
+func (a *Authenticator) checkRPID(rpID string) error {
+	u, err := url.Parse(a.Origin)
+	if err != nil {
+		return err
+	}
+
+	if host := u.Hostname(); host != rpID && !strings.HasSuffix(host, "."+rpID) {
+		return errors.New("webauthntest: SecurityError: the relying party id is not a registrable domain suffix of the origin")
+	}
+
+	return nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+
+	return data
+}
+
+func authenticatorData(rpID string, flags byte, signCount uint32, attested []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, signCount)
+
+	return append(data, attested...)
+}
+
+func allowed(list []webauthn.CredentialDescriptor, id []byte) bool {
+	if len(list) <= 0 {
+		return true
+	}
+
+	for _, d := range list {
+		if bytes.Equal(d.ID, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func pad32(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+// encodeMap encodes alternating keys and values as a CBOR map, in order.
+// Keys and values are int64, string or []byte; encoded CBOR is passed as
+// a value with cborValue.
+func encodeMap(pairs ...interface{}) []byte {
+	out := encodeHead(5, uint64(len(pairs)/2))
+	for _, item := range pairs {
+		out = append(out, encodeItem(item)...)
+	}
+
+	return out
+}
+
+func encodeItem(item interface{}) []byte {
+	switch v := item.(type) {
+	case int64:
+		if v < 0 {
+			return encodeHead(1, uint64(-1-v))
+		}
+		return encodeHead(0, uint64(v))
+	case string:
+		return append(encodeHead(3, uint64(len(v))), v...)
+	case []byte:
+		return append(encodeHead(2, uint64(len(v))), v...)
+	case cborValue:
+		return v
+	}
+
+	panic(fmt.Sprintf("webauthntest: cannot encode %T", item))
+}
+
+func encodeHead(major byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{major<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(arg))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, arg)
+	}
+}
+
+// cborValue is an item which is already encoded.
+type cborValue []byte
@@ -0,0 +1,197 @@
+package postgresql
+
+import (
+	"app/api/models"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type apiKeyRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyRepo(db *pgxpool.Pool) *apiKeyRepo {
+	return &apiKeyRepo{
+		db: db,
+	}
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, req *models.CreateAPIKey) (string, error) {
+	var (
+		query string
+		id    string
+	)
+	id = uuid.NewString()
+
+	query = `
+		INSERT INTO api_keys(
+			id,
+			user_id,
+			name,
+			prefix,
+			key_hash,
+			scopes,
+			expires_at
+		)
+		VALUES ( $1, $2, $3, $4, $5, $6, now() + NULLIF($7::INTERVAL, '0'::INTERVAL))
+	`
+	_, err := r.db.Exec(ctx, query,
+		id,
+		req.UserID,
+		req.Name,
+		req.Prefix,
+		req.KeyHash,
+		req.Scopes,
+		req.TTL,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetByID returns the key whether or not it is still active.
+func (r *apiKeyRepo) GetByID(ctx context.Context, req *models.APIKeyPrimaryKey) (*models.APIKey, error) {
+	var (
+		key   models.APIKey
+		where string
+		args  []interface{}
+	)
+
+	if len(req.Id) > 0 {
+		where = "id = $1 AND user_id = $2"
+		args = []interface{}{req.Id, req.UserID}
+	} else {
+		where = "prefix = $1"
+		args = []interface{}{req.Prefix}
+	}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			name,
+			prefix,
+			key_hash,
+			scopes,
+			revoked_at IS NULL AND (expires_at IS NULL OR expires_at > now()),
+			CAST(created_at AS VARCHAR),
+			COALESCE(CAST(expires_at AS VARCHAR), ''),
+			COALESCE(CAST(last_used_at AS VARCHAR), '')
+		FROM api_keys
+		WHERE ` + where
+
+	err := r.db.QueryRow(ctx, query, args...).Scan(
+		&key.Id,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.Scopes,
+		&key.Active,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// GetList returns the keys of a user which are not revoked, expired ones
+// included, newest first.
+func (r *apiKeyRepo) GetList(ctx context.Context, req *models.GetListAPIKeyRequest) (resp *models.GetListAPIKeyResponse, err error) {
+
+	resp = &models.GetListAPIKeyResponse{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			name,
+			prefix,
+			scopes,
+			expires_at IS NULL OR expires_at > now(),
+			CAST(created_at AS VARCHAR),
+			COALESCE(CAST(expires_at AS VARCHAR), ''),
+			COALESCE(CAST(last_used_at AS VARCHAR), '')
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key models.APIKey
+		err = rows.Scan(
+			&key.Id,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			&key.Scopes,
+			&key.Active,
+			&key.CreatedAt,
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.APIKeys = append(resp.APIKeys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resp.Count = len(resp.APIKeys)
+
+	return resp, nil
+}
+
+// Touch records that the key was just used.
+func (r *apiKeyRepo) Touch(ctx context.Context, req *models.APIKeyPrimaryKey) (int64, error) {
+	query := `
+		UPDATE
+		api_keys
+		SET
+			last_used_at = now()
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// Revoke revokes a key, only if it belongs to req.UserID.
+func (r *apiKeyRepo) Revoke(ctx context.Context, req *models.APIKeyPrimaryKey) (int64, error) {
+	query := `
+		UPDATE
+		api_keys
+		SET
+			revoked_at = now()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
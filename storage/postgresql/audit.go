@@ -0,0 +1,181 @@
+package postgresql
+
+import (
+	"app/api/models"
+	"app/pkg/helper"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type auditRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditRepo(db *pgxpool.Pool) *auditRepo {
+	return &auditRepo{
+		db: db,
+	}
+}
+
+func (r *auditRepo) Create(ctx context.Context, req *models.CreateAuditEvent) (string, error) {
+	var (
+		query string
+		id    string
+	)
+	id = uuid.NewString()
+
+	changes, err := json.Marshal(req.Changes)
+	if err != nil {
+		return "", err
+	}
+
+	query = `
+		INSERT INTO audit_events(
+			id,
+			action,
+			actor_id,
+			target_type,
+			target_id,
+			changes,
+			ip,
+			user_agent,
+			request_id
+		)
+		VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err = r.db.Exec(ctx, query,
+		id,
+		req.Action,
+		helper.NewNullString(req.ActorID),
+		req.TargetType,
+		req.TargetID,
+		changes,
+		req.IP,
+		req.UserAgent,
+		req.RequestID,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (r *auditRepo) GetList(ctx context.Context, req *models.GetListAuditRequest) (resp *models.GetListAuditResponse, err error) {
+
+	resp = &models.GetListAuditResponse{}
+
+	var (
+		query  string
+		filter = " WHERE TRUE "
+		order  = " ORDER BY seq DESC"
+		limit  = " LIMIT 10"
+		params = map[string]interface{}{}
+	)
+
+	query = `
+		SELECT
+			id,
+			seq,
+			action,
+			COALESCE(CAST(actor_id AS VARCHAR), ''),
+			target_type,
+			target_id,
+			COALESCE(changes, '{}'),
+			COALESCE(ip, ''),
+			COALESCE(user_agent, ''),
+			COALESCE(request_id, ''),
+			CAST(created_at AS VARCHAR)
+		FROM audit_events
+	`
+
+	if len(req.Action) > 0 {
+		filter += " AND action = :action"
+		params["action"] = req.Action
+	}
+
+	if len(req.ActorID) > 0 {
+		filter += " AND actor_id = :actor_id"
+		params["actor_id"] = req.ActorID
+	}
+
+	if len(req.TargetType) > 0 {
+		filter += " AND target_type = :target_type"
+		params["target_type"] = req.TargetType
+	}
+
+	if len(req.TargetID) > 0 {
+		filter += " AND target_id = :target_id"
+		params["target_id"] = req.TargetID
+	}
+
+	if len(req.DateFrom) > 0 {
+		filter += " AND created_at >= CAST(:date_from AS TIMESTAMP)"
+		params["date_from"] = req.DateFrom
+	}
+
+	if len(req.DateTo) > 0 {
+		filter += " AND created_at < CAST(:date_to AS TIMESTAMP)"
+		params["date_to"] = req.DateTo
+	}
+
+	if req.Cursor > 0 {
+		filter += " AND seq < :cursor"
+		params["cursor"] = req.Cursor
+	}
+
+	if req.Limit > 0 {
+		limit = fmt.Sprintf(" LIMIT %d", req.Limit)
+	}
+
+	query, args := helper.ReplaceQueryParams(query+filter+order+limit, params)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			event   models.AuditEvent
+			changes []byte
+		)
+		err = rows.Scan(
+			&event.Id,
+			&event.Seq,
+			&event.Action,
+			&event.ActorID,
+			&event.TargetType,
+			&event.TargetID,
+			&changes,
+			&event.IP,
+			&event.UserAgent,
+			&event.RequestID,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = json.Unmarshal(changes, &event.Changes); err != nil {
+			return nil, err
+		}
+
+		resp.Events = append(resp.Events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if req.Limit > 0 && len(resp.Events) == req.Limit {
+		resp.NextCursor = resp.Events[len(resp.Events)-1].Seq
+	}
+
+	return resp, nil
+}
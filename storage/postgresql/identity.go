@@ -0,0 +1,178 @@
+package postgresql
+
+import (
+	"app/api/models"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type identityRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewIdentityRepo(db *pgxpool.Pool) *identityRepo {
+	return &identityRepo{
+		db: db,
+	}
+}
+
+func (r *identityRepo) Create(ctx context.Context, req *models.CreateUserIdentity) (string, error) {
+	var (
+		query string
+		id    string
+	)
+	id = uuid.NewString()
+
+	query = `
+		INSERT INTO user_identities(
+			id,
+			user_id,
+			provider,
+			subject,
+			email
+		)
+		VALUES ( $1, $2, $3, $4, NULLIF($5, ''))
+	`
+	_, err := r.db.Exec(ctx, query,
+		id,
+		req.UserID,
+		req.Provider,
+		req.Subject,
+		req.Email,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (r *identityRepo) GetByID(ctx context.Context, req *models.UserIdentityPrimaryKey) (*models.UserIdentity, error) {
+	var (
+		identity models.UserIdentity
+		where    string
+		args     []interface{}
+	)
+
+	if len(req.Id) > 0 {
+		where = "id = $1 AND ($2 = '' OR user_id::VARCHAR = $2)"
+		args = []interface{}{req.Id, req.UserID}
+	} else {
+		where = "provider = $1 AND subject = $2"
+		args = []interface{}{req.Provider, req.Subject}
+	}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			provider,
+			subject,
+			COALESCE(email, ''),
+			CAST(created_at AS VARCHAR),
+			CAST(last_login_at AS VARCHAR)
+		FROM user_identities
+		WHERE ` + where
+
+	err := r.db.QueryRow(ctx, query, args...).Scan(
+		&identity.Id,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+		&identity.LastLoginAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// GetList returns the identities linked to a user, oldest first.
+func (r *identityRepo) GetList(ctx context.Context, req *models.GetListUserIdentityRequest) (resp *models.GetListUserIdentityResponse, err error) {
+
+	resp = &models.GetListUserIdentityResponse{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			provider,
+			subject,
+			COALESCE(email, ''),
+			CAST(created_at AS VARCHAR),
+			CAST(last_login_at AS VARCHAR)
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var identity models.UserIdentity
+		err = rows.Scan(
+			&identity.Id,
+			&identity.UserID,
+			&identity.Provider,
+			&identity.Subject,
+			&identity.Email,
+			&identity.CreatedAt,
+			&identity.LastLoginAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Identities = append(resp.Identities, &identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resp.Count = len(resp.Identities)
+
+	return resp, nil
+}
+
+// Touch records a login through the identity and the email the provider reported with it.
+func (r *identityRepo) Touch(ctx context.Context, req *models.TouchUserIdentity) (int64, error) {
+	query := `
+		UPDATE
+		user_identities
+		SET
+			last_login_at = now(),
+			email = NULLIF($2, '')
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// Delete unlinks an identity, only if it belongs to req.UserID.
+func (r *identityRepo) Delete(ctx context.Context, req *models.UserIdentityPrimaryKey) (int64, error) {
+	query := `
+		DELETE FROM user_identities WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,333 @@
+package postgresql
+
+import (
+	"app/api/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type oauthRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewOAuthRepo(db *pgxpool.Pool) *oauthRepo {
+	return &oauthRepo{
+		db: db,
+	}
+}
+
+func (r *oauthRepo) CreateClient(ctx context.Context, req *models.CreateOAuthClient) (string, error) {
+	var (
+		query string
+		id    string
+	)
+	id = uuid.NewString()
+
+	query = `
+		INSERT INTO oauth_clients(
+			id,
+			name,
+			secret_hash,
+			redirect_uris,
+			scopes,
+			grant_types,
+			updated_at
+		)
+		VALUES ( $1, $2, NULLIF($3, ''), $4, $5, $6, now())
+	`
+	_, err := r.db.Exec(ctx, query,
+		id,
+		req.Name,
+		req.SecretHash,
+		req.RedirectURIs,
+		req.Scopes,
+		req.GrantTypes,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (r *oauthRepo) GetClient(ctx context.Context, req *models.OAuthClientPrimaryKey) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+
+	query := `
+		SELECT
+			id,
+			name,
+			COALESCE(secret_hash, ''),
+			secret_hash IS NULL,
+			redirect_uris,
+			scopes,
+			grant_types,
+			CAST(created_at AS VARCHAR),
+			CAST(updated_at AS VARCHAR)
+		FROM oauth_clients
+		WHERE id = $1
+	`
+
+	err := r.db.QueryRow(ctx, query, req.Id).Scan(
+		&client.Id,
+		&client.Name,
+		&client.SecretHash,
+		&client.Public,
+		&client.RedirectURIs,
+		&client.Scopes,
+		&client.GrantTypes,
+		&client.CreatedAt,
+		&client.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+func (r *oauthRepo) GetListClient(ctx context.Context, req *models.GetListOAuthClientRequest) (resp *models.GetListOAuthClientResponse, err error) {
+
+	resp = &models.GetListOAuthClientResponse{}
+
+	var (
+		offset = " OFFSET 0"
+		limit  = " LIMIT 10"
+	)
+
+	query := `
+		SELECT
+			COUNT(*) OVER(),
+			id,
+			name,
+			secret_hash IS NULL,
+			redirect_uris,
+			scopes,
+			grant_types,
+			CAST(created_at AS VARCHAR),
+			CAST(updated_at AS VARCHAR)
+		FROM oauth_clients
+		ORDER BY created_at
+	`
+
+	if req.Offset > 0 {
+		offset = fmt.Sprintf(" OFFSET %d", req.Offset)
+	}
+
+	if req.Limit > 0 {
+		limit = fmt.Sprintf(" LIMIT %d", req.Limit)
+	}
+
+	rows, err := r.db.Query(ctx, query+offset+limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var client models.OAuthClient
+		err = rows.Scan(
+			&resp.Count,
+			&client.Id,
+			&client.Name,
+			&client.Public,
+			&client.RedirectURIs,
+			&client.Scopes,
+			&client.GrantTypes,
+			&client.CreatedAt,
+			&client.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Clients = append(resp.Clients, &client)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (r *oauthRepo) DeleteClient(ctx context.Context, req *models.OAuthClientPrimaryKey) (int64, error) {
+	query := `
+		DELETE
+		FROM oauth_clients
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (r *oauthRepo) CreateCode(ctx context.Context, req *models.CreateOAuthCode) error {
+	query := `
+		INSERT INTO oauth_codes(
+			code_hash,
+			client_id,
+			user_id,
+			redirect_uri,
+			scope,
+			code_challenge,
+			code_challenge_method,
+			nonce,
+			expires_at
+		)
+		VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, now() + $9::INTERVAL)
+	`
+
+	_, err := r.db.Exec(ctx, query,
+		req.CodeHash,
+		req.ClientID,
+		req.UserID,
+		req.RedirectURI,
+		req.Scope,
+		req.CodeChallenge,
+		req.CodeChallengeMethod,
+		req.Nonce,
+		req.TTL,
+	)
+
+	return err
+}
+
+// ConsumeCode marks an unexpired code used and returns it. A code can be
+// consumed once; afterwards it is reported as not found.
+func (r *oauthRepo) ConsumeCode(ctx context.Context, req *models.OAuthCodePrimaryKey) (*models.OAuthCode, error) {
+	var code models.OAuthCode
+
+	query := `
+		UPDATE
+		oauth_codes
+		SET
+			used_at = now()
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING
+			client_id,
+			user_id,
+			redirect_uri,
+			scope,
+			code_challenge,
+			code_challenge_method,
+			nonce
+	`
+
+	err := r.db.QueryRow(ctx, query, req.CodeHash).Scan(
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.CodeChallengeMethod,
+		&code.Nonce,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+func (r *oauthRepo) CreateRefreshToken(ctx context.Context, req *models.CreateOAuthRefreshToken) (string, error) {
+	var (
+		query string
+		id    string
+	)
+	id = uuid.NewString()
+
+	query = `
+		INSERT INTO oauth_refresh_tokens(
+			id,
+			token_hash,
+			client_id,
+			user_id,
+			session_id,
+			scope,
+			expires_at
+		)
+		SELECT $1, $2, $3, $4, id, $6, expires_at
+		FROM sessions
+		WHERE id = $5
+	`
+
+	result, err := r.db.Exec(ctx, query,
+		id,
+		req.TokenHash,
+		req.ClientID,
+		req.UserID,
+		req.SessionID,
+		req.Scope,
+	)
+	if err != nil {
+		return "", err
+	}
+	if result.RowsAffected() <= 0 {
+		return "", errors.New("session not found")
+	}
+
+	return id, nil
+}
+
+func (r *oauthRepo) GetRefreshToken(ctx context.Context, req *models.OAuthRefreshTokenPrimaryKey) (*models.OAuthRefreshToken, error) {
+	var token models.OAuthRefreshToken
+
+	query := `
+		SELECT
+			t.id,
+			t.client_id,
+			t.user_id,
+			t.session_id,
+			t.scope,
+			t.used_at IS NOT NULL,
+			t.used_at IS NULL AND t.expires_at > now() AND s.revoked_at IS NULL,
+			CAST(EXTRACT(EPOCH FROM t.expires_at::TIMESTAMPTZ) AS BIGINT)
+		FROM oauth_refresh_tokens AS t
+		JOIN sessions AS s ON s.id = t.session_id
+		WHERE t.token_hash = $1
+	`
+
+	err := r.db.QueryRow(ctx, query, req.TokenHash).Scan(
+		&token.Id,
+		&token.ClientID,
+		&token.UserID,
+		&token.SessionID,
+		&token.Scope,
+		&token.Used,
+		&token.Active,
+		&token.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// UseRefreshToken marks a refresh token used. Zero rows affected means it was
+// already used, by a concurrent request or a replay.
+func (r *oauthRepo) UseRefreshToken(ctx context.Context, req *models.OAuthRefreshTokenPrimaryKey) (int64, error) {
+	query := `
+		UPDATE
+		oauth_refresh_tokens
+		SET
+			used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, req.TokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,177 @@
+package postgresql
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type otpRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewOTPRepo(db *pgxpool.Pool) *otpRepo {
+	return &otpRepo{
+		db: db,
+	}
+}
+
+// Create stores a code, or returns storage.ErrOTPResendInterval or
+// storage.ErrOTPHourlyLimit when the number got too many lately. Concurrent
+// calls for a number wait for each other, so the limits hold for them too.
+func (r *otpRepo) Create(ctx context.Context, req *models.CreateOTPCode) (string, error) {
+	var (
+		query  string
+		id     string
+		recent int
+		hourly int
+	)
+	id = uuid.NewString()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	// held until the transaction ends
+	_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('otp_codes:' || $1))", req.Phone)
+	if err != nil {
+		return "", err
+	}
+
+	query = `
+		SELECT
+			COUNT(*) FILTER (WHERE created_at > clock_timestamp() - $2::INTERVAL),
+			COUNT(*)
+		FROM otp_codes
+		WHERE phone = $1 AND created_at > clock_timestamp() - INTERVAL '1 hour'
+	`
+	err = tx.QueryRow(ctx, query, req.Phone, req.ResendInterval).Scan(&recent, &hourly)
+	if err != nil {
+		return "", err
+	}
+	if req.ResendInterval > 0 && recent > 0 {
+		return "", storage.ErrOTPResendInterval
+	}
+	if hourly >= req.MaxPerHour {
+		return "", storage.ErrOTPHourlyLimit
+	}
+
+	query = `
+		INSERT INTO otp_codes(
+			id,
+			purpose,
+			phone,
+			user_id,
+			phone_id,
+			code_hash,
+			created_at,
+			expires_at
+		)
+		VALUES ( $1, $2, $3, NULLIF($4, '')::UUID, NULLIF($5, '')::UUID, $6, clock_timestamp(), clock_timestamp() + $7::INTERVAL)
+	`
+	_, err = tx.Exec(ctx, query,
+		id,
+		req.Purpose,
+		req.Phone,
+		req.UserID,
+		req.PhoneID,
+		req.CodeHash,
+		req.TTL,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetActive returns the latest code sent to req.Phone for req.Purpose if it
+// is neither used nor expired. Codes sent before it are no longer accepted.
+func (r *otpRepo) GetActive(ctx context.Context, req *models.OTPCodePrimaryKey) (*models.OTPCode, error) {
+	var code models.OTPCode
+
+	query := `
+		SELECT
+			id,
+			purpose,
+			phone,
+			COALESCE(CAST(user_id AS VARCHAR), ''),
+			COALESCE(CAST(phone_id AS VARCHAR), ''),
+			code_hash,
+			attempts,
+			CAST(created_at AS VARCHAR),
+			CAST(expires_at AS VARCHAR)
+		FROM (
+			SELECT *
+			FROM otp_codes
+			WHERE purpose = $1 AND phone = $2
+			ORDER BY created_at DESC
+			LIMIT 1
+		) AS latest
+		WHERE consumed_at IS NULL AND expires_at > now()
+	`
+
+	err := r.db.QueryRow(ctx, query, req.Purpose, req.Phone).Scan(
+		&code.Id,
+		&code.Purpose,
+		&code.Phone,
+		&code.UserID,
+		&code.PhoneID,
+		&code.CodeHash,
+		&code.Attempts,
+		&code.CreatedAt,
+		&code.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// Attempt counts a guess against an active code. It affects no row once the
+// code has had req.MaxAttempts guesses.
+func (r *otpRepo) Attempt(ctx context.Context, req *models.AttemptOTPCode) (int64, error) {
+	query := `
+		UPDATE
+		otp_codes
+		SET
+			attempts = attempts + 1
+		WHERE id = $1 AND attempts < $2 AND consumed_at IS NULL AND expires_at > now()
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.MaxAttempts)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// Consume marks a code used. Only the first of concurrent calls affects a row.
+func (r *otpRepo) Consume(ctx context.Context, req *models.OTPCodePrimaryKey) (int64, error) {
+	query := `
+		UPDATE
+		otp_codes
+		SET
+			consumed_at = now()
+		WHERE id = $1 AND consumed_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -52,13 +52,21 @@ func (r *phoneRepo) Create(ctx context.Context, req *models.CreatePhone) (string
 	return id, nil
 }
 
+// GetByID looks a phone up by id, or by its normalized number among verified phones.
 func (r *phoneRepo) GetByID(ctx context.Context, req *models.PhonePrimaryKey) (*models.Phone, error) {
 
 	var (
 		query string
-		phone  models.Phone
+		phone models.Phone
+		where = "id = $1"
+		arg   = req.Id
 	)
 
+	if len(req.Id) <= 0 {
+		where = "regexp_replace(phone, '[^0-9+]', '', 'g') = $1 AND verified_at IS NOT NULL"
+		arg = req.Phone
+	}
+
 	query = `
 		SELECT
 			id, 
@@ -66,18 +74,19 @@ func (r *phoneRepo) GetByID(ctx context.Context, req *models.PhonePrimaryKey) (*
 			phone,
 			description,
 			is_fax,
+			verified_at IS NOT NULL,
 			CAST(created_at::timestamp AS VARCHAR),
 			CAST(updated_at::timestamp AS VARCHAR)
 		FROM phones
-		WHERE id = $1
-	`
+		WHERE ` + where
 
-	err := r.db.QueryRow(ctx, query, req.Id).Scan(
+	err := r.db.QueryRow(ctx, query, arg).Scan(
 		&phone.Id,
 		&phone.UserID,
 		&phone.Phone,
 		&phone.Description,
 		&phone.IsFax,
+		&phone.Verified,
 		&phone.CreatedAt,
 		&phone.UpdatedAt,
 	)
@@ -107,6 +116,7 @@ func (r *phoneRepo) GetList(ctx context.Context, req *models.GetListPhoneRequest
 			phone,
 			description,
 			is_fax,
+			verified_at IS NOT NULL,
 			CAST(created_at::timestamp AS VARCHAR),
 			CAST(updated_at::timestamp AS VARCHAR)
 		FROM phones
@@ -127,7 +137,7 @@ func (r *phoneRepo) GetList(ctx context.Context, req *models.GetListPhoneRequest
 		filter+= " AND user_id =  '" + req.UserID + "'"
 	}
 
-	query += filter + offset + limit
+	query += filter + " ORDER BY created_at" + offset + limit
 
 	rows, err := r.db.Query(ctx, query)
 	if err != nil {
@@ -144,6 +154,7 @@ func (r *phoneRepo) GetList(ctx context.Context, req *models.GetListPhoneRequest
 			&phone.Phone,
 			&phone.Description,
 			&phone.IsFax,
+			&phone.Verified,
 			&phone.CreatedAt,
 			&phone.UpdatedAt,
 		)
@@ -172,6 +183,8 @@ func (r *phoneRepo) Update(ctx context.Context, req *models.UpdatePhone) (int64,
 			phone = :phone,
 			description = :description,
 			is_fax = :is_fax,
+			-- a changed number has to be verified again
+			verified_at = CASE WHEN phone = :phone THEN verified_at END,
 			updated_at = now()
 		WHERE id = :id and user_id = :user_id
 	`
@@ -194,6 +207,31 @@ func (r *phoneRepo) Update(ctx context.Context, req *models.UpdatePhone) (int64,
 	return result.RowsAffected(), nil
 }
 
+// Verify marks a phone verified if its number is still req.Phone and no
+// other phone has verified the same number.
+func (r *phoneRepo) Verify(ctx context.Context, req *models.VerifyPhone) (int64, error) {
+	query := `
+		UPDATE
+		phones
+		SET
+			verified_at = now()
+		WHERE id = $1 AND phone = $2 AND verified_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1
+				FROM phones AS other
+				WHERE other.verified_at IS NOT NULL
+					AND regexp_replace(other.phone, '[^0-9+]', '', 'g') = regexp_replace($2, '[^0-9+]', '', 'g')
+			)
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.Phone)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
 func (r *phoneRepo) Delete(ctx context.Context, req *models.PhonePrimaryKey) (int64, error) {
 	query := `
 		DELETE 
@@ -13,6 +13,13 @@ type Store struct {
 	db       *pgxpool.Pool
 	user     storage.UserRepoI
 	phone    storage.PhoneRepoI
+	audit    storage.AuditRepoI
+	session  storage.SessionRepoI
+	oauth    storage.OAuthRepoI
+	identity storage.IdentityRepoI
+	apiKey   storage.APIKeyRepoI
+	otp      storage.OTPRepoI
+	webAuthn storage.WebAuthnRepoI
 }
 
 func NewConnectPostgresql(cfg *config.Config) (storage.StorageI, error) {
@@ -37,6 +44,13 @@ func NewConnectPostgresql(cfg *config.Config) (storage.StorageI, error) {
 		db:       pgpool,
 		user:     NewUserRepo(pgpool),
 		phone: NewPhoneRepo(pgpool),
+		audit:    NewAuditRepo(pgpool),
+		session:  NewSessionRepo(pgpool),
+		oauth:    NewOAuthRepo(pgpool),
+		identity: NewIdentityRepo(pgpool),
+		apiKey:   NewAPIKeyRepo(pgpool),
+		otp:      NewOTPRepo(pgpool),
+		webAuthn: NewWebAuthnRepo(pgpool),
 	}, nil
 }
 
@@ -44,6 +58,16 @@ func (s *Store) CloseDB() {
 	s.db.Close()
 }
 
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+// MigrationVersion reads the schema version recorded by golang-migrate.
+func (s *Store) MigrationVersion(ctx context.Context) (version int64, dirty bool, err error) {
+	err = s.db.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	return version, dirty, err
+}
+
 func (s *Store) User() storage.UserRepoI {
 	if s.user == nil {
 		s.user = NewUserRepo(s.db)
@@ -60,3 +84,63 @@ func (s *Store) Phone() storage.PhoneRepoI {
 
 	return s.phone
 }
+
+func (s *Store) Audit() storage.AuditRepoI {
+	if s.audit == nil {
+		s.audit = NewAuditRepo(s.db)
+	}
+
+	return s.audit
+}
+
+func (s *Store) Session() storage.SessionRepoI {
+	if s.session == nil {
+		s.session = NewSessionRepo(s.db)
+	}
+
+	return s.session
+}
+
+func (s *Store) OAuth() storage.OAuthRepoI {
+	if s.oauth == nil {
+		s.oauth = NewOAuthRepo(s.db)
+	}
+
+	return s.oauth
+}
+
+func (s *Store) Identity() storage.IdentityRepoI {
+	if s.identity == nil {
+		s.identity = NewIdentityRepo(s.db)
+	}
+
+	return s.identity
+}
+
+func (s *Store) APIKey() storage.APIKeyRepoI {
+	if s.apiKey == nil {
+		s.apiKey = NewAPIKeyRepo(s.db)
+	}
+
+	return s.apiKey
+}
+
+func (s *Store) OTP() storage.OTPRepoI {
+	if s.otp == nil {
+		s.otp = NewOTPRepo(s.db)
+	}
+
+	return s.otp
+}
+
+func (s *Store) WebAuthn() storage.WebAuthnRepoI {
+	if s.webAuthn == nil {
+		s.webAuthn = NewWebAuthnRepo(s.db)
+	}
+
+	return s.webAuthn
+}
+
+func (s *Store) Stat() *pgxpool.Stat {
+	return s.db.Stat()
+}
@@ -0,0 +1,199 @@
+package postgresql
+
+import (
+	"app/api/models"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type sessionRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionRepo(db *pgxpool.Pool) *sessionRepo {
+	return &sessionRepo{
+		db: db,
+	}
+}
+
+func (r *sessionRepo) Create(ctx context.Context, req *models.CreateSession) (string, error) {
+	var (
+		query string
+		id    string
+	)
+	id = uuid.NewString()
+
+	query = `
+		INSERT INTO sessions(
+			id,
+			user_id,
+			device_name,
+			user_agent,
+			ip,
+			expires_at
+		)
+		VALUES ( $1, $2, $3, $4, $5, now() + $6::INTERVAL)
+	`
+	_, err := r.db.Exec(ctx, query,
+		id,
+		req.UserID,
+		req.DeviceName,
+		req.UserAgent,
+		req.IP,
+		req.TTL,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetByID returns the session whether or not it is still active; Revoked
+// is also set for expired sessions.
+func (r *sessionRepo) GetByID(ctx context.Context, req *models.SessionPrimaryKey) (*models.Session, error) {
+	var session models.Session
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			COALESCE(device_name, ''),
+			COALESCE(user_agent, ''),
+			COALESCE(ip, ''),
+			revoked_at IS NOT NULL OR expires_at <= now(),
+			CAST(created_at AS VARCHAR),
+			CAST(last_seen_at AS VARCHAR),
+			CAST(expires_at AS VARCHAR)
+		FROM sessions
+		WHERE id = $1
+	`
+
+	err := r.db.QueryRow(ctx, query, req.Id).Scan(
+		&session.Id,
+		&session.UserID,
+		&session.DeviceName,
+		&session.UserAgent,
+		&session.IP,
+		&session.Revoked,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// GetList returns the active sessions of a user, most recently used first.
+func (r *sessionRepo) GetList(ctx context.Context, req *models.GetListSessionRequest) (resp *models.GetListSessionResponse, err error) {
+
+	resp = &models.GetListSessionResponse{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			COALESCE(device_name, ''),
+			COALESCE(user_agent, ''),
+			COALESCE(ip, ''),
+			CAST(created_at AS VARCHAR),
+			CAST(last_seen_at AS VARCHAR),
+			CAST(expires_at AS VARCHAR)
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > now()
+		ORDER BY last_seen_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session models.Session
+		err = rows.Scan(
+			&session.Id,
+			&session.UserID,
+			&session.DeviceName,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Sessions = append(resp.Sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resp.Count = len(resp.Sessions)
+
+	return resp, nil
+}
+
+// Touch records that the session was just used, from which address and client.
+func (r *sessionRepo) Touch(ctx context.Context, req *models.TouchSession) (int64, error) {
+	query := `
+		UPDATE
+		sessions
+		SET
+			last_seen_at = now(),
+			user_agent = $2,
+			ip = $3
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.UserAgent, req.IP)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// Revoke revokes one active session, only if it belongs to req.UserID.
+func (r *sessionRepo) Revoke(ctx context.Context, req *models.SessionPrimaryKey) (int64, error) {
+	query := `
+		UPDATE
+		sessions
+		SET
+			revoked_at = now()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (r *sessionRepo) RevokeAll(ctx context.Context, req *models.RevokeSessions) (int64, error) {
+	query := `
+		UPDATE
+		sessions
+		SET
+			revoked_at = now()
+		WHERE user_id = $1 AND revoked_at IS NULL AND id::VARCHAR <> $2
+	`
+
+	result, err := r.db.Exec(ctx, query, req.UserID, req.ExceptID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
@@ -32,16 +32,18 @@ func (r *userRepo) Create(ctx context.Context, req *models.CreateUser) (string,
 			id, 
 			name,
 			login,
+			email,
 			password,
 			age,
 			updated_at 
 		)
-		VALUES ( $1, $2, $3, $4, $5, now())
+		VALUES ( $1, $2, $3, NULLIF($4, ''), $5, $6, now())
 	`
 	_, err := r.db.Exec(ctx, query,
 		id,
 		req.Name,
 		req.Login,
+		req.Email,
 		req.Password,
 		req.Age,
 	)
@@ -67,13 +69,23 @@ func (r *userRepo) GetByID(ctx context.Context, req *models.UserPrimaryKey) (*mo
 		}
 	}
 
+	if len(req.Email) > 0 {
+		err := r.db.QueryRow(ctx, "SELECT id FROM users WHERE lower(email) = lower($1)", req.Email).Scan(&req.Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	query = `
 		SELECT
 			id, 
 			name,
 			login,
+			COALESCE(email, ''),
+			email_verified_at IS NOT NULL,
 			password,
 			age,
+			role,
 			CAST(created_at::timestamp AS VARCHAR),
 			CAST(updated_at::timestamp AS VARCHAR)
 		FROM users
@@ -84,8 +96,11 @@ func (r *userRepo) GetByID(ctx context.Context, req *models.UserPrimaryKey) (*mo
 		&user.Id,
 		&user.Name,
 		&user.Login,
+		&user.Email,
+		&user.EmailVerified,
 		&user.Password,
 		&user.Age,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -115,8 +130,11 @@ func (r *userRepo) GetByName(ctx context.Context, req *models.UserPrimaryKey) (*
 			id, 
 			name,
 			login,
+			COALESCE(email, ''),
+			email_verified_at IS NOT NULL,
 			password,
 			age,
+			role,
 			CAST(created_at::timestamp AS VARCHAR),
 			CAST(updated_at::timestamp AS VARCHAR)
 		FROM users
@@ -127,8 +145,11 @@ func (r *userRepo) GetByName(ctx context.Context, req *models.UserPrimaryKey) (*
 		&user.Id,
 		&user.Name,
 		&user.Login,
+		&user.Email,
+		&user.EmailVerified,
 		&user.Password,
 		&user.Age,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -156,8 +177,11 @@ func (r *userRepo) GetList(ctx context.Context, req *models.GetListUserRequest)
 			id, 
 			name,
 			login,
+			COALESCE(email, ''),
+			email_verified_at IS NOT NULL,
 			password,
 			age,
+			role,
 			CAST(created_at::timestamp AS VARCHAR),
 			CAST(updated_at::timestamp AS VARCHAR)
 		FROM users
@@ -193,8 +217,11 @@ func (r *userRepo) GetList(ctx context.Context, req *models.GetListUserRequest)
 			&user.Id,
 			&user.Name,
 			&user.Login,
+			&user.Email,
+			&user.EmailVerified,
 			&user.Password,
 			&user.Age,
+			&user.Role,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 		)
@@ -221,6 +248,10 @@ func (r *userRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, e
 			id = :id,
 			name = :name,
 			login = :login,
+			email_verified_at = CASE
+				WHEN lower(email) = lower(:email) THEN email_verified_at
+			END,
+			email = NULLIF(:email, ''),
 			password = :password,
 			age = :age,
 			updated_at = now()
@@ -231,6 +262,7 @@ func (r *userRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, e
 		"id":       req.Id,
 		"name":     req.Name,
 		"login":    req.Login,
+		"email":    req.Email,
 		"password": req.Password,
 		"age":      req.Age,
 	}
@@ -245,6 +277,60 @@ func (r *userRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, e
 	return result.RowsAffected(), nil
 }
 
+func (r *userRepo) UpdatePassword(ctx context.Context, req *models.UpdateUserPassword) (int64, error) {
+	query := `
+		UPDATE
+		users
+		SET
+			password = $2,
+			updated_at = now()
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.Password)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (r *userRepo) VerifyEmail(ctx context.Context, req *models.VerifyUserEmail) (int64, error) {
+	query := `
+		UPDATE
+		users
+		SET
+			email_verified_at = now(),
+			updated_at = now()
+		WHERE id = $1 AND lower(email) = lower($2) AND email_verified_at IS NULL
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (r *userRepo) UpdateRole(ctx context.Context, req *models.UpdateUserRole) (int64, error) {
+	query := `
+		UPDATE
+		users
+		SET
+			role = $2,
+			updated_at = now()
+		WHERE id = $1
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.Role)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
 func (r *userRepo) Delete(ctx context.Context, req *models.UserPrimaryKey) (int64, error) {
 	query := `
 		DELETE 
@@ -0,0 +1,237 @@
+package postgresql
+
+import (
+	"app/api/models"
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type webAuthnRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewWebAuthnRepo(db *pgxpool.Pool) *webAuthnRepo {
+	return &webAuthnRepo{
+		db: db,
+	}
+}
+
+func (r *webAuthnRepo) Create(ctx context.Context, req *models.CreateWebAuthnCredential) (string, error) {
+	var (
+		query string
+		id    string
+	)
+	id = uuid.NewString()
+
+	query = `
+		INSERT INTO webauthn_credentials(
+			id,
+			user_id,
+			name,
+			credential_id,
+			public_key,
+			sign_count,
+			aaguid,
+			transports,
+			backup_eligible,
+			backed_up
+		)
+		VALUES ( $1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err := r.db.Exec(ctx, query,
+		id,
+		req.UserID,
+		req.Name,
+		req.CredentialID,
+		req.PublicKey,
+		int64(req.SignCount),
+		req.AAGUID,
+		req.Transports,
+		req.BackupEligible,
+		req.BackedUp,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (r *webAuthnRepo) GetByID(ctx context.Context, req *models.WebAuthnCredentialPrimaryKey) (*models.WebAuthnCredential, error) {
+	var (
+		credential models.WebAuthnCredential
+		signCount  int64
+		where      string
+		args       []interface{}
+	)
+
+	if len(req.Id) > 0 {
+		where = "id = $1 AND user_id = $2"
+		args = []interface{}{req.Id, req.UserID}
+	} else {
+		where = "credential_id = $1"
+		args = []interface{}{req.CredentialID}
+	}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			name,
+			credential_id,
+			public_key,
+			sign_count,
+			aaguid,
+			transports,
+			backup_eligible,
+			backed_up,
+			CAST(created_at AS VARCHAR),
+			COALESCE(CAST(last_used_at AS VARCHAR), '')
+		FROM webauthn_credentials
+		WHERE ` + where
+
+	err := r.db.QueryRow(ctx, query, args...).Scan(
+		&credential.Id,
+		&credential.UserID,
+		&credential.Name,
+		&credential.CredentialID,
+		&credential.PublicKey,
+		&signCount,
+		&credential.AAGUID,
+		&credential.Transports,
+		&credential.BackupEligible,
+		&credential.BackedUp,
+		&credential.CreatedAt,
+		&credential.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	credential.SignCount = uint32(signCount)
+
+	return &credential, nil
+}
+
+// GetList returns the passkeys of a user, oldest first.
+func (r *webAuthnRepo) GetList(ctx context.Context, req *models.GetListWebAuthnCredentialRequest) (resp *models.GetListWebAuthnCredentialResponse, err error) {
+
+	resp = &models.GetListWebAuthnCredentialResponse{}
+
+	query := `
+		SELECT
+			id,
+			user_id,
+			name,
+			credential_id,
+			transports,
+			backup_eligible,
+			backed_up,
+			CAST(created_at AS VARCHAR),
+			COALESCE(CAST(last_used_at AS VARCHAR), '')
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(ctx, query, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var credential models.WebAuthnCredential
+		err = rows.Scan(
+			&credential.Id,
+			&credential.UserID,
+			&credential.Name,
+			&credential.CredentialID,
+			&credential.Transports,
+			&credential.BackupEligible,
+			&credential.BackedUp,
+			&credential.CreatedAt,
+			&credential.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Credentials = append(resp.Credentials, &credential)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	resp.Count = len(resp.Credentials)
+
+	return resp, nil
+}
+
+// Touch records a login and stores the new signature counter. It affects no
+// row when the counter did not grow past the stored one, unless both are 0
+// for an authenticator without a counter, so of two logins racing with the
+// same counter only one succeeds.
+func (r *webAuthnRepo) Touch(ctx context.Context, req *models.TouchWebAuthnCredential) (int64, error) {
+	query := `
+		UPDATE
+		webauthn_credentials
+		SET
+			sign_count = $2,
+			backed_up = $3,
+			last_used_at = now()
+		WHERE id = $1 AND (sign_count < $2 OR (sign_count = 0 AND $2 = 0))
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, int64(req.SignCount), req.BackedUp)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// Delete removes a passkey, only if it belongs to req.UserID.
+func (r *webAuthnRepo) Delete(ctx context.Context, req *models.WebAuthnCredentialPrimaryKey) (int64, error) {
+	query := `
+		DELETE
+		FROM webauthn_credentials
+		WHERE id = $1 AND user_id = $2
+	`
+
+	result, err := r.db.Exec(ctx, query, req.Id, req.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UseChallenge records a challenge as used, dropping the expired ones. It
+// affects no row when the challenge was used already, so of two requests
+// finishing with the same one only the first succeeds.
+func (r *webAuthnRepo) UseChallenge(ctx context.Context, req *models.UseWebAuthnChallenge) (int64, error) {
+	query := `
+		WITH expired AS (
+			DELETE
+			FROM webauthn_challenges
+			WHERE expires_at <= now()
+		)
+		INSERT INTO webauthn_challenges(
+			challenge_hash,
+			expires_at
+		)
+		VALUES ($1, now() + $2::INTERVAL)
+		ON CONFLICT (challenge_hash) DO NOTHING
+	`
+
+	result, err := r.db.Exec(ctx, query, req.ChallengeHash, req.TTL)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected(), nil
+}
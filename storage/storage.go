@@ -3,18 +3,37 @@ package storage
 import (
 	"app/api/models"
 	"context"
+	"errors"
+)
+
+// Errors of OTPRepoI.Create when the number got too many codes lately.
+var (
+	ErrOTPResendInterval = errors.New("a code was sent to this number moments ago")
+	ErrOTPHourlyLimit    = errors.New("too many codes were sent to this number")
 )
 
 type StorageI interface {
 	CloseDB()
+	Ping(ctx context.Context) error
+	MigrationVersion(ctx context.Context) (version int64, dirty bool, err error)
 	User() UserRepoI
 	Phone() PhoneRepoI
+	Audit() AuditRepoI
+	Session() SessionRepoI
+	OAuth() OAuthRepoI
+	Identity() IdentityRepoI
+	APIKey() APIKeyRepoI
+	OTP() OTPRepoI
+	WebAuthn() WebAuthnRepoI
 }
 type UserRepoI interface {
 	Create(ctx context.Context, req *models.CreateUser) (string, error)
 	GetByID(ctx context.Context, req *models.UserPrimaryKey) (*models.User, error)
 	GetList(ctx context.Context, req *models.GetListUserRequest) (resp *models.GetListUserResponse, err error)
 	Update(ctx context.Context, req *models.UpdateUser) (int64, error)
+	UpdatePassword(ctx context.Context, req *models.UpdateUserPassword) (int64, error)
+	UpdateRole(ctx context.Context, req *models.UpdateUserRole) (int64, error)
+	VerifyEmail(ctx context.Context, req *models.VerifyUserEmail) (int64, error)
 	Delete(ctx context.Context, req *models.UserPrimaryKey) (int64, error)
 }
 
@@ -23,5 +42,64 @@ type PhoneRepoI interface {
 	GetByID(ctx context.Context, req *models.PhonePrimaryKey) (*models.Phone, error)
 	GetList(ctx context.Context, req *models.GetListPhoneRequest) (resp *models.GetListPhoneResponse, err error)
 	Update(ctx context.Context, req *models.UpdatePhone) (int64, error)
+	Verify(ctx context.Context, req *models.VerifyPhone) (int64, error)
 	Delete(ctx context.Context, req *models.PhonePrimaryKey) (int64, error)
 }
+
+type AuditRepoI interface {
+	Create(ctx context.Context, req *models.CreateAuditEvent) (string, error)
+	GetList(ctx context.Context, req *models.GetListAuditRequest) (resp *models.GetListAuditResponse, err error)
+}
+
+type SessionRepoI interface {
+	Create(ctx context.Context, req *models.CreateSession) (string, error)
+	GetByID(ctx context.Context, req *models.SessionPrimaryKey) (*models.Session, error)
+	GetList(ctx context.Context, req *models.GetListSessionRequest) (resp *models.GetListSessionResponse, err error)
+	Touch(ctx context.Context, req *models.TouchSession) (int64, error)
+	Revoke(ctx context.Context, req *models.SessionPrimaryKey) (int64, error)
+	RevokeAll(ctx context.Context, req *models.RevokeSessions) (int64, error)
+}
+
+type OAuthRepoI interface {
+	CreateClient(ctx context.Context, req *models.CreateOAuthClient) (string, error)
+	GetClient(ctx context.Context, req *models.OAuthClientPrimaryKey) (*models.OAuthClient, error)
+	GetListClient(ctx context.Context, req *models.GetListOAuthClientRequest) (resp *models.GetListOAuthClientResponse, err error)
+	DeleteClient(ctx context.Context, req *models.OAuthClientPrimaryKey) (int64, error)
+	CreateCode(ctx context.Context, req *models.CreateOAuthCode) error
+	ConsumeCode(ctx context.Context, req *models.OAuthCodePrimaryKey) (*models.OAuthCode, error)
+	CreateRefreshToken(ctx context.Context, req *models.CreateOAuthRefreshToken) (string, error)
+	GetRefreshToken(ctx context.Context, req *models.OAuthRefreshTokenPrimaryKey) (*models.OAuthRefreshToken, error)
+	UseRefreshToken(ctx context.Context, req *models.OAuthRefreshTokenPrimaryKey) (int64, error)
+}
+
+type IdentityRepoI interface {
+	Create(ctx context.Context, req *models.CreateUserIdentity) (string, error)
+	GetByID(ctx context.Context, req *models.UserIdentityPrimaryKey) (*models.UserIdentity, error)
+	GetList(ctx context.Context, req *models.GetListUserIdentityRequest) (resp *models.GetListUserIdentityResponse, err error)
+	Touch(ctx context.Context, req *models.TouchUserIdentity) (int64, error)
+	Delete(ctx context.Context, req *models.UserIdentityPrimaryKey) (int64, error)
+}
+
+type APIKeyRepoI interface {
+	Create(ctx context.Context, req *models.CreateAPIKey) (string, error)
+	GetByID(ctx context.Context, req *models.APIKeyPrimaryKey) (*models.APIKey, error)
+	GetList(ctx context.Context, req *models.GetListAPIKeyRequest) (resp *models.GetListAPIKeyResponse, err error)
+	Touch(ctx context.Context, req *models.APIKeyPrimaryKey) (int64, error)
+	Revoke(ctx context.Context, req *models.APIKeyPrimaryKey) (int64, error)
+}
+
+type OTPRepoI interface {
+	Create(ctx context.Context, req *models.CreateOTPCode) (string, error)
+	GetActive(ctx context.Context, req *models.OTPCodePrimaryKey) (*models.OTPCode, error)
+	Attempt(ctx context.Context, req *models.AttemptOTPCode) (int64, error)
+	Consume(ctx context.Context, req *models.OTPCodePrimaryKey) (int64, error)
+}
+
+type WebAuthnRepoI interface {
+	Create(ctx context.Context, req *models.CreateWebAuthnCredential) (string, error)
+	GetByID(ctx context.Context, req *models.WebAuthnCredentialPrimaryKey) (*models.WebAuthnCredential, error)
+	GetList(ctx context.Context, req *models.GetListWebAuthnCredentialRequest) (resp *models.GetListWebAuthnCredentialResponse, err error)
+	Touch(ctx context.Context, req *models.TouchWebAuthnCredential) (int64, error)
+	Delete(ctx context.Context, req *models.WebAuthnCredentialPrimaryKey) (int64, error)
+	UseChallenge(ctx context.Context, req *models.UseWebAuthnChallenge) (int64, error)
+}
@@ -0,0 +1,52 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type apiKeyRepo struct {
+	repo storage.APIKeyRepoI
+}
+
+func (r *apiKeyRepo) Create(ctx context.Context, req *models.CreateAPIKey) (id string, err error) {
+	ctx, span := startSpan(ctx, "apiKey.Create")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.Create(ctx, req)
+}
+
+func (r *apiKeyRepo) GetByID(ctx context.Context, req *models.APIKeyPrimaryKey) (resp *models.APIKey, err error) {
+	ctx, span := startSpan(ctx, "apiKey.GetByID")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetByID(ctx, req)
+}
+
+func (r *apiKeyRepo) GetList(ctx context.Context, req *models.GetListAPIKeyRequest) (resp *models.GetListAPIKeyResponse, err error) {
+	ctx, span := startSpan(ctx, "apiKey.GetList")
+	defer func() {
+		var rows int64
+		if resp != nil {
+			rows = int64(len(resp.APIKeys))
+		}
+		endSpan(span, rows, err)
+	}()
+
+	return r.repo.GetList(ctx, req)
+}
+
+func (r *apiKeyRepo) Touch(ctx context.Context, req *models.APIKeyPrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "apiKey.Touch")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Touch(ctx, req)
+}
+
+func (r *apiKeyRepo) Revoke(ctx context.Context, req *models.APIKeyPrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "apiKey.Revoke")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Revoke(ctx, req)
+}
@@ -0,0 +1,31 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type auditRepo struct {
+	repo storage.AuditRepoI
+}
+
+func (r *auditRepo) Create(ctx context.Context, req *models.CreateAuditEvent) (id string, err error) {
+	ctx, span := startSpan(ctx, "audit.Create")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.Create(ctx, req)
+}
+
+func (r *auditRepo) GetList(ctx context.Context, req *models.GetListAuditRequest) (resp *models.GetListAuditResponse, err error) {
+	ctx, span := startSpan(ctx, "audit.GetList")
+	defer func() {
+		var rows int64
+		if resp != nil {
+			rows = int64(len(resp.Events))
+		}
+		endSpan(span, rows, err)
+	}()
+
+	return r.repo.GetList(ctx, req)
+}
@@ -0,0 +1,52 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type identityRepo struct {
+	repo storage.IdentityRepoI
+}
+
+func (r *identityRepo) Create(ctx context.Context, req *models.CreateUserIdentity) (id string, err error) {
+	ctx, span := startSpan(ctx, "identity.Create")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.Create(ctx, req)
+}
+
+func (r *identityRepo) GetByID(ctx context.Context, req *models.UserIdentityPrimaryKey) (resp *models.UserIdentity, err error) {
+	ctx, span := startSpan(ctx, "identity.GetByID")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetByID(ctx, req)
+}
+
+func (r *identityRepo) GetList(ctx context.Context, req *models.GetListUserIdentityRequest) (resp *models.GetListUserIdentityResponse, err error) {
+	ctx, span := startSpan(ctx, "identity.GetList")
+	defer func() {
+		var rows int64
+		if resp != nil {
+			rows = int64(len(resp.Identities))
+		}
+		endSpan(span, rows, err)
+	}()
+
+	return r.repo.GetList(ctx, req)
+}
+
+func (r *identityRepo) Touch(ctx context.Context, req *models.TouchUserIdentity) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "identity.Touch")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Touch(ctx, req)
+}
+
+func (r *identityRepo) Delete(ctx context.Context, req *models.UserIdentityPrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "identity.Delete")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Delete(ctx, req)
+}
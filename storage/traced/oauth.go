@@ -0,0 +1,80 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type oauthRepo struct {
+	repo storage.OAuthRepoI
+}
+
+func (r *oauthRepo) CreateClient(ctx context.Context, req *models.CreateOAuthClient) (id string, err error) {
+	ctx, span := startSpan(ctx, "oauth.CreateClient")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.CreateClient(ctx, req)
+}
+
+func (r *oauthRepo) GetClient(ctx context.Context, req *models.OAuthClientPrimaryKey) (resp *models.OAuthClient, err error) {
+	ctx, span := startSpan(ctx, "oauth.GetClient")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetClient(ctx, req)
+}
+
+func (r *oauthRepo) GetListClient(ctx context.Context, req *models.GetListOAuthClientRequest) (resp *models.GetListOAuthClientResponse, err error) {
+	ctx, span := startSpan(ctx, "oauth.GetListClient")
+	defer func() {
+		var rows int64
+		if resp != nil {
+			rows = int64(len(resp.Clients))
+		}
+		endSpan(span, rows, err)
+	}()
+
+	return r.repo.GetListClient(ctx, req)
+}
+
+func (r *oauthRepo) DeleteClient(ctx context.Context, req *models.OAuthClientPrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "oauth.DeleteClient")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.DeleteClient(ctx, req)
+}
+
+func (r *oauthRepo) CreateCode(ctx context.Context, req *models.CreateOAuthCode) (err error) {
+	ctx, span := startSpan(ctx, "oauth.CreateCode")
+	defer func() { endSpan(span, found(err == nil), err) }()
+
+	return r.repo.CreateCode(ctx, req)
+}
+
+func (r *oauthRepo) ConsumeCode(ctx context.Context, req *models.OAuthCodePrimaryKey) (resp *models.OAuthCode, err error) {
+	ctx, span := startSpan(ctx, "oauth.ConsumeCode")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.ConsumeCode(ctx, req)
+}
+
+func (r *oauthRepo) CreateRefreshToken(ctx context.Context, req *models.CreateOAuthRefreshToken) (id string, err error) {
+	ctx, span := startSpan(ctx, "oauth.CreateRefreshToken")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.CreateRefreshToken(ctx, req)
+}
+
+func (r *oauthRepo) GetRefreshToken(ctx context.Context, req *models.OAuthRefreshTokenPrimaryKey) (resp *models.OAuthRefreshToken, err error) {
+	ctx, span := startSpan(ctx, "oauth.GetRefreshToken")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetRefreshToken(ctx, req)
+}
+
+func (r *oauthRepo) UseRefreshToken(ctx context.Context, req *models.OAuthRefreshTokenPrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "oauth.UseRefreshToken")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.UseRefreshToken(ctx, req)
+}
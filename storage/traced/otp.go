@@ -0,0 +1,39 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type otpRepo struct {
+	repo storage.OTPRepoI
+}
+
+func (r *otpRepo) Create(ctx context.Context, req *models.CreateOTPCode) (id string, err error) {
+	ctx, span := startSpan(ctx, "otp.Create")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.Create(ctx, req)
+}
+
+func (r *otpRepo) GetActive(ctx context.Context, req *models.OTPCodePrimaryKey) (resp *models.OTPCode, err error) {
+	ctx, span := startSpan(ctx, "otp.GetActive")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetActive(ctx, req)
+}
+
+func (r *otpRepo) Attempt(ctx context.Context, req *models.AttemptOTPCode) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "otp.Attempt")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Attempt(ctx, req)
+}
+
+func (r *otpRepo) Consume(ctx context.Context, req *models.OTPCodePrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "otp.Consume")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Consume(ctx, req)
+}
@@ -0,0 +1,59 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type phoneRepo struct {
+	repo storage.PhoneRepoI
+}
+
+func (r *phoneRepo) Create(ctx context.Context, req *models.CreatePhone) (id string, err error) {
+	ctx, span := startSpan(ctx, "phone.Create")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.Create(ctx, req)
+}
+
+func (r *phoneRepo) GetByID(ctx context.Context, req *models.PhonePrimaryKey) (resp *models.Phone, err error) {
+	ctx, span := startSpan(ctx, "phone.GetByID")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetByID(ctx, req)
+}
+
+func (r *phoneRepo) GetList(ctx context.Context, req *models.GetListPhoneRequest) (resp *models.GetListPhoneResponse, err error) {
+	ctx, span := startSpan(ctx, "phone.GetList")
+	defer func() {
+		var rows int64
+		if resp != nil {
+			rows = int64(len(resp.Phones))
+		}
+		endSpan(span, rows, err)
+	}()
+
+	return r.repo.GetList(ctx, req)
+}
+
+func (r *phoneRepo) Update(ctx context.Context, req *models.UpdatePhone) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "phone.Update")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Update(ctx, req)
+}
+
+func (r *phoneRepo) Verify(ctx context.Context, req *models.VerifyPhone) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "phone.Verify")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Verify(ctx, req)
+}
+
+func (r *phoneRepo) Delete(ctx context.Context, req *models.PhonePrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "phone.Delete")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Delete(ctx, req)
+}
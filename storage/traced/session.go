@@ -0,0 +1,59 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type sessionRepo struct {
+	repo storage.SessionRepoI
+}
+
+func (r *sessionRepo) Create(ctx context.Context, req *models.CreateSession) (id string, err error) {
+	ctx, span := startSpan(ctx, "session.Create")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.Create(ctx, req)
+}
+
+func (r *sessionRepo) GetByID(ctx context.Context, req *models.SessionPrimaryKey) (resp *models.Session, err error) {
+	ctx, span := startSpan(ctx, "session.GetByID")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetByID(ctx, req)
+}
+
+func (r *sessionRepo) GetList(ctx context.Context, req *models.GetListSessionRequest) (resp *models.GetListSessionResponse, err error) {
+	ctx, span := startSpan(ctx, "session.GetList")
+	defer func() {
+		var rows int64
+		if resp != nil {
+			rows = int64(len(resp.Sessions))
+		}
+		endSpan(span, rows, err)
+	}()
+
+	return r.repo.GetList(ctx, req)
+}
+
+func (r *sessionRepo) Touch(ctx context.Context, req *models.TouchSession) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "session.Touch")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Touch(ctx, req)
+}
+
+func (r *sessionRepo) Revoke(ctx context.Context, req *models.SessionPrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "session.Revoke")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Revoke(ctx, req)
+}
+
+func (r *sessionRepo) RevokeAll(ctx context.Context, req *models.RevokeSessions) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "session.RevokeAll")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.RevokeAll(ctx, req)
+}
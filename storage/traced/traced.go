@@ -0,0 +1,90 @@
+package traced
+
+import (
+	"app/pkg/tracing"
+	"app/storage"
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Store wraps a storage.StorageI and opens a child span around every repository call.
+type Store struct {
+	storage.StorageI
+}
+
+func NewStore(store storage.StorageI) *Store {
+	return &Store{StorageI: store}
+}
+
+func (s *Store) User() storage.UserRepoI {
+	return &userRepo{repo: s.StorageI.User()}
+}
+
+func (s *Store) Phone() storage.PhoneRepoI {
+	return &phoneRepo{repo: s.StorageI.Phone()}
+}
+
+func (s *Store) Audit() storage.AuditRepoI {
+	return &auditRepo{repo: s.StorageI.Audit()}
+}
+
+func (s *Store) Session() storage.SessionRepoI {
+	return &sessionRepo{repo: s.StorageI.Session()}
+}
+
+func (s *Store) OAuth() storage.OAuthRepoI {
+	return &oauthRepo{repo: s.StorageI.OAuth()}
+}
+
+func (s *Store) Identity() storage.IdentityRepoI {
+	return &identityRepo{repo: s.StorageI.Identity()}
+}
+
+func (s *Store) APIKey() storage.APIKeyRepoI {
+	return &apiKeyRepo{repo: s.StorageI.APIKey()}
+}
+
+func (s *Store) OTP() storage.OTPRepoI {
+	return &otpRepo{repo: s.StorageI.OTP()}
+}
+
+func (s *Store) WebAuthn() storage.WebAuthnRepoI {
+	return &webAuthnRepo{repo: s.StorageI.WebAuthn()}
+}
+
+func startSpan(ctx context.Context, statement string) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "storage."+statement,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", statement),
+		),
+	)
+}
+
+// endSpan ends span with the rows the call returned or changed. A lookup
+// which found nothing is an answer, not a failure of the database, so it
+// ends with 0 rows and no error.
+func endSpan(span trace.Span, rowsAffected int64, err error) {
+	switch {
+	case err == nil:
+		span.SetAttributes(attribute.Int64("db.rows_affected", rowsAffected))
+	case err.Error() == "no rows in result set":
+		span.SetAttributes(attribute.Int64("db.rows_affected", 0))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// found returns the rows of a call which returns one row or none.
+func found(ok bool) int64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,198 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/pkg/tracing"
+	"app/storage"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a global tracer provider which keeps the spans in
+// memory. Call the returned function to read the spans ended so far.
+func recordSpans(t *testing.T) func() tracetest.SpanStubs {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider("test", exporter)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	return func() tracetest.SpanStubs {
+		if err := provider.ForceFlush(context.Background()); err != nil {
+			t.Fatalf("ForceFlush: %v", err)
+		}
+		return exporter.GetSpans()
+	}
+}
+
+// fakeStore has a user repository which answers with its fields and
+// remembers the span of the context it was called with.
+type fakeStore struct {
+	storage.StorageI
+
+	users []*models.User
+	rows  int64
+	err   error
+
+	called trace.SpanContext
+}
+
+func (s *fakeStore) User() storage.UserRepoI { return fakeUserRepo{s: s} }
+
+type fakeUserRepo struct {
+	storage.UserRepoI
+	s *fakeStore
+}
+
+func (r fakeUserRepo) GetByID(ctx context.Context, req *models.UserPrimaryKey) (*models.User, error) {
+	r.s.called = trace.SpanContextFromContext(ctx)
+	if r.s.err != nil {
+		return nil, r.s.err
+	}
+	return r.s.users[0], nil
+}
+
+func (r fakeUserRepo) GetList(ctx context.Context, req *models.GetListUserRequest) (*models.GetListUserResponse, error) {
+	r.s.called = trace.SpanContextFromContext(ctx)
+	if r.s.err != nil {
+		return nil, r.s.err
+	}
+	return &models.GetListUserResponse{Count: len(r.s.users), Users: r.s.users}, nil
+}
+
+func (r fakeUserRepo) Update(ctx context.Context, req *models.UpdateUser) (int64, error) {
+	r.s.called = trace.SpanContextFromContext(ctx)
+	return r.s.rows, r.s.err
+}
+
+func TestRepoSpans(t *testing.T) {
+	errStorage := errors.New("connection refused")
+
+	tests := []struct {
+		name  string
+		store *fakeStore
+		call  func(ctx context.Context, store *Store) error
+		span  string
+		rows  int64
+		fails bool
+	}{
+		{
+			name:  "get by id",
+			store: &fakeStore{users: []*models.User{{Id: "1"}}},
+			call: func(ctx context.Context, store *Store) error {
+				_, err := store.User().GetByID(ctx, &models.UserPrimaryKey{Id: "1"})
+				return err
+			},
+			span: "user.GetByID",
+			rows: 1,
+		},
+		{
+			name:  "list counts the rows returned",
+			store: &fakeStore{users: []*models.User{{Id: "1"}, {Id: "2"}, {Id: "3"}}},
+			call: func(ctx context.Context, store *Store) error {
+				_, err := store.User().GetList(ctx, &models.GetListUserRequest{Limit: 10})
+				return err
+			},
+			span: "user.GetList",
+			rows: 3,
+		},
+		{
+			name:  "update counts the rows affected",
+			store: &fakeStore{rows: 0},
+			call: func(ctx context.Context, store *Store) error {
+				_, err := store.User().Update(ctx, &models.UpdateUser{Id: "1"})
+				return err
+			},
+			span: "user.Update",
+			rows: 0,
+		},
+		{
+			name:  "error",
+			store: &fakeStore{err: errStorage},
+			call: func(ctx context.Context, store *Store) error {
+				_, err := store.User().GetList(ctx, &models.GetListUserRequest{Limit: 10})
+				return err
+			},
+			span:  "user.GetList",
+			fails: true,
+		},
+		{
+			name:  "no rows is not an error",
+			store: &fakeStore{err: pgx.ErrNoRows},
+			call: func(ctx context.Context, store *Store) error {
+				_, err := store.User().GetByID(ctx, &models.UserPrimaryKey{Id: "1"})
+				return err
+			},
+			span: "user.GetByID",
+			rows: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := recordSpans(t)
+
+			ctx, parent := tracing.Tracer().Start(context.Background(), "GET /v1/user")
+			err := tt.call(ctx, NewStore(tt.store))
+			parent.End()
+			if !errors.Is(err, tt.store.err) {
+				t.Fatalf("error = %v, want %v", err, tt.store.err)
+			}
+
+			got := spans()
+			if len(got) != 2 {
+				t.Fatalf("%d spans, want the storage span and its parent", len(got))
+			}
+			span := got[0]
+			if span.Name != "storage."+tt.span {
+				t.Fatalf("span name = %q, want storage.%s", span.Name, tt.span)
+			}
+
+			if span.SpanKind != trace.SpanKindClient {
+				t.Errorf("kind = %v, want client", span.SpanKind)
+			}
+			if span.Parent.SpanID() != parent.SpanContext().SpanID() || span.SpanContext.TraceID() != parent.SpanContext().TraceID() {
+				t.Errorf("span is not a child of the request span")
+			}
+			if !tt.store.called.Equal(span.SpanContext) {
+				t.Errorf("the repository was called without the storage span in its context")
+			}
+
+			attrs := attribute.NewSet(span.Attributes...)
+			if v, _ := attrs.Value("db.system"); v.AsString() != "postgresql" {
+				t.Errorf("db.system = %q", v.AsString())
+			}
+			if v, _ := attrs.Value("db.operation"); v.AsString() != tt.span {
+				t.Errorf("db.operation = %q, want %q", v.AsString(), tt.span)
+			}
+
+			rows, hasRows := attrs.Value("db.rows_affected")
+			if tt.fails {
+				if span.Status.Code != codes.Error || span.Status.Description != tt.store.err.Error() {
+					t.Errorf("status = %+v, want the error", span.Status)
+				}
+				if len(span.Events) != 1 || span.Events[0].Name != "exception" {
+					t.Errorf("events = %+v, want the recorded error", span.Events)
+				}
+				if hasRows {
+					t.Errorf("db.rows_affected set on a failed call")
+				}
+				return
+			}
+
+			if span.Status.Code != codes.Unset || len(span.Events) > 0 {
+				t.Errorf("status = %+v with events %+v, want unset", span.Status, span.Events)
+			}
+			if !hasRows || rows.AsInt64() != tt.rows {
+				t.Errorf("db.rows_affected = %v, want %d", rows.AsInt64(), tt.rows)
+			}
+		})
+	}
+}
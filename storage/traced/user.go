@@ -0,0 +1,73 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type userRepo struct {
+	repo storage.UserRepoI
+}
+
+func (r *userRepo) Create(ctx context.Context, req *models.CreateUser) (id string, err error) {
+	ctx, span := startSpan(ctx, "user.Create")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.Create(ctx, req)
+}
+
+func (r *userRepo) GetByID(ctx context.Context, req *models.UserPrimaryKey) (resp *models.User, err error) {
+	ctx, span := startSpan(ctx, "user.GetByID")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetByID(ctx, req)
+}
+
+func (r *userRepo) GetList(ctx context.Context, req *models.GetListUserRequest) (resp *models.GetListUserResponse, err error) {
+	ctx, span := startSpan(ctx, "user.GetList")
+	defer func() {
+		var rows int64
+		if resp != nil {
+			rows = int64(len(resp.Users))
+		}
+		endSpan(span, rows, err)
+	}()
+
+	return r.repo.GetList(ctx, req)
+}
+
+func (r *userRepo) Update(ctx context.Context, req *models.UpdateUser) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "user.Update")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Update(ctx, req)
+}
+
+func (r *userRepo) UpdatePassword(ctx context.Context, req *models.UpdateUserPassword) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "user.UpdatePassword")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.UpdatePassword(ctx, req)
+}
+
+func (r *userRepo) UpdateRole(ctx context.Context, req *models.UpdateUserRole) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "user.UpdateRole")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.UpdateRole(ctx, req)
+}
+
+func (r *userRepo) VerifyEmail(ctx context.Context, req *models.VerifyUserEmail) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "user.VerifyEmail")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.VerifyEmail(ctx, req)
+}
+
+func (r *userRepo) Delete(ctx context.Context, req *models.UserPrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "user.Delete")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Delete(ctx, req)
+}
@@ -0,0 +1,59 @@
+package traced
+
+import (
+	"app/api/models"
+	"app/storage"
+	"context"
+)
+
+type webAuthnRepo struct {
+	repo storage.WebAuthnRepoI
+}
+
+func (r *webAuthnRepo) Create(ctx context.Context, req *models.CreateWebAuthnCredential) (id string, err error) {
+	ctx, span := startSpan(ctx, "webAuthn.Create")
+	defer func() { endSpan(span, found(len(id) > 0), err) }()
+
+	return r.repo.Create(ctx, req)
+}
+
+func (r *webAuthnRepo) GetByID(ctx context.Context, req *models.WebAuthnCredentialPrimaryKey) (resp *models.WebAuthnCredential, err error) {
+	ctx, span := startSpan(ctx, "webAuthn.GetByID")
+	defer func() { endSpan(span, found(resp != nil), err) }()
+
+	return r.repo.GetByID(ctx, req)
+}
+
+func (r *webAuthnRepo) GetList(ctx context.Context, req *models.GetListWebAuthnCredentialRequest) (resp *models.GetListWebAuthnCredentialResponse, err error) {
+	ctx, span := startSpan(ctx, "webAuthn.GetList")
+	defer func() {
+		var rows int64
+		if resp != nil {
+			rows = int64(len(resp.Credentials))
+		}
+		endSpan(span, rows, err)
+	}()
+
+	return r.repo.GetList(ctx, req)
+}
+
+func (r *webAuthnRepo) Touch(ctx context.Context, req *models.TouchWebAuthnCredential) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "webAuthn.Touch")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Touch(ctx, req)
+}
+
+func (r *webAuthnRepo) UseChallenge(ctx context.Context, req *models.UseWebAuthnChallenge) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "webAuthn.UseChallenge")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.UseChallenge(ctx, req)
+}
+
+func (r *webAuthnRepo) Delete(ctx context.Context, req *models.WebAuthnCredentialPrimaryKey) (rows int64, err error) {
+	ctx, span := startSpan(ctx, "webAuthn.Delete")
+	defer func() { endSpan(span, rows, err) }()
+
+	return r.repo.Delete(ctx, req)
+}